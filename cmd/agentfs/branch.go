@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	cpkg "github.com/sleexyz/agentfs/internal/checkpoint"
+	"github.com/sleexyz/agentfs/internal/context"
+	"github.com/sleexyz/agentfs/internal/db"
+	"github.com/spf13/cobra"
+)
+
+var branchDeleteFlag bool
+
+var branchCmd = &cobra.Command{
+	Use:   "branch [name] [revision]",
+	Short: "List, create, or delete branches",
+	Long: `List, create, or delete branches: named lines of development.
+
+New checkpoints go on the current branch: their parent is the branch's head,
+and they become its head. Use 'agentfs switch' to change branches.
+
+Usage:
+  agentfs branch                 # List branches (* marks the current one)
+  agentfs branch approach-b      # Branch from the current branch's head
+  agentfs branch approach-b v3   # Branch from v3
+  agentfs branch -d approach-b   # Delete a branch (its checkpoints are kept)
+
+Every store starts on the branch "main".`,
+	Args: cobra.MaximumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if branchDeleteFlag && len(args) != 1 {
+			exitWithError(ExitUsageError, "--delete takes exactly one branch name")
+		}
+
+		// Resolve store
+		storePath, err := context.MustResolveStore(storeFlag, "")
+		if err != nil {
+			exitWithError(ExitUsageError, "%v", err)
+		}
+
+		// Get store info
+		s, err := storeManager.GetFromPath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		if s == nil {
+			exitWithError(ExitStoreNotFound, "store not found")
+		}
+
+		// Open per-store database
+		database, err := db.OpenFromStorePath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "failed to open database: %v", err)
+		}
+		defer database.Close()
+
+		cpManager := cpkg.NewManager(storeManager, database, s)
+
+		if len(args) == 0 {
+			listBranches(cpManager)
+			return
+		}
+		name := args[0]
+
+		lock := lockStore(storePath, false)
+		defer lock.Unlock()
+
+		if branchDeleteFlag {
+			branch, err := cpManager.DeleteBranch(name)
+			if err != nil {
+				exitWithError(ExitError, "%v", err)
+			}
+			if branch.HeadVersion != nil {
+				fmt.Printf("Deleted branch %s (was v%d)\n", name, *branch.HeadVersion)
+			} else {
+				fmt.Printf("Deleted branch %s\n", name)
+			}
+			return
+		}
+
+		version := createBranch(cpManager, database, args)
+
+		if jsonFlag {
+			type branchJSON struct {
+				Name string `json:"name"`
+				Head string `json:"head"`
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(branchJSON{Name: name, Head: fmt.Sprintf("v%d", version)})
+			return
+		}
+
+		fmt.Printf("Created branch %s at v%d\n", name, version)
+	},
+}
+
+// createBranch creates the branch args[0] at the revision args[1] (default:
+// the current branch's head) and returns its head version
+func createBranch(cpManager *cpkg.Manager, database *db.DB, args []string) int {
+	var version int
+	if len(args) > 1 {
+		version = resolveRevision(database, args[1])
+	} else {
+		head, err := cpManager.Head()
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		if head == nil {
+			exitWithError(ExitCPNotFound, "no checkpoints to branch from")
+		}
+		version = head.Version
+	}
+
+	if err := cpManager.CreateBranch(args[0], version); err != nil {
+		if errors.Is(err, db.ErrBranchExists) {
+			exitWithError(ExitError, "branch %s already exists", args[0])
+		}
+		exitWithError(ExitError, "%v", err)
+	}
+	return version
+}
+
+// listBranches prints all branches with their heads, marking the current one
+func listBranches(cpManager *cpkg.Manager) {
+	branches, err := cpManager.ListBranches()
+	if err != nil {
+		exitWithError(ExitError, "%v", err)
+	}
+	current, err := cpManager.CurrentBranch()
+	if err != nil {
+		exitWithError(ExitError, "%v", err)
+	}
+
+	if jsonFlag {
+		type branchJSON struct {
+			Name    string `json:"name"`
+			Head    string `json:"head,omitempty"`
+			Message string `json:"message,omitempty"`
+			Current bool   `json:"current"`
+		}
+
+		output := []branchJSON{}
+		for _, b := range branches {
+			bj := branchJSON{Name: b.Name, Current: b.Name == current}
+			if b.HeadVersion != nil {
+				bj.Head = fmt.Sprintf("v%d", *b.HeadVersion)
+				if cp, _ := cpManager.Get(*b.HeadVersion); cp != nil {
+					bj.Message = cp.Message
+				}
+			}
+			output = append(output, bj)
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(output)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  BRANCH\tHEAD\tMESSAGE")
+	for _, b := range branches {
+		marker := " "
+		if b.Name == current {
+			marker = "*"
+		}
+		head, message := "-", ""
+		if b.HeadVersion != nil {
+			head = fmt.Sprintf("v%d", *b.HeadVersion)
+			if cp, _ := cpManager.Get(*b.HeadVersion); cp != nil {
+				message = cp.Message
+			}
+		}
+		if len(message) > 40 {
+			message = message[:37] + "..."
+		}
+		fmt.Fprintf(w, "%s %s\t%s\t%s\n", marker, b.Name, head, message)
+	}
+	w.Flush()
+}
+
+func init() {
+	branchCmd.Flags().BoolVarP(&branchDeleteFlag, "delete", "d", false, "delete the named branch")
+	rootCmd.AddCommand(branchCmd)
+}
@@ -2,11 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
-	"strconv"
+	"sort"
 	"strings"
 	"text/tabwriter"
 	"time"
@@ -14,6 +15,7 @@ import (
 	cpkg "github.com/sleexyz/agentfs/internal/checkpoint"
 	"github.com/sleexyz/agentfs/internal/context"
 	"github.com/sleexyz/agentfs/internal/db"
+	"github.com/sleexyz/agentfs/internal/revision"
 	"github.com/dustin/go-humanize"
 	"github.com/spf13/cobra"
 )
@@ -26,12 +28,14 @@ var checkpointCmd = &cobra.Command{
 
 var cpAutoFlag bool
 var cpFromHookFlag bool
+var cpMetaFlags []string
 
 // HookInput represents the JSON input from Claude Code hooks
 type HookInput struct {
 	SessionID     string                 `json:"session_id"`
 	ToolName      string                 `json:"tool_name"`
 	ToolInput     map[string]interface{} `json:"tool_input"`
+	ToolUseID     string                 `json:"tool_use_id"`
 	HookEventName string                 `json:"hook_event_name"`
 }
 
@@ -40,19 +44,39 @@ var cpCreateCmd = &cobra.Command{
 	Short: "Create a new checkpoint",
 	Long: `Create a new checkpoint of the current state.
 
-Uses APFS reflinks to create instant (~20ms) snapshots of the sparse bundle bands.
+The store's backend takes the snapshot: the sparsebundle and loop backends
+reflink-clone their data files (instant on APFS, btrfs or XFS), and the dir
+backend records a manifest of the files, storing only those that changed.
 
 With --auto flag, the command:
   - Detects store from current directory (via .agentfs file)
   - Skips silently if not in an agentfs directory
   - Skips silently if store is not mounted
   - Skips silently if no changes since last checkpoint
-  - Uses "auto" as the message if none provided`,
+  - Uses "auto" as the message if none provided
+
+With --from-hook, the hook's fields (session_id, tool_name, hook_event_name,
+and the tool's file_path or command) are recorded as checkpoint metadata.
+Add your own with --meta key=value; filter on it with
+'agentfs checkpoint list --meta key=value'.
+
+Run from both PreToolUse and PostToolUse hooks, the checkpoints before and
+after each tool call are paired by the hook's tool_use_id (the current head
+stands in when nothing changed), so 'agentfs why <path>' can tell which tool
+calls changed a file.
+
+Concurrent checkpoints queue on the store lock; pass --no-wait to skip
+instead when another agentfs process is working on the store.`,
 	Args: cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		var storePath string
 		var err error
 
+		userMeta, err := parseMeta(cpMetaFlags)
+		if err != nil {
+			exitWithError(ExitUsageError, "%v", err)
+		}
+
 		if cpAutoFlag {
 			// Auto mode: detect store from cwd
 			storePath, err = context.FindStoreFromCwd()
@@ -87,8 +111,12 @@ With --auto flag, the command:
 			exitWithError(ExitStoreNotFound, "store not found")
 		}
 
+		// Serialize with other checkpoint/restore/delete processes
+		lock := lockStore(storePath, cpAutoFlag)
+		defer lock.Unlock()
+
 		// Check if mounted
-		if !storeManager.IsMounted(s.MountPath) {
+		if !storeManager.IsMounted(s) {
 			if cpAutoFlag {
 				os.Exit(0) // Silent exit in auto mode
 			}
@@ -108,6 +136,11 @@ With --auto flag, the command:
 		// Create checkpoint manager
 		cpManager := cpkg.NewManager(storeManager, database, s)
 
+		var hookInput *HookInput
+		if cpFromHookFlag {
+			hookInput = readHookInput()
+		}
+
 		// In auto mode, check for changes
 		if cpAutoFlag {
 			hasChanges, err := cpManager.HasChanges()
@@ -115,19 +148,33 @@ With --auto flag, the command:
 				os.Exit(1) // Error exit
 			}
 			if !hasChanges {
+				// A tool call is still bracketed by the unchanged head
+				if err := recordToolCall(cpManager, hookInput, nil); err != nil {
+					os.Exit(1)
+				}
 				os.Exit(0) // No changes - silent exit
 			}
 		}
 
+		// Hook fields are kept as metadata, and summarized as the message
+		meta := hookMeta(hookInput)
+		for key, value := range userMeta {
+			meta[key] = value
+		}
+
 		var message string
 		if len(args) > 0 {
 			message = args[0]
 		} else if cpAutoFlag {
-			message = generateAutoMessage()
+			message = generateAutoMessage(hookInput)
 		}
 
+		if !cpAutoFlag && !jsonFlag {
+			s.Progress = cloneProgress()
+		}
 		cp, duration, err := cpManager.Create(cpkg.CreateOpts{
 			Message: message,
+			Meta:    meta,
 		})
 		if err != nil {
 			if cpAutoFlag {
@@ -136,6 +183,25 @@ With --auto flag, the command:
 			exitWithError(ExitError, "%v", err)
 		}
 
+		if err := recordToolCall(cpManager, hookInput, cp); err != nil {
+			if cpAutoFlag {
+				os.Exit(1)
+			}
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+
+		// Apply the retention policy if the store runs gc after each checkpoint
+		pruned, gcErr := autoGC(cpManager)
+		if !cpAutoFlag {
+			defer func() {
+				if gcErr != nil {
+					fmt.Fprintf(os.Stderr, "warning: gc failed: %v\n", gcErr)
+				} else if pruned != "" && !jsonFlag {
+					fmt.Fprintf(os.Stderr, "gc: %s\n", pruned)
+				}
+			}()
+		}
+
 		// In auto mode, silent success
 		if cpAutoFlag {
 			os.Exit(0)
@@ -143,11 +209,13 @@ With --auto flag, the command:
 
 		if jsonFlag {
 			type createJSON struct {
-				Version       string `json:"version"`
-				Message       string `json:"message,omitempty"`
-				CreatedAt     string `json:"created_at"`
-				DurationMs    int64  `json:"duration_ms"`
-				ParentVersion *int   `json:"parent_version"`
+				Version       string            `json:"version"`
+				Message       string            `json:"message,omitempty"`
+				CreatedAt     string            `json:"created_at"`
+				DurationMs    int64             `json:"duration_ms"`
+				ParentVersion *int              `json:"parent_version"`
+				Branch        string            `json:"branch,omitempty"`
+				Meta          map[string]string `json:"meta,omitempty"`
 			}
 
 			output := createJSON{
@@ -156,6 +224,8 @@ With --auto flag, the command:
 				CreatedAt:     cp.CreatedAt.Format(time.RFC3339),
 				DurationMs:    duration.Milliseconds(),
 				ParentVersion: cp.ParentVersion,
+				Branch:        cp.Branch,
+				Meta:          meta,
 			}
 
 			enc := json.NewEncoder(os.Stdout)
@@ -174,13 +244,24 @@ With --auto flag, the command:
 }
 
 var cpListLimit int
+var cpListMetaFlags []string
 
 var cpListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List checkpoints",
-	Long:  `List all checkpoints for the current store.`,
-	Args:  cobra.NoArgs,
+	Long: `List all checkpoints for the current store.
+
+Filter by metadata with --meta key=value (repeatable; all must match). Values
+may be glob patterns:
+
+  agentfs checkpoint list --meta session_id='f55a4d56*' --meta tool_name=Bash`,
+	Args: cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
+		filters, err := parseMeta(cpListMetaFlags)
+		if err != nil {
+			exitWithError(ExitUsageError, "%v", err)
+		}
+
 		// Resolve store
 		storePath, err := context.MustResolveStore(storeFlag, "")
 		if err != nil {
@@ -206,18 +287,52 @@ var cpListCmd = &cobra.Command{
 		// Create checkpoint manager
 		cpManager := cpkg.NewManager(storeManager, database, s)
 
-		checkpoints, err := cpManager.List(cpListLimit)
+		limit := cpListLimit
+		if len(filters) > 0 {
+			limit = 0 // Applied after filtering
+		}
+		checkpoints, err := cpManager.List(limit)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		if len(filters) > 0 {
+			matches, err := cpManager.FindByMeta(filters)
+			if err != nil {
+				exitWithError(ExitError, "%v", err)
+			}
+			var filtered []*db.Checkpoint
+			for _, cp := range checkpoints {
+				if matches[cp.Version] && (cpListLimit <= 0 || len(filtered) < cpListLimit) {
+					filtered = append(filtered, cp)
+				}
+			}
+			checkpoints = filtered
+		}
+
+		tags, err := cpManager.ListTags()
 		if err != nil {
 			exitWithError(ExitError, "%v", err)
 		}
+		tagsByVersion := make(map[int][]string)
+		for _, t := range tags {
+			tagsByVersion[t.Version] = append(tagsByVersion[t.Version], t.Name)
+		}
 
 		if jsonFlag {
 			type cpJSON struct {
-				Version       string `json:"version"`
-				Message       string `json:"message,omitempty"`
-				CreatedAt     string `json:"created_at"`
-				DurationMs    int64  `json:"duration_ms,omitempty"`
-				ParentVersion *int   `json:"parent_version"`
+				Version       string            `json:"version"`
+				Message       string            `json:"message,omitempty"`
+				CreatedAt     string            `json:"created_at"`
+				DurationMs    int64             `json:"duration_ms,omitempty"`
+				ParentVersion *int              `json:"parent_version"`
+				Branch        string            `json:"branch,omitempty"`
+				Tags          []string          `json:"tags,omitempty"`
+				Meta          map[string]string `json:"meta,omitempty"`
+			}
+
+			meta, err := cpManager.ListMeta()
+			if err != nil {
+				exitWithError(ExitError, "%v", err)
 			}
 
 			var output []cpJSON
@@ -228,6 +343,9 @@ var cpListCmd = &cobra.Command{
 					CreatedAt:     cp.CreatedAt.Format(time.RFC3339),
 					DurationMs:    cp.DurationMs,
 					ParentVersion: cp.ParentVersion,
+					Branch:        cp.Branch,
+					Tags:          tagsByVersion[cp.Version],
+					Meta:          meta[cp.Version],
 				})
 			}
 
@@ -237,7 +355,15 @@ var cpListCmd = &cobra.Command{
 			return
 		}
 
+		if len(checkpoints) == 0 && len(filters) > 0 {
+			fmt.Println("No matching checkpoints.")
+			return
+		}
 		if len(checkpoints) == 0 {
+			// An empty database next to existing snapshots means metadata.db was lost
+			if versions, _ := s.Backend.ListSnapshots(s); len(versions) > 0 {
+				fmt.Fprintf(os.Stderr, "warning: checkpoints/ holds %d snapshots missing from metadata.db; run 'agentfs repair --rebuild-db'\n", len(versions))
+			}
 			fmt.Println("No checkpoints found. Use 'agentfs checkpoint create' to create one.")
 			return
 		}
@@ -250,6 +376,9 @@ var cpListCmd = &cobra.Command{
 			if len(message) > 40 {
 				message = message[:37] + "..."
 			}
+			if names := tagsByVersion[cp.Version]; len(names) > 0 {
+				message += fmt.Sprintf(" (tag: %s)", strings.Join(names, ", "))
+			}
 
 			fmt.Fprintf(w, "v%d\t%s\t%s\n",
 				cp.Version,
@@ -262,10 +391,13 @@ var cpListCmd = &cobra.Command{
 }
 
 var cpInfoCmd = &cobra.Command{
-	Use:   "info <version>",
+	Use:   "info <revision>",
 	Short: "Show checkpoint details",
-	Long:  `Show detailed information about a specific checkpoint.`,
-	Args:  cobra.ExactArgs(1),
+	Long: `Show detailed information about a specific checkpoint.
+
+The checkpoint can be given as any revision (v3, latest~1, a tag...);
+see 'agentfs restore --help'.`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		// Resolve store
 		storePath, err := context.MustResolveStore(storeFlag, "")
@@ -292,10 +424,7 @@ var cpInfoCmd = &cobra.Command{
 		// Create checkpoint manager
 		cpManager := cpkg.NewManager(storeManager, database, s)
 
-		version, err := parseVersion(args[0])
-		if err != nil {
-			exitWithError(ExitUsageError, "invalid version: %v", err)
-		}
+		version := resolveRevision(database, args[0])
 
 		cp, err := cpManager.Get(version)
 		if err != nil {
@@ -305,14 +434,40 @@ var cpInfoCmd = &cobra.Command{
 			exitWithError(ExitCPNotFound, "checkpoint v%d not found", version)
 		}
 
+		tags, err := database.GetTagsForVersion(version)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+
+		squashed, err := cpManager.ListSquashed(version)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+
+		meta, err := cpManager.GetMeta(version)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+
 		if jsonFlag {
+			type squashedJSON struct {
+				Version   string `json:"version"`
+				Message   string `json:"message,omitempty"`
+				CreatedAt string `json:"created_at"`
+			}
+
 			type infoJSON struct {
-				Version       string `json:"version"`
-				Store         string `json:"store"`
-				Message       string `json:"message,omitempty"`
-				CreatedAt     string `json:"created_at"`
-				DurationMs    int64  `json:"duration_ms,omitempty"`
-				ParentVersion *int   `json:"parent_version"`
+				Version       string            `json:"version"`
+				Store         string            `json:"store"`
+				Message       string            `json:"message,omitempty"`
+				CreatedAt     string            `json:"created_at"`
+				DurationMs    int64             `json:"duration_ms,omitempty"`
+				ParentVersion *int              `json:"parent_version"`
+				MergeParent   *int              `json:"merge_parent,omitempty"`
+				Branch        string            `json:"branch,omitempty"`
+				Tags          []string          `json:"tags,omitempty"`
+				Squashed      []squashedJSON    `json:"squashed,omitempty"`
+				Meta          map[string]string `json:"meta,omitempty"`
 			}
 
 			output := infoJSON{
@@ -322,6 +477,17 @@ var cpInfoCmd = &cobra.Command{
 				CreatedAt:     cp.CreatedAt.Format(time.RFC3339),
 				DurationMs:    cp.DurationMs,
 				ParentVersion: cp.ParentVersion,
+				MergeParent:   cp.MergeParent,
+				Branch:        cp.Branch,
+				Tags:          tags,
+				Meta:          meta,
+			}
+			for _, sq := range squashed {
+				output.Squashed = append(output.Squashed, squashedJSON{
+					Version:   fmt.Sprintf("v%d", sq.Version),
+					Message:   sq.Message,
+					CreatedAt: sq.CreatedAt.Format(time.RFC3339),
+				})
 			}
 
 			enc := json.NewEncoder(os.Stdout)
@@ -342,11 +508,37 @@ var cpInfoCmd = &cobra.Command{
 		if cp.ParentVersion != nil {
 			fmt.Printf("Parent:      v%d\n", *cp.ParentVersion)
 		}
+		if cp.MergeParent != nil {
+			fmt.Printf("Merged:      v%d\n", *cp.MergeParent)
+		}
+		if cp.Branch != "" {
+			fmt.Printf("Branch:      %s\n", cp.Branch)
+		}
+		if len(tags) > 0 {
+			fmt.Printf("Tags:        %s\n", strings.Join(tags, ", "))
+		}
+		if len(meta) > 0 {
+			keys := make([]string, 0, len(meta))
+			for key := range meta {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			fmt.Println("Meta:")
+			for _, key := range keys {
+				fmt.Printf("  %s=%s\n", key, meta[key])
+			}
+		}
+		if len(squashed) > 0 {
+			fmt.Printf("Squashed:    %d checkpoints\n", len(squashed))
+			for _, sq := range squashed {
+				fmt.Printf("  v%-4d %s  %s\n", sq.Version, sq.CreatedAt.Format("2006-01-02 15:04:05"), sq.Message)
+			}
+		}
 	},
 }
 
 var cpDeleteCmd = &cobra.Command{
-	Use:   "delete <version>",
+	Use:   "delete <revision>",
 	Short: "Delete a checkpoint",
 	Long: `Delete a specific checkpoint.
 
@@ -378,10 +570,11 @@ Requires confirmation unless -f/--force is specified.`,
 		// Create checkpoint manager
 		cpManager := cpkg.NewManager(storeManager, database, s)
 
-		version, err := parseVersion(args[0])
-		if err != nil {
-			exitWithError(ExitUsageError, "invalid version: %v", err)
-		}
+		// Resolve the revision under the lock, so it can't move before the delete
+		lock := lockStore(storePath, false)
+		defer lock.Unlock()
+
+		version := resolveRevision(database, args[0])
 
 		cp, err := cpManager.Get(version)
 		if err != nil {
@@ -391,7 +584,16 @@ Requires confirmation unless -f/--force is specified.`,
 			exitWithError(ExitCPNotFound, "checkpoint v%d not found", version)
 		}
 
-		if !confirmPrompt(fmt.Sprintf("Delete checkpoint v%d?", version)) {
+		prompt := fmt.Sprintf("Delete checkpoint v%d?", version)
+		tags, err := database.GetTagsForVersion(version)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		if len(tags) > 0 {
+			prompt = fmt.Sprintf("Delete checkpoint v%d and its tags (%s)?", version, strings.Join(tags, ", "))
+		}
+
+		if !confirmPrompt(prompt) {
 			fmt.Println("Cancelled")
 			return
 		}
@@ -407,7 +609,9 @@ Requires confirmation unless -f/--force is specified.`,
 func init() {
 	cpCreateCmd.Flags().BoolVar(&cpAutoFlag, "auto", false, "auto-checkpoint mode (quiet, skip-if-unchanged)")
 	cpCreateCmd.Flags().BoolVar(&cpFromHookFlag, "from-hook", false, "read hook context from stdin (use with --auto)")
+	cpCreateCmd.Flags().StringArrayVar(&cpMetaFlags, "meta", nil, "record metadata on the checkpoint (key=value, repeatable)")
 	cpListCmd.Flags().IntVar(&cpListLimit, "limit", 0, "limit number of results")
+	cpListCmd.Flags().StringArrayVar(&cpListMetaFlags, "meta", nil, "only checkpoints with this metadata (key=value, value may be a glob; repeatable)")
 
 	checkpointCmd.AddCommand(cpCreateCmd)
 	checkpointCmd.AddCommand(cpListCmd)
@@ -416,39 +620,131 @@ func init() {
 	rootCmd.AddCommand(checkpointCmd)
 }
 
-// parseVersion parses a version string like "v3" or "3" and returns the integer version
-func parseVersion(s string) (int, error) {
-	s = strings.TrimPrefix(s, "v")
-	v, err := strconv.Atoi(s)
-	if err != nil {
-		return 0, fmt.Errorf("version must be a number (e.g., v3 or 3)")
+// resolveRevision resolves a revision argument (v3, latest~1, a tag...) to a
+// version, exiting if it doesn't name a checkpoint
+func resolveRevision(database *db.DB, arg string) int {
+	version, err := revision.Resolve(database, arg)
+	if errors.Is(err, revision.ErrNotFound) {
+		exitWithError(ExitCPNotFound, "%v", err)
 	}
-	if v < 1 {
-		return 0, fmt.Errorf("version must be positive")
+	if err != nil {
+		exitWithError(ExitUsageError, "invalid revision: %v", err)
 	}
-	return v, nil
+	return version
 }
 
-// generateAutoMessage creates a checkpoint message, optionally reading hook context from stdin
-func generateAutoMessage() string {
-	if !cpFromHookFlag {
-		return "auto"
-	}
-
-	// Read JSON from stdin
+// readHookInput reads the Claude Code hook JSON from stdin, returning nil if
+// there is none
+func readHookInput() *HookInput {
 	data, err := io.ReadAll(os.Stdin)
 	if err != nil || len(data) == 0 {
-		return "auto"
+		return nil
 	}
 
 	var hookInput HookInput
 	if err := json.Unmarshal(data, &hookInput); err != nil {
+		return nil
+	}
+	return &hookInput
+}
+
+// hookMeta returns the hook fields worth keeping as checkpoint metadata
+func hookMeta(hookInput *HookInput) map[string]string {
+	meta := make(map[string]string)
+	if hookInput == nil {
+		return meta
+	}
+
+	fields := map[string]string{
+		"session_id":      hookInput.SessionID,
+		"tool_name":       hookInput.ToolName,
+		"tool_use_id":     hookInput.ToolUseID,
+		"hook_event_name": hookInput.HookEventName,
+	}
+	for _, key := range []string{"file_path", "command"} {
+		if value, ok := hookInput.ToolInput[key].(string); ok {
+			fields[key] = value
+		}
+	}
+	for key, value := range fields {
+		if value != "" {
+			meta[key] = value
+		}
+	}
+	return meta
+}
+
+// recordToolCall pairs the checkpoints around a tool call: a PreToolUse hook
+// starts the call at cp (or the head, if no checkpoint was needed) and the
+// PostToolUse hook with the same tool_use_id finishes it. Other hooks are
+// ignored.
+func recordToolCall(cpManager *cpkg.Manager, hookInput *HookInput, cp *db.Checkpoint) error {
+	if hookInput == nil || hookInput.ToolUseID == "" {
+		return nil
+	}
+	if hookInput.HookEventName != "PreToolUse" && hookInput.HookEventName != "PostToolUse" {
+		return nil
+	}
+
+	if cp == nil {
+		head, err := cpManager.Head()
+		if err != nil || head == nil {
+			return err
+		}
+		cp = head
+	}
+
+	if hookInput.HookEventName == "PreToolUse" {
+		meta := hookMeta(hookInput)
+		input := meta["command"]
+		if input == "" {
+			input = meta["file_path"]
+		}
+		return cpManager.BeginToolCall(&db.ToolCall{
+			ID:        hookInput.ToolUseID,
+			SessionID: hookInput.SessionID,
+			ToolName:  hookInput.ToolName,
+			Input:     input,
+			Before:    cp.Version,
+			StartedAt: time.Now(),
+		})
+	}
+
+	// Without a PreToolUse hook there's no before state to pair with
+	_, err := cpManager.FinishToolCall(hookInput.ToolUseID, cp.Version)
+	return err
+}
+
+// parseMeta parses key=value arguments
+func parseMeta(pairs []string) (map[string]string, error) {
+	meta := make(map[string]string)
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid --meta %q: expected key=value", pair)
+		}
+		if err := cpkg.ValidateMetaKey(key); err != nil {
+			return nil, err
+		}
+		meta[key] = value
+	}
+	return meta, nil
+}
+
+// generateAutoMessage summarizes hook context as a checkpoint message
+func generateAutoMessage(hookInput *HookInput) string {
+	if hookInput == nil {
 		return "auto"
 	}
 
 	// Build message parts
 	var parts []string
 
+	// Changes found before a tool runs aren't the tool's
+	if hookInput.HookEventName == "PreToolUse" {
+		parts = append(parts, "before")
+	}
+
 	// Tool name
 	if hookInput.ToolName != "" {
 		parts = append(parts, hookInput.ToolName)
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	cpkg "github.com/sleexyz/agentfs/internal/checkpoint"
+	"github.com/sleexyz/agentfs/internal/context"
+	"github.com/sleexyz/agentfs/internal/db"
+	"github.com/spf13/cobra"
+)
+
+var cpMountCmd = &cobra.Command{
+	Use:   "mount [<revision> [path]]",
+	Short: "Mount a checkpoint read-only",
+	Long: `Mount a checkpoint read-only at path, so it can be browsed, grepped, or
+tested without touching the working copy. The default path is next to the
+working copy: foo@v3/.
+
+The mount is a clone of the checkpoint and stays until
+'agentfs checkpoint unmount'. (With the dir backend it is a plain copy with
+write permission removed.)
+
+With no arguments, lists the store's checkpoint mounts.
+
+Examples:
+  agentfs checkpoint mount v3              # foo@v3/
+  agentfs checkpoint mount green-tests /tmp/green
+  agentfs checkpoint mount                 # List mounts`,
+	Args: cobra.MaximumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Resolve store
+		storePath, err := context.MustResolveStore(storeFlag, "")
+		if err != nil {
+			exitWithError(ExitUsageError, "%v", err)
+		}
+
+		// Get store info
+		s, err := storeManager.GetFromPath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		if s == nil {
+			exitWithError(ExitStoreNotFound, "store not found")
+		}
+
+		// Open per-store database
+		database, err := db.OpenFromStorePath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "failed to open database: %v", err)
+		}
+		defer database.Close()
+
+		cpManager := cpkg.NewManager(storeManager, database, s)
+
+		if len(args) == 0 {
+			listMounts(cpManager)
+			return
+		}
+
+		lock := lockStore(storePath, false)
+		defer lock.Unlock()
+
+		version := resolveRevision(database, args[0])
+		var path string
+		if len(args) > 1 {
+			path = args[1]
+		}
+
+		mount, err := cpManager.Mount(version, path)
+		if err != nil {
+			exitWithError(ExitMountFailed, "%v", err)
+		}
+
+		if jsonFlag {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(newMountJSON(mount))
+			return
+		}
+
+		fmt.Printf("Mounted v%d read-only at %s\n", mount.Version, mount.Path)
+	},
+}
+
+var cpUnmountCmd = &cobra.Command{
+	Use:   "unmount [<revision>|<path>...]",
+	Short: "Unmount checkpoint mounts",
+	Long: `Unmount checkpoints mounted with 'agentfs checkpoint mount', by mount path
+or by revision (every mount of it). With no arguments, unmounts all of the
+store's checkpoint mounts.
+
+Examples:
+  agentfs checkpoint unmount v3
+  agentfs checkpoint unmount /tmp/green
+  agentfs checkpoint unmount               # All mounts`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Resolve store
+		storePath, err := context.MustResolveStore(storeFlag, "")
+		if err != nil {
+			exitWithError(ExitUsageError, "%v", err)
+		}
+
+		// Get store info
+		s, err := storeManager.GetFromPath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		if s == nil {
+			exitWithError(ExitStoreNotFound, "store not found")
+		}
+
+		// Open per-store database
+		database, err := db.OpenFromStorePath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "failed to open database: %v", err)
+		}
+		defer database.Close()
+
+		cpManager := cpkg.NewManager(storeManager, database, s)
+
+		mounts, err := cpManager.ListMounts()
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		if len(args) > 0 {
+			mounts = selectMounts(database, mounts, args)
+		}
+		if len(mounts) == 0 {
+			fmt.Println("No checkpoints mounted")
+			return
+		}
+
+		lock := lockStore(storePath, false)
+		defer lock.Unlock()
+
+		for _, mount := range mounts {
+			if err := cpManager.Unmount(mount); err != nil {
+				exitWithError(ExitMountFailed, "%v", err)
+			}
+			fmt.Printf("Unmounted v%d from %s\n", mount.Version, mount.Path)
+		}
+	},
+}
+
+type mountJSON struct {
+	Version   string `json:"version"`
+	Path      string `json:"path"`
+	CreatedAt string `json:"created_at"`
+}
+
+func newMountJSON(mount *db.Mount) mountJSON {
+	return mountJSON{
+		Version:   fmt.Sprintf("v%d", mount.Version),
+		Path:      mount.Path,
+		CreatedAt: mount.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// listMounts prints the store's checkpoint mounts
+func listMounts(cpManager *cpkg.Manager) {
+	mounts, err := cpManager.ListMounts()
+	if err != nil {
+		exitWithError(ExitError, "%v", err)
+	}
+
+	if jsonFlag {
+		output := []mountJSON{}
+		for _, mount := range mounts {
+			output = append(output, newMountJSON(mount))
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(output)
+		return
+	}
+
+	if len(mounts) == 0 {
+		fmt.Println("No checkpoints mounted")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tPATH\tMOUNTED")
+	for _, mount := range mounts {
+		fmt.Fprintf(w, "v%d\t%s\t%s\n", mount.Version, mount.Path, humanize.Time(mount.CreatedAt))
+	}
+	w.Flush()
+}
+
+// selectMounts returns the mounts named by args, each a mount path or a
+// revision, exiting if one names no mount
+func selectMounts(database *db.DB, mounts []*db.Mount, args []string) []*db.Mount {
+	var selected []*db.Mount
+	seen := make(map[string]bool)
+	for _, arg := range args {
+		var matched []*db.Mount
+		if path, err := filepath.Abs(arg); err == nil {
+			for _, mount := range mounts {
+				if mount.Path == path {
+					matched = append(matched, mount)
+				}
+			}
+		}
+		if len(matched) == 0 {
+			version := resolveRevision(database, arg)
+			for _, mount := range mounts {
+				if mount.Version == version {
+					matched = append(matched, mount)
+				}
+			}
+		}
+		if len(matched) == 0 {
+			exitWithError(ExitUsageError, "%s is not mounted", arg)
+		}
+		for _, mount := range matched {
+			if !seen[mount.Path] {
+				seen[mount.Path] = true
+				selected = append(selected, mount)
+			}
+		}
+	}
+	return selected
+}
+
+func init() {
+	checkpointCmd.AddCommand(cpMountCmd)
+	checkpointCmd.AddCommand(cpUnmountCmd)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	cpkg "github.com/sleexyz/agentfs/internal/checkpoint"
+	"github.com/sleexyz/agentfs/internal/context"
+	"github.com/sleexyz/agentfs/internal/db"
+	"github.com/spf13/cobra"
+)
+
+var cherryPickCmd = &cobra.Command{
+	Use:   "cherry-pick <revision>",
+	Short: "Apply the changes of one checkpoint to the working copy",
+	Long: `Replay the changes a checkpoint made, relative to its parent, onto the
+working copy. Useful to keep one good change from an otherwise bad run.
+
+Files the checkpoint added or deleted are added or deleted. Files it
+modified are patched: if the working copy changed them too, the edits are
+combined line by line, with conflict markers where they overlap. Binary
+files changed on both sides keep the working copy's version, and a file
+deleted on one side and changed on the other keeps the changed version;
+both are listed as conflicts. For a merge checkpoint, the changes are taken
+relative to its first parent.
+
+Unsaved changes are saved as a "pre-cherry-pick" checkpoint first, and the
+result is recorded as a new checkpoint. Exits with status 1 if there were
+conflicts.
+
+Examples:
+  agentfs cherry-pick v12
+  agentfs cherry-pick approach-b~2`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Resolve store
+		storePath, err := context.MustResolveStore(storeFlag, "")
+		if err != nil {
+			exitWithError(ExitUsageError, "%v", err)
+		}
+
+		// Get store info
+		s, err := storeManager.GetFromPath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		if s == nil {
+			exitWithError(ExitStoreNotFound, "store not found")
+		}
+
+		// Open per-store database
+		database, err := db.OpenFromStorePath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "failed to open database: %v", err)
+		}
+		defer database.Close()
+
+		// Create checkpoint manager
+		cpManager := cpkg.NewManager(storeManager, database, s)
+
+		lock := lockStore(storePath, false)
+		defer lock.Unlock()
+
+		version := resolveRevision(database, args[0])
+
+		start := time.Now()
+		result, err := cpManager.CherryPick(version)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		duration := time.Since(start)
+
+		if jsonFlag {
+			type conflictJSON struct {
+				Path string `json:"path"`
+				Kind string `json:"kind"`
+			}
+			type cherryPickJSON struct {
+				Version       string         `json:"version"`
+				Parent        string         `json:"parent"`
+				Applied       []string       `json:"applied"`
+				Merged        []string       `json:"merged"`
+				Conflicts     []conflictJSON `json:"conflicts"`
+				PreCherryPick string         `json:"pre_cherry_pick,omitempty"`
+				Checkpoint    string         `json:"checkpoint,omitempty"`
+				DurationMs    int64          `json:"duration_ms"`
+			}
+
+			output := cherryPickJSON{
+				Version:    fmt.Sprintf("v%d", version),
+				Parent:     fmt.Sprintf("v%d", result.Parent),
+				Applied:    append([]string{}, result.Applied...),
+				Merged:     append([]string{}, result.Merged...),
+				Conflicts:  []conflictJSON{},
+				DurationMs: duration.Milliseconds(),
+			}
+			for _, c := range result.Conflicts {
+				output.Conflicts = append(output.Conflicts, conflictJSON{Path: c.Path, Kind: c.Kind})
+			}
+			if result.PreCherryPick != nil {
+				output.PreCherryPick = fmt.Sprintf("v%d", result.PreCherryPick.Version)
+			}
+			if result.Checkpoint != nil {
+				output.Checkpoint = fmt.Sprintf("v%d", result.Checkpoint.Version)
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(output)
+		} else {
+			printCherryPickResult(result, version)
+		}
+
+		if len(result.Conflicts) > 0 {
+			os.Exit(ExitError)
+		}
+	},
+}
+
+// printCherryPickResult prints what a cherry-pick did
+func printCherryPickResult(result *cpkg.CherryPickResult, version int) {
+	if result.PreCherryPick != nil {
+		fmt.Printf("Saved unsaved changes as v%d \"pre-cherry-pick\"\n", result.PreCherryPick.Version)
+	}
+	fmt.Printf("Applying changes of v%d (since v%d)\n", version, result.Parent)
+	printMergedFiles(result.Applied, result.Merged, result.Conflicts)
+
+	if result.Checkpoint == nil {
+		fmt.Println("Changes already present; no checkpoint created")
+	} else if n := len(result.Conflicts); n > 0 {
+		fmt.Printf("Created v%d %q with %d conflict%s; resolve and checkpoint again\n", result.Checkpoint.Version, result.Checkpoint.Message, n, plural(n))
+	} else {
+		fmt.Printf("Created v%d %q\n", result.Checkpoint.Version, result.Checkpoint.Message)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(cherryPickCmd)
+}
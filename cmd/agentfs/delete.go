@@ -5,7 +5,10 @@ import (
 	"os"
 	"path/filepath"
 
+	cpkg "github.com/sleexyz/agentfs/internal/checkpoint"
+	"github.com/sleexyz/agentfs/internal/db"
 	"github.com/sleexyz/agentfs/internal/registry"
+	"github.com/sleexyz/agentfs/internal/store"
 	"github.com/spf13/cobra"
 )
 
@@ -44,8 +47,11 @@ Requires confirmation unless -f/--force is specified.`,
 			return
 		}
 
+		lock := lockStore(s.StorePath, false)
+		defer lock.Unlock()
+
 		// Show progress
-		if storeManager.IsMounted(s.MountPath) {
+		if storeManager.IsMounted(s) {
 			fmt.Println("Unmounting...")
 		}
 
@@ -61,6 +67,9 @@ Requires confirmation unless -f/--force is specified.`,
 			}
 		}
 
+		// Checkpoint mounts live outside the store and would be left behind
+		unmountCheckpoints(s)
+
 		if err := storeManager.Delete(s); err != nil {
 			exitWithError(ExitError, "%v", err)
 		}
@@ -69,6 +78,29 @@ Requires confirmation unless -f/--force is specified.`,
 	},
 }
 
+// unmountCheckpoints unmounts a store's checkpoint mounts, warning about any
+// that fail
+func unmountCheckpoints(s *store.Store) {
+	database, err := db.OpenFromStorePath(s.StorePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to open database: %v\n", err)
+		return
+	}
+	defer database.Close()
+
+	cpManager := cpkg.NewManager(storeManager, database, s)
+	mounts, err := cpManager.ListMounts()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		return
+	}
+	for _, mount := range mounts {
+		if err := cpManager.Unmount(mount); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(deleteCmd)
 }
@@ -7,7 +7,9 @@ import (
 	"strings"
 
 	"github.com/sleexyz/agentfs/internal/context"
+	"github.com/sleexyz/agentfs/internal/db"
 	"github.com/sleexyz/agentfs/internal/diff"
+	"github.com/sleexyz/agentfs/internal/revision"
 	"github.com/spf13/cobra"
 )
 
@@ -17,7 +19,7 @@ var (
 )
 
 var diffCmd = &cobra.Command{
-	Use:   "diff <version> [version2] [-- <path>]",
+	Use:   "diff <revision> [revision2] [-- <path>]",
 	Short: "Show changes between checkpoints",
 	Long: `Show changes between two checkpoints or between a checkpoint and current state.
 
@@ -25,6 +27,8 @@ Usage:
   agentfs diff v3              # Diff v3 vs current state
   agentfs diff v2 v4           # Diff v2 vs v4
   agentfs diff v3 -- src/app.ts  # Show diff of specific file
+  agentfs diff green-tests     # Diff a tagged checkpoint vs current state
+  agentfs diff latest^ latest  # Diff the latest checkpoint against its parent
 
 Flags:
   --stat        Show summary statistics only
@@ -46,11 +50,18 @@ Flags:
 			exitWithError(ExitStoreNotFound, "store not found")
 		}
 
+		// Open per-store database (to resolve tags)
+		database, err := db.OpenFromStorePath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "failed to open database: %v", err)
+		}
+		defer database.Close()
+
 		// Parse args
 		// Cobra strips -- so args could be:
 		// [v1]           -> diff v1 vs current
 		// [v1, v2]       -> diff v1 vs v2
-		// [v1, path]     -> diff v1 vs current, specific file (path doesn't start with v)
+		// [v1, path]     -> diff v1 vs current, specific file (path isn't a version or tag)
 		// [v1, v2, path] -> diff v1 vs v2, specific file
 		var fromVersion, toVersion int
 		var specificPath string
@@ -59,15 +70,12 @@ Flags:
 			exitWithError(ExitUsageError, "at least one version is required")
 		}
 
-		fromVersion, err = parseVersion(args[0])
-		if err != nil {
-			exitWithError(ExitUsageError, "invalid version: %v", err)
-		}
+		fromVersion = resolveRevision(database, args[0])
 
 		if len(args) > 1 {
-			// Try to parse second arg as version
-			v2, err := parseVersion(args[1])
-			if err == nil {
+			// Second arg is a version unless it follows -- or doesn't resolve
+			v2, err := revision.Resolve(database, args[1])
+			if err == nil && cmd.ArgsLenAtDash() != 1 {
 				// It's a version
 				toVersion = v2
 				// Check for path
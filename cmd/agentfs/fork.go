@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	cpkg "github.com/sleexyz/agentfs/internal/checkpoint"
+	"github.com/sleexyz/agentfs/internal/context"
+	"github.com/sleexyz/agentfs/internal/db"
+	"github.com/sleexyz/agentfs/internal/registry"
+	"github.com/spf13/cobra"
+)
+
+var forkCmd = &cobra.Command{
+	Use:   "fork <revision> <name>",
+	Short: "Create a new store from a checkpoint",
+	Long: `Create a new, independent store from a checkpoint of the current one.
+
+The store is created as <name>.fs/ next to the current store and mounted at
+<name>/. Its data is a clone of the checkpoint (instant on APFS and
+reflink-capable filesystems), and its first checkpoint, v1, records where it
+was forked from. Nothing is shared afterwards: checkpoints, restores and
+deletes in either store don't affect the other.
+
+Useful for running several agents from the same known-good state:
+
+  agentfs fork v12 agent-a
+  agentfs fork v12 agent-b`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := strings.TrimSuffix(args[1], ".fs")
+		if name == "" || strings.Contains(name, "/") || strings.Contains(name, "\\") {
+			exitWithError(ExitUsageError, "invalid store name %q", args[1])
+		}
+
+		// Resolve store
+		storePath, err := context.MustResolveStore(storeFlag, "")
+		if err != nil {
+			exitWithError(ExitUsageError, "%v", err)
+		}
+
+		// Get store info
+		s, err := storeManager.GetFromPath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		if s == nil {
+			exitWithError(ExitStoreNotFound, "store not found")
+		}
+
+		// Open per-store database
+		database, err := db.OpenFromStorePath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "failed to open database: %v", err)
+		}
+		defer database.Close()
+
+		// Keep the checkpoint from being deleted while it is resolved and cloned
+		lock := lockStore(storePath, false)
+		defer lock.Unlock()
+
+		version := resolveRevision(database, args[0])
+
+		snapshotPath := filepath.Join(storeManager.GetCheckpointsPath(s), fmt.Sprintf("v%d", version))
+		fork, err := storeManager.Fork(s, snapshotPath, name)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+
+		// The checkpoint's context file points at the original store
+		if err := context.WriteContext(fork.MountPath, fork.StorePath); err != nil {
+			storeManager.Delete(fork)
+			exitWithError(ExitError, "failed to write .agentfs file: %v", err)
+		}
+
+		// Initialize the new store's database
+		forkDB, err := db.OpenFromStorePath(fork.StorePath)
+		if err != nil {
+			storeManager.Delete(fork)
+			exitWithError(ExitError, "failed to create database: %v", err)
+		}
+		defer forkDB.Close()
+
+		if err := forkDB.InitStore(name, fork.SizeBytes); err != nil {
+			storeManager.Delete(fork)
+			exitWithError(ExitError, "failed to initialize store database: %v", err)
+		}
+
+		// The first checkpoint records provenance
+		cp, _, err := cpkg.NewManager(storeManager, forkDB, fork).Create(cpkg.CreateOpts{
+			Message: fmt.Sprintf("fork of %s v%d", s.Name, version),
+			Meta: map[string]string{
+				cpkg.MetaForkedFromStore:   s.StorePath,
+				cpkg.MetaForkedFromVersion: fmt.Sprintf("v%d", version),
+			},
+		})
+		if err != nil {
+			storeManager.Delete(fork)
+			exitWithError(ExitError, "failed to create checkpoint: %v", err)
+		}
+
+		// Register store in global registry
+		reg, err := registry.Open()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to open registry: %v\n", err)
+		} else {
+			defer reg.Close()
+			if err := reg.Register(fork.StorePath, fork.MountPath); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: failed to register store: %v\n", err)
+			}
+		}
+
+		if jsonFlag {
+			type forkJSON struct {
+				Store       string `json:"store"`
+				MountPath   string `json:"mount_path"`
+				Checkpoint  string `json:"checkpoint"`
+				FromStore   string `json:"from_store"`
+				FromVersion string `json:"from_version"`
+			}
+
+			output := forkJSON{
+				Store:       fork.StorePath,
+				MountPath:   fork.MountPath,
+				Checkpoint:  fmt.Sprintf("v%d", cp.Version),
+				FromStore:   s.StorePath,
+				FromVersion: fmt.Sprintf("v%d", version),
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(output)
+			return
+		}
+
+		fmt.Printf("Forked %s v%d into %s/\n", s.Name, version, name+".fs")
+		fmt.Printf("Mounted at %s/\n", fork.MountPath)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(forkCmd)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	cpkg "github.com/sleexyz/agentfs/internal/checkpoint"
+	"github.com/sleexyz/agentfs/internal/context"
+	"github.com/sleexyz/agentfs/internal/db"
+	"github.com/spf13/cobra"
+)
+
+var fsckRepairFlag bool
+var fsckVerifyFlag bool
+
+var fsckCmd = &cobra.Command{
+	Use:   "fsck",
+	Short: "Verify store integrity",
+	Long: `Check a store for inconsistencies between metadata.db, the checkpoint
+directories, the backend's data files and the latest symlink.
+
+Problems found:
+  missing-snapshot    checkpoint recorded but checkpoints/vN is missing
+  orphan-snapshot     checkpoints/vN with no checkpoint record
+  bad-snapshot        snapshot incomplete (e.g. a band or object missing)
+  checksum-mismatch   snapshot band differs from its recorded hash (--verify)
+  stale-latest        latest symlink doesn't point at the newest checkpoint
+  restore-leftover    staging or backup data left by an interrupted restore
+  bad-data            live data damaged (e.g. Info.plist missing)
+  missing-sidecar     checkpoint has no checkpoints/vN.json metadata
+  stale-sidecar       checkpoints/vN.json with no snapshot
+
+With --repair, orphans are re-registered (from their sidecar if present),
+records without a snapshot are dropped, sidecars are rewritten, restore
+leftovers are cleaned up and latest is rebuilt. Damaged
+snapshots are only reported.
+
+With --verify, snapshot bands are re-hashed and compared with the hashes
+recorded in metadata.db; bands with no recorded hash yet have it recorded,
+so later runs can detect corruption.
+
+Exits with status 1 if any problem is left unrepaired.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Resolve store
+		storePath, err := context.MustResolveStore(storeFlag, "")
+		if err != nil {
+			exitWithError(ExitUsageError, "%v", err)
+		}
+
+		// Get store info
+		s, err := storeManager.GetFromPath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		if s == nil {
+			exitWithError(ExitStoreNotFound, "store not found")
+		}
+
+		// Hold the lock even when only checking, so no operation is half done
+		lock := lockStore(storePath, false)
+		defer lock.Unlock()
+
+		// Open per-store database
+		database, err := db.OpenFromStorePath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "failed to open database: %v", err)
+		}
+		defer database.Close()
+
+		cpManager := cpkg.NewManager(storeManager, database, s)
+		report, err := cpManager.Fsck(cpkg.FsckOpts{
+			Verify: fsckVerifyFlag,
+			Repair: fsckRepairFlag,
+		})
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		unrepaired := report.Unrepaired()
+
+		if jsonFlag {
+			type issueJSON struct {
+				Kind     string `json:"kind"`
+				Version  string `json:"version,omitempty"`
+				Path     string `json:"path,omitempty"`
+				Message  string `json:"message"`
+				Repaired bool   `json:"repaired"`
+			}
+			type fsckJSON struct {
+				Store       string      `json:"store"`
+				Checkpoints int         `json:"checkpoints"`
+				Issues      []issueJSON `json:"issues"`
+				Repaired    int         `json:"repaired"`
+				Unrepaired  int         `json:"unrepaired"`
+			}
+
+			output := fsckJSON{
+				Store:       s.Name,
+				Checkpoints: report.Checkpoints,
+				Issues:      []issueJSON{},
+				Repaired:    len(report.Issues) - unrepaired,
+				Unrepaired:  unrepaired,
+			}
+			for _, issue := range report.Issues {
+				ij := issueJSON{
+					Kind:     issue.Kind,
+					Path:     issue.Path,
+					Message:  issue.Message,
+					Repaired: issue.Repaired,
+				}
+				if issue.Version > 0 {
+					ij.Version = fmt.Sprintf("v%d", issue.Version)
+				}
+				output.Issues = append(output.Issues, ij)
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(output)
+		} else {
+			fmt.Printf("Checked %d checkpoints in %s/\n", report.Checkpoints, filepath.Base(s.StorePath))
+			if len(report.Issues) == 0 {
+				fmt.Println("No problems found")
+				return
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			for _, issue := range report.Issues {
+				version := ""
+				if issue.Version > 0 {
+					version = fmt.Sprintf("v%d", issue.Version)
+				}
+				status := ""
+				if issue.Repaired {
+					status = "(repaired)"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", issue.Kind, version, issue.Message, status)
+			}
+			w.Flush()
+
+			fmt.Printf("%d problems, %d repaired\n", len(report.Issues), len(report.Issues)-unrepaired)
+			if unrepaired > 0 && !fsckRepairFlag {
+				fmt.Println("Run 'agentfs fsck --repair' to fix what can be fixed")
+			}
+		}
+
+		if unrepaired > 0 {
+			os.Exit(ExitError)
+		}
+	},
+}
+
+func init() {
+	fsckCmd.Flags().BoolVar(&fsckRepairFlag, "repair", false, "fix problems where possible")
+	fsckCmd.Flags().BoolVar(&fsckVerifyFlag, "verify", false, "re-hash snapshot data against recorded checksums (slow)")
+	rootCmd.AddCommand(fsckCmd)
+}
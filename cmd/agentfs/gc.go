@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	cpkg "github.com/sleexyz/agentfs/internal/checkpoint"
+	"github.com/sleexyz/agentfs/internal/context"
+	"github.com/sleexyz/agentfs/internal/db"
+	"github.com/spf13/cobra"
+)
+
+var gcDryRunFlag bool
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Delete checkpoints outside the retention policy",
+	Long: `Delete the checkpoints the store's retention policy doesn't keep, then
+any stored data no remaining checkpoint references.
+
+A checkpoint is kept if any rule keeps it. Tagged checkpoints, branch heads
+and HEAD are always kept. With no rules set, gc deletes nothing.
+
+Set the rules with 'agentfs gc policy'.
+
+Usage:
+  agentfs gc --dry-run   # Show what would be deleted
+  agentfs gc             # Delete it`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Resolve store
+		storePath, err := context.MustResolveStore(storeFlag, "")
+		if err != nil {
+			exitWithError(ExitUsageError, "%v", err)
+		}
+
+		// Get store info
+		s, err := storeManager.GetFromPath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		if s == nil {
+			exitWithError(ExitStoreNotFound, "store not found")
+		}
+
+		// Open per-store database
+		database, err := db.OpenFromStorePath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "failed to open database: %v", err)
+		}
+		defer database.Close()
+
+		cpManager := cpkg.NewManager(storeManager, database, s)
+
+		policy, err := cpManager.Policy()
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		if !policy.IsSet() && !jsonFlag {
+			fmt.Println("No retention rules set (see 'agentfs gc policy'); nothing to delete.")
+			return
+		}
+
+		lock := lockStore(storePath, false)
+		defer lock.Unlock()
+
+		result, err := cpManager.GC(policy, gcDryRunFlag)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+
+		if jsonFlag {
+			type gcJSON struct {
+				DryRun         bool     `json:"dry_run"`
+				Deleted        []string `json:"deleted"`
+				Kept           int      `json:"kept"`
+				ObjectsPruned  int      `json:"objects_pruned"`
+				ReclaimedBytes int64    `json:"reclaimed_bytes"`
+			}
+
+			output := gcJSON{
+				DryRun:         gcDryRunFlag,
+				Deleted:        []string{},
+				Kept:           result.Kept,
+				ObjectsPruned:  result.Objects,
+				ReclaimedBytes: result.Reclaimed,
+			}
+			for _, cp := range result.Deleted {
+				output.Deleted = append(output.Deleted, fmt.Sprintf("v%d", cp.Version))
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(output)
+			return
+		}
+
+		verb := "Deleted"
+		if gcDryRunFlag {
+			verb = "Would delete"
+		}
+		for _, cp := range result.Deleted {
+			line := fmt.Sprintf("%s v%d", verb, cp.Version)
+			if cp.Message != "" {
+				line += fmt.Sprintf(" %q", cp.Message)
+			}
+			fmt.Printf("%s (%s)\n", line, humanize.Time(cp.CreatedAt))
+		}
+		fmt.Println(gcSummary(result, gcDryRunFlag))
+	},
+}
+
+var (
+	policyKeepLastFlag   int
+	policyKeepHourlyFlag int
+	policyKeepDailyFlag  int
+	policyAutoFlag       bool
+	policyClearFlag      bool
+)
+
+var gcPolicyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Show or set the retention policy",
+	Long: `Show or set the rules gc uses to decide which checkpoints to keep.
+The rules are stored in the store's metadata.db.
+
+Usage:
+  agentfs gc policy                                 # Show the rules
+  agentfs gc policy --keep-last 50                  # Keep the newest 50 checkpoints
+  agentfs gc policy --keep-hourly 24 --keep-daily 30
+  agentfs gc policy --auto                          # Run gc after each checkpoint create
+  agentfs gc policy --clear                         # Remove all rules
+
+Set a rule to 0 to remove it.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Resolve store
+		storePath, err := context.MustResolveStore(storeFlag, "")
+		if err != nil {
+			exitWithError(ExitUsageError, "%v", err)
+		}
+
+		// Get store info
+		s, err := storeManager.GetFromPath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		if s == nil {
+			exitWithError(ExitStoreNotFound, "store not found")
+		}
+
+		// Open per-store database
+		database, err := db.OpenFromStorePath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "failed to open database: %v", err)
+		}
+		defer database.Close()
+
+		cpManager := cpkg.NewManager(storeManager, database, s)
+
+		policy, err := cpManager.Policy()
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+
+		flags := cmd.Flags()
+		changed := policyClearFlag
+		if policyClearFlag {
+			policy = cpkg.Policy{}
+		}
+		if flags.Changed("keep-last") {
+			policy.KeepLast, changed = policyKeepLastFlag, true
+		}
+		if flags.Changed("keep-hourly") {
+			policy.KeepHourly, changed = policyKeepHourlyFlag, true
+		}
+		if flags.Changed("keep-daily") {
+			policy.KeepDaily, changed = policyKeepDailyFlag, true
+		}
+		if flags.Changed("auto") {
+			policy.Auto, changed = policyAutoFlag, true
+		}
+		if policy.KeepLast < 0 || policy.KeepHourly < 0 || policy.KeepDaily < 0 {
+			exitWithError(ExitUsageError, "retention rules can't be negative")
+		}
+
+		if changed {
+			lock := lockStore(storePath, false)
+			defer lock.Unlock()
+
+			if err := cpManager.SetPolicy(policy); err != nil {
+				exitWithError(ExitError, "%v", err)
+			}
+		}
+
+		if jsonFlag {
+			type policyJSON struct {
+				KeepLast   int  `json:"keep_last"`
+				KeepHourly int  `json:"keep_hourly"`
+				KeepDaily  int  `json:"keep_daily"`
+				Auto       bool `json:"auto"`
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(policyJSON{
+				KeepLast:   policy.KeepLast,
+				KeepHourly: policy.KeepHourly,
+				KeepDaily:  policy.KeepDaily,
+				Auto:       policy.Auto,
+			})
+			return
+		}
+
+		if !policy.IsSet() {
+			fmt.Println("No retention rules set: gc keeps every checkpoint.")
+			return
+		}
+		fmt.Println("Keep:")
+		if policy.KeepLast > 0 {
+			fmt.Printf("  the newest %d checkpoints\n", policy.KeepLast)
+		}
+		if policy.KeepHourly > 0 {
+			fmt.Printf("  one checkpoint per hour for %d hours\n", policy.KeepHourly)
+		}
+		if policy.KeepDaily > 0 {
+			fmt.Printf("  one checkpoint per day for %d days\n", policy.KeepDaily)
+		}
+		fmt.Println("  tagged checkpoints, branch heads and HEAD")
+		if policy.Auto {
+			fmt.Println("gc runs after each checkpoint create.")
+		}
+	},
+}
+
+// autoGC applies the retention policy after a checkpoint if the store asks
+// for it, returning a summary of what was deleted ("" if nothing was)
+func autoGC(cpManager *cpkg.Manager) (string, error) {
+	policy, err := cpManager.Policy()
+	if err != nil || !policy.Auto || !policy.IsSet() {
+		return "", err
+	}
+	result, err := cpManager.GC(policy, false)
+	if err != nil {
+		return "", err
+	}
+	if len(result.Deleted) == 0 && result.Objects == 0 {
+		return "", nil
+	}
+	return gcSummary(result, false), nil
+}
+
+// gcSummary describes a gc result in one line
+func gcSummary(result *cpkg.GCResult, dryRun bool) string {
+	var parts []string
+	verb := "Deleted"
+	if dryRun {
+		verb = "Would delete"
+	}
+	parts = append(parts, fmt.Sprintf("%s %d checkpoint%s, kept %d", verb, len(result.Deleted), plural(len(result.Deleted)), result.Kept))
+	if result.Objects > 0 {
+		parts = append(parts, fmt.Sprintf("%d unreferenced object%s", result.Objects, plural(result.Objects)))
+	}
+	reclaimed := "reclaimed"
+	if dryRun {
+		reclaimed = "would reclaim"
+	}
+	parts = append(parts, fmt.Sprintf("%s %s", reclaimed, humanize.IBytes(uint64(result.Reclaimed))))
+	return strings.Join(parts, "; ")
+}
+
+// plural returns "s" unless n is 1
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+func init() {
+	gcCmd.Flags().BoolVar(&gcDryRunFlag, "dry-run", false, "show what would be deleted without deleting it")
+	gcPolicyCmd.Flags().IntVar(&policyKeepLastFlag, "keep-last", 0, "keep the newest N checkpoints")
+	gcPolicyCmd.Flags().IntVar(&policyKeepHourlyFlag, "keep-hourly", 0, "keep one checkpoint per hour for the last N hours")
+	gcPolicyCmd.Flags().IntVar(&policyKeepDailyFlag, "keep-daily", 0, "keep one checkpoint per day for the last N days")
+	gcPolicyCmd.Flags().BoolVar(&policyAutoFlag, "auto", false, "run gc after each checkpoint create (--auto=false to stop)")
+	gcPolicyCmd.Flags().BoolVar(&policyClearFlag, "clear", false, "remove all rules")
+	gcCmd.AddCommand(gcPolicyCmd)
+	rootCmd.AddCommand(gcCmd)
+}
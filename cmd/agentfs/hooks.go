@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sleexyz/agentfs/internal/context"
+	"github.com/sleexyz/agentfs/internal/hooks"
+	"github.com/spf13/cobra"
+)
+
+var (
+	hooksProjectFlag bool
+	hooksUserFlag    bool
+	hooksEventsFlag  []string
+)
+
+var hooksCmd = &cobra.Command{
+	Use:   "hooks",
+	Short: "Manage Claude Code auto-checkpoint hooks",
+	Long: `Install, inspect, and remove the Claude Code hooks that run
+'agentfs checkpoint create --auto --from-hook'.
+
+Hooks go in the user's settings (~/.claude/settings.json, the default) or,
+with --project, the current store's .claude/settings.json. Other settings
+and hooks in the file are left as they are.
+
+Commands:
+  install    Add agentfs hooks
+  uninstall  Remove the hooks agentfs added
+  status     Show which hooks are installed`,
+}
+
+var hooksInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Add agentfs hooks to Claude Code settings",
+	Long: `Add agentfs hooks to Claude Code settings for each event in --events.
+
+  Stop, SubagentStop        checkpoint at the end of each turn (in the background)
+  PreToolUse, PostToolUse   checkpoint around each file-changing tool call, so
+                            'agentfs why' can attribute changes to tool calls
+
+Events that already have the agentfs hook are skipped.
+
+Usage:
+  agentfs hooks install                                  # Stop, user settings
+  agentfs hooks install --project --events PreToolUse,PostToolUse`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, event := range hooksEventsFlag {
+			if !hooks.IsEvent(event) {
+				exitWithError(ExitUsageError, "unknown hook event %q (use %s)", event, strings.Join(hooks.Events, ", "))
+			}
+		}
+
+		settings, err := hooks.Load(hooksSettingsPath())
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+
+		var added, present []string
+		for _, event := range hooksEventsFlag {
+			ok, err := settings.Install(event)
+			if err != nil {
+				exitWithError(ExitError, "%v", err)
+			}
+			if ok {
+				added = append(added, event)
+			} else {
+				present = append(present, event)
+			}
+		}
+
+		if len(added) > 0 {
+			if err := settings.Save(); err != nil {
+				exitWithError(ExitError, "%v", err)
+			}
+			fmt.Printf("Installed agentfs hooks for %s in %s\n", strings.Join(added, ", "), settings.Path)
+		}
+		if len(present) > 0 {
+			fmt.Printf("Already installed for %s in %s\n", strings.Join(present, ", "), settings.Path)
+		}
+	},
+}
+
+var hooksUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Remove agentfs hooks from Claude Code settings",
+	Long: `Remove the hooks 'agentfs hooks install' added: entries whose command is
+exactly agentfs's hook command. Other hooks are kept.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		settings, err := hooks.Load(hooksSettingsPath())
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+
+		removed, err := settings.Uninstall()
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		if len(removed) == 0 {
+			fmt.Printf("No agentfs hooks installed in %s\n", settings.Path)
+			return
+		}
+
+		if err := settings.Save(); err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		fmt.Printf("Removed agentfs hooks for %s from %s\n", strings.Join(removed, ", "), settings.Path)
+	},
+}
+
+var hooksStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show installed agentfs hooks",
+	Long: `Show the events agentfs hooks are installed for, in the user's settings
+and (inside a store) the store's project settings.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		type scope struct {
+			Scope  string   `json:"scope"`
+			Path   string   `json:"path"`
+			Events []string `json:"events"`
+		}
+
+		userPath, err := hooks.UserPath()
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		scopes := []scope{{Scope: "user", Path: userPath}}
+		if mountPath := currentMountPath(); mountPath != "" {
+			scopes = append(scopes, scope{Scope: "project", Path: hooks.ProjectPath(mountPath)})
+		}
+
+		for i := range scopes {
+			settings, err := hooks.Load(scopes[i].Path)
+			if err != nil {
+				exitWithError(ExitError, "%v", err)
+			}
+			if scopes[i].Events, err = settings.Installed(); err != nil {
+				exitWithError(ExitError, "%v", err)
+			}
+			if scopes[i].Events == nil {
+				scopes[i].Events = []string{}
+			}
+		}
+
+		if jsonFlag {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(scopes)
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SCOPE\tSETTINGS\tEVENTS")
+		for _, s := range scopes {
+			events := strings.Join(s.Events, ", ")
+			if events == "" {
+				events = "not installed"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", s.Scope, s.Path, events)
+		}
+		w.Flush()
+	},
+}
+
+// hooksSettingsPath returns the settings file --project or --user selects
+func hooksSettingsPath() string {
+	if hooksProjectFlag && hooksUserFlag {
+		exitWithError(ExitUsageError, "--project and --user can't be used together")
+	}
+	if !hooksProjectFlag {
+		path, err := hooks.UserPath()
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		return path
+	}
+
+	mountPath := currentMountPath()
+	if mountPath == "" {
+		exitWithError(ExitUsageError, "--project needs a store: use --store or run from a store directory")
+	}
+	return hooks.ProjectPath(mountPath)
+}
+
+// currentMountPath returns the working copy of the current store, or "" if
+// there is none
+func currentMountPath() string {
+	storePath, err := context.ResolveStore(storeFlag, "")
+	if err != nil || storePath == "" {
+		return ""
+	}
+	s, err := storeManager.GetFromPath(storePath)
+	if err != nil || s == nil {
+		return ""
+	}
+	return s.MountPath
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{hooksInstallCmd, hooksUninstallCmd} {
+		cmd.Flags().BoolVar(&hooksProjectFlag, "project", false, "use the current store's .claude/settings.json")
+		cmd.Flags().BoolVar(&hooksUserFlag, "user", false, "use ~/.claude/settings.json (default)")
+	}
+	hooksInstallCmd.Flags().StringSliceVar(&hooksEventsFlag, "events", []string{"Stop"}, "hook events to install for (Stop, SubagentStop, PreToolUse, PostToolUse)")
+
+	hooksCmd.AddCommand(hooksInstallCmd)
+	hooksCmd.AddCommand(hooksUninstallCmd)
+	hooksCmd.AddCommand(hooksStatusCmd)
+	rootCmd.AddCommand(hooksCmd)
+}
@@ -13,13 +13,17 @@ import (
 )
 
 var (
-	initSize string
+	initSize    string
+	initBackend string
 )
 
 var initCmd = &cobra.Command{
 	Use:   "init [name]",
 	Short: "Create and mount a new store",
-	Long: `Create a new sparse bundle store and mount it.
+	Long: `Create a new store and mount it.
+
+The backend is the platform's default (sparsebundle on macOS, loop on Linux
+as root, dir otherwise), or the one named by --backend or $AGENTFS_BACKEND.
 
 The store will be created as <name>.fs/ in the current directory
 and mounted at ./<name>/.
@@ -56,7 +60,8 @@ If no name is provided, you will be prompted for one.`,
 		}
 
 		opts := store.CreateOpts{
-			Size: initSize,
+			Size:    initSize,
+			Backend: initBackend,
 		}
 
 		s, err := storeManager.Create(name, opts)
@@ -96,6 +101,7 @@ If no name is provided, you will be prompted for one.`,
 }
 
 func init() {
-	initCmd.Flags().StringVar(&initSize, "size", "50G", "size of the sparse bundle")
+	initCmd.Flags().StringVar(&initSize, "size", "50G", "size of the store's volume (sparsebundle and loop backends)")
+	initCmd.Flags().StringVar(&initBackend, "backend", "", "storage backend (default: platform default or $AGENTFS_BACKEND)")
 	rootCmd.AddCommand(initCmd)
 }
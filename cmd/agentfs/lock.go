@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	cpkg "github.com/sleexyz/agentfs/internal/checkpoint"
+	"github.com/sleexyz/agentfs/internal/db"
+	"github.com/sleexyz/agentfs/internal/store"
+)
+
+// lockStore takes the store lock for a mutating command. By default it waits
+// for other agentfs processes; with --no-wait it exits with ExitLocked, or
+// silently skips in auto mode. Once locked, operations left unfinished by a
+// crashed process are recovered. The lock is released when the process exits.
+func lockStore(storePath string, auto bool) *store.Lock {
+	lock, err := store.TryLock(storePath)
+	if errors.Is(err, store.ErrLocked) && !noWait {
+		if !auto {
+			fmt.Fprintf(os.Stderr, "Waiting for lock: %v\n", err)
+		}
+		lock, err = store.WaitLock(storePath)
+	}
+	if errors.Is(err, store.ErrLocked) {
+		if auto {
+			os.Exit(0) // Another process is already working on the store - skip
+		}
+		exitWithError(ExitLocked, "%v", err)
+	}
+	if err != nil {
+		exitWithError(ExitError, "%v", err)
+	}
+
+	recoverStore(storePath)
+	return lock
+}
+
+// lockStores takes the locks of several stores, as lockStore does, in a fixed
+// order (by path) so two commands locking the same stores can't deadlock
+func lockStores(storePaths ...string) []*store.Lock {
+	sorted := append([]string{}, storePaths...)
+	sort.Strings(sorted)
+	var locks []*store.Lock
+	for _, path := range sorted {
+		locks = append(locks, lockStore(path, false))
+	}
+	return locks
+}
+
+// recoverStore completes or rolls back operations interrupted by a crashed
+// agentfs process and reports what it did on stderr
+func recoverStore(storePath string) {
+	s, err := storeManager.GetFromPath(storePath)
+	if err != nil || s == nil {
+		return
+	}
+
+	database, err := db.OpenFromStorePath(storePath)
+	if err != nil {
+		return
+	}
+	defer database.Close()
+
+	recovered, err := cpkg.NewManager(storeManager, database, s).Recover()
+	for _, msg := range recovered {
+		fmt.Fprintf(os.Stderr, "Recovered: %s\n", msg)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+}
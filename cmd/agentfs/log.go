@@ -0,0 +1,454 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	cpkg "github.com/sleexyz/agentfs/internal/checkpoint"
+	"github.com/sleexyz/agentfs/internal/context"
+	"github.com/sleexyz/agentfs/internal/db"
+	"github.com/sleexyz/agentfs/internal/diff"
+	"github.com/sleexyz/agentfs/internal/revision"
+	"github.com/spf13/cobra"
+)
+
+var (
+	logGraphFlag   bool
+	logStatFlag    bool
+	logSinceFlag   string
+	logSessionFlag string
+	logMetaFlags   []string
+	logLimitFlag   int
+)
+
+var logCmd = &cobra.Command{
+	Use:   "log",
+	Short: "Show checkpoint history",
+	Long: `Show checkpoints newest first, with the branches and tags that point at them.
+
+With --graph, the parent of each checkpoint is drawn like 'git log --graph',
+so forks (restores, branches) and merges are visible:
+
+  * v5 (HEAD -> main) refactor auth
+  | * v4 (approach-b) try a different schema
+  | * v3 (restore point) pre-switch
+  * | v2 add login form
+  |/
+  * v1 base
+
+HEAD marks the checkpoint the working copy continues from. Restore points are
+the checkpoints saved automatically before a restore, switch, merge or
+cherry-pick.
+
+Usage:
+  agentfs log --graph              # Draw the checkpoint graph
+  agentfs log --stat               # Show +added ~modified -deleted files per checkpoint
+  agentfs log --since "2 hours ago"
+  agentfs log --session f55a4d56   # Checkpoints from one agent session
+  agentfs log --meta tool_name=Bash`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		filters, err := parseMeta(logMetaFlags)
+		if err != nil {
+			exitWithError(ExitUsageError, "%v", err)
+		}
+
+		// Resolve store
+		storePath, err := context.MustResolveStore(storeFlag, "")
+		if err != nil {
+			exitWithError(ExitUsageError, "%v", err)
+		}
+
+		// Get store info
+		s, err := storeManager.GetFromPath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		if s == nil {
+			exitWithError(ExitStoreNotFound, "store not found")
+		}
+
+		// Open per-store database
+		database, err := db.OpenFromStorePath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "failed to open database: %v", err)
+		}
+		defer database.Close()
+
+		cpManager := cpkg.NewManager(storeManager, database, s)
+
+		var since time.Time
+		if logSinceFlag != "" {
+			since, err = revision.ParseTime(logSinceFlag, time.Now())
+			if err != nil {
+				exitWithError(ExitUsageError, "invalid --since: %v", err)
+			}
+		}
+
+		all, err := cpManager.List(0)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		meta, err := cpManager.ListMeta()
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		var matches map[int]bool
+		if len(filters) > 0 {
+			if matches, err = cpManager.FindByMeta(filters); err != nil {
+				exitWithError(ExitError, "%v", err)
+			}
+		}
+		byVersion := make(map[int]*db.Checkpoint, len(all))
+		for _, cp := range all {
+			byVersion[cp.Version] = cp
+		}
+
+		// Filter, newest first
+		var shown []*db.Checkpoint
+		for _, cp := range all {
+			if !since.IsZero() && cp.CreatedAt.Before(since) {
+				continue
+			}
+			if logSessionFlag != "" && !inSession(cp, meta[cp.Version], logSessionFlag) {
+				continue
+			}
+			if matches != nil && !matches[cp.Version] {
+				continue
+			}
+			shown = append(shown, cp)
+			if logLimitFlag > 0 && len(shown) == logLimitFlag {
+				break
+			}
+		}
+		isShown := make(map[int]bool, len(shown))
+		for _, cp := range shown {
+			isShown[cp.Version] = true
+		}
+
+		refs := logRefs(cpManager)
+
+		// Change summaries against each checkpoint's parent
+		stats := make(map[int]*logStat)
+		if logStatFlag {
+			differ := diff.NewDiffer(storeManager, s)
+			for _, cp := range shown {
+				if cp.ParentVersion == nil || byVersion[*cp.ParentVersion] == nil {
+					continue
+				}
+				result, err := differ.Diff(*cp.ParentVersion, cp.Version)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "warning: failed to diff v%d: %v\n", cp.Version, err)
+					continue
+				}
+				added, modified, deleted := result.Summary()
+				stats[cp.Version] = &logStat{Added: added, Modified: modified, Deleted: deleted}
+			}
+		}
+
+		if jsonFlag {
+			type logJSON struct {
+				Version       string            `json:"version"`
+				Message       string            `json:"message,omitempty"`
+				CreatedAt     string            `json:"created_at"`
+				ParentVersion *int              `json:"parent_version"`
+				MergeParent   *int              `json:"merge_parent,omitempty"`
+				Branch        string            `json:"branch,omitempty"`
+				Head          bool              `json:"head"`
+				Branches      []string          `json:"branches,omitempty"`
+				Tags          []string          `json:"tags,omitempty"`
+				RestorePoint  bool              `json:"restore_point"`
+				Changes       *logStat          `json:"changes,omitempty"`
+				Meta          map[string]string `json:"meta,omitempty"`
+			}
+
+			output := []logJSON{}
+			for _, cp := range shown {
+				output = append(output, logJSON{
+					Version:       fmt.Sprintf("v%d", cp.Version),
+					Message:       cp.Message,
+					CreatedAt:     cp.CreatedAt.Format(time.RFC3339),
+					ParentVersion: cp.ParentVersion,
+					MergeParent:   cp.MergeParent,
+					Branch:        cp.Branch,
+					Head:          cp.Version == refs.head,
+					Branches:      refs.branches[cp.Version],
+					Tags:          refs.tags[cp.Version],
+					RestorePoint:  isRestorePoint(cp),
+					Changes:       stats[cp.Version],
+					Meta:          meta[cp.Version],
+				})
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(output)
+			return
+		}
+
+		if len(shown) == 0 {
+			fmt.Println("No checkpoints found.")
+			return
+		}
+
+		g := &graph{}
+		for _, cp := range shown {
+			line := fmt.Sprintf("v%d", cp.Version)
+			if decorations := refs.decorate(cp); decorations != "" {
+				line += " (" + decorations + ")"
+			}
+			if cp.Message != "" {
+				line += " " + cp.Message
+			}
+			if st := stats[cp.Version]; st != nil {
+				line += fmt.Sprintf("  +%d ~%d -%d", st.Added, st.Modified, st.Deleted)
+			}
+			line += fmt.Sprintf("  (%s)", humanize.Time(cp.CreatedAt))
+
+			if !logGraphFlag {
+				fmt.Println(line)
+				continue
+			}
+
+			// Connect to the nearest shown ancestors, skipping filtered-out checkpoints
+			nearestShown := func(p *int) int {
+				for ; p != nil && byVersion[*p] != nil; p = byVersion[*p].ParentVersion {
+					if isShown[*p] {
+						return *p
+					}
+				}
+				return 0
+			}
+			parent := nearestShown(cp.ParentVersion)
+			mergeParent := nearestShown(cp.MergeParent)
+			if mergeParent == parent {
+				mergeParent = 0
+			}
+			joins, row, split := g.add(cp.Version, parent, mergeParent)
+			for _, j := range joins {
+				fmt.Println(j)
+			}
+			fmt.Println(row + " " + line)
+			if split != "" {
+				fmt.Println(split)
+			}
+		}
+	},
+}
+
+// logStat counts the files a checkpoint changed relative to its parent
+type logStat struct {
+	Added    int `json:"added"`
+	Modified int `json:"modified"`
+	Deleted  int `json:"deleted"`
+}
+
+// refs holds the names pointing at checkpoints
+type refs struct {
+	head     int    // Version the working copy continues from
+	current  string // Current branch
+	branches map[int][]string
+	tags     map[int][]string
+}
+
+// logRefs collects the branch heads and tags of a store
+func logRefs(cpManager *cpkg.Manager) *refs {
+	r := &refs{branches: make(map[int][]string), tags: make(map[int][]string)}
+
+	if head, err := cpManager.Head(); err == nil && head != nil {
+		r.head = head.Version
+	}
+	r.current, _ = cpManager.CurrentBranch()
+	if branches, err := cpManager.ListBranches(); err == nil {
+		for _, b := range branches {
+			if b.HeadVersion != nil {
+				r.branches[*b.HeadVersion] = append(r.branches[*b.HeadVersion], b.Name)
+			}
+		}
+	}
+	if tags, err := cpManager.ListTags(); err == nil {
+		for _, t := range tags {
+			r.tags[t.Version] = append(r.tags[t.Version], t.Name)
+		}
+	}
+	return r
+}
+
+// decorate lists what points at a checkpoint, like git's "HEAD -> main, tag: v1"
+func (r *refs) decorate(cp *db.Checkpoint) string {
+	var parts []string
+	for _, name := range r.branches[cp.Version] {
+		if name == r.current && cp.Version == r.head {
+			parts = append([]string{"HEAD -> " + name}, parts...)
+		} else {
+			parts = append(parts, name)
+		}
+	}
+	if cp.Version == r.head && (len(parts) == 0 || !strings.HasPrefix(parts[0], "HEAD")) {
+		parts = append([]string{"HEAD"}, parts...)
+	}
+	for _, name := range r.tags[cp.Version] {
+		parts = append(parts, "tag: "+name)
+	}
+	if isRestorePoint(cp) {
+		parts = append(parts, "restore point")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// isRestorePoint reports whether a checkpoint was saved automatically before
+// a restore, switch, merge or cherry-pick
+func isRestorePoint(cp *db.Checkpoint) bool {
+	switch cp.Message {
+	case "pre-restore", "pre-switch", "pre-merge", "pre-cherry-pick":
+		return true
+	}
+	return false
+}
+
+// inSession reports whether an auto checkpoint was created by the given agent
+// session (or one whose ID starts with it). Checkpoints without a recorded
+// session_id are matched by their --from-hook message, which ends with the
+// short session ID: "Edit main.go (f55a4d56)".
+func inSession(cp *db.Checkpoint, meta map[string]string, sessionID string) bool {
+	if id := meta["session_id"]; id != "" {
+		return strings.HasPrefix(id, sessionID)
+	}
+	if len(sessionID) > 8 {
+		sessionID = sessionID[:8]
+	}
+	return strings.HasSuffix(cp.Message, "("+sessionID+")")
+}
+
+// graph lays out checkpoints newest first in lanes, like git log --graph.
+// Each lane waits for the version of the next checkpoint drawn in it.
+type graph struct {
+	lanes []int // 0: free
+}
+
+// add places a checkpoint whose parent (0 if none is drawn) continues its
+// lane; a merge's second parent (0 if none) gets a new lane to its right.
+// It returns the lines joining other lanes into it, its row, and the line
+// splitting off the second parent's lane ("" if none).
+func (g *graph) add(version, parent, mergeParent int) ([]string, string, string) {
+	col := -1
+	var joins []int
+	for i, v := range g.lanes {
+		if v != version {
+			continue
+		}
+		if col < 0 {
+			col = i
+		} else {
+			joins = append(joins, i)
+		}
+	}
+
+	// Siblings' lanes merge into the first one, rightmost first
+	var lines []string
+	for k := len(joins) - 1; k >= 0; k-- {
+		lines = append(lines, g.join(col, joins[k]))
+		g.lanes = append(g.lanes[:joins[k]], g.lanes[joins[k]+1:]...)
+	}
+
+	if col < 0 {
+		col = g.free()
+	}
+	row := g.row(col)
+
+	g.lanes[col] = parent
+	split := ""
+	if mergeParent != 0 {
+		split = g.split(col)
+		g.lanes = append(g.lanes[:col+1], append([]int{mergeParent}, g.lanes[col+1:]...)...)
+	}
+	for len(g.lanes) > 0 && g.lanes[len(g.lanes)-1] == 0 {
+		g.lanes = g.lanes[:len(g.lanes)-1]
+	}
+	return lines, row, split
+}
+
+// split draws a new lane branching right from lane col, e.g. "|\" or
+// "| |\ \". Lanes right of col shift right to make room.
+func (g *graph) split(col int) string {
+	buf := []byte(strings.Repeat(" ", 2*len(g.lanes)+1))
+	for i := 0; i <= col; i++ {
+		if g.lanes[i] != 0 || i == col {
+			buf[2*i] = '|'
+		}
+	}
+	buf[2*col+1] = '\\'
+	for i := col + 1; i < len(g.lanes); i++ {
+		if g.lanes[i] != 0 {
+			buf[2*i+1] = '\\'
+		}
+	}
+	return strings.TrimRight(string(buf), " ")
+}
+
+// free returns the first free lane, adding one if needed
+func (g *graph) free() int {
+	for i, v := range g.lanes {
+		if v == 0 {
+			return i
+		}
+	}
+	g.lanes = append(g.lanes, 0)
+	return len(g.lanes) - 1
+}
+
+// join draws lane j merging left into lane col, e.g. "|/" or "|_|/". Lanes
+// right of j shift left with it.
+func (g *graph) join(col, j int) string {
+	buf := []byte(strings.Repeat(" ", 2*len(g.lanes)-1))
+	for i := 0; i < j; i++ {
+		if g.lanes[i] != 0 {
+			buf[2*i] = '|'
+		} else if i > col {
+			buf[2*i] = '_'
+		}
+	}
+	for i := col; i < j-1; i++ {
+		buf[2*i+1] = '_'
+	}
+	buf[2*j-1] = '/'
+	for i := j + 1; i < len(g.lanes); i++ {
+		if g.lanes[i] != 0 {
+			buf[2*i-1] = '/'
+		}
+	}
+	return strings.TrimRight(string(buf), " ")
+}
+
+// row draws the lanes with the checkpoint's node in lane col
+func (g *graph) row(col int) string {
+	var b strings.Builder
+	for i, v := range g.lanes {
+		switch {
+		case i == col:
+			b.WriteByte('*')
+		case v != 0:
+			b.WriteByte('|')
+		default:
+			b.WriteByte(' ')
+		}
+		if i < len(g.lanes)-1 {
+			b.WriteByte(' ')
+		}
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
+func init() {
+	logCmd.Flags().BoolVar(&logGraphFlag, "graph", false, "draw the checkpoint graph")
+	logCmd.Flags().BoolVar(&logStatFlag, "stat", false, "show files added, modified and deleted by each checkpoint")
+	logCmd.Flags().StringVar(&logSinceFlag, "since", "", "only checkpoints created since a time (e.g., \"2 hours ago\", \"2024-03-01\")")
+	logCmd.Flags().StringVar(&logSessionFlag, "session", "", "only checkpoints from an agent session (--from-hook; ID or prefix)")
+	logCmd.Flags().StringArrayVar(&logMetaFlags, "meta", nil, "only checkpoints with this metadata (key=value, value may be a glob; repeatable)")
+	logCmd.Flags().IntVarP(&logLimitFlag, "max-count", "n", 0, "show at most this many checkpoints")
+	rootCmd.AddCommand(logCmd)
+}
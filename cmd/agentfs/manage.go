@@ -17,6 +17,7 @@ import (
 
 var (
 	manageCleanup bool
+	manageBackend string
 )
 
 var manageCmd = &cobra.Command{
@@ -108,45 +109,27 @@ func runManage(dirPath string) {
 	// === CREATE STORE ===
 	fmt.Printf("Creating store %s...\n", name+".fs")
 
-	// Create store directory structure
-	if err := os.MkdirAll(storePath, 0755); err != nil {
-		exitWithError(ExitError, "failed to create store directory: %v", err)
-	}
-
-	// Create checkpoints directory
-	checkpointsDir := filepath.Join(storePath, "checkpoints")
-	if err := os.MkdirAll(checkpointsDir, 0755); err != nil {
-		cleanup(storePath, "", "")
-		exitWithError(ExitError, "failed to create checkpoints directory: %v", err)
-	}
-
-	// Create sparse bundle inside store directory
-	bundlePath := filepath.Join(storePath, "data.sparsebundle")
-	cmd := exec.Command("hdiutil", "create",
-		"-size", "50G",
-		"-type", "SPARSEBUNDLE",
-		"-fs", "APFS",
-		"-volname", name,
-		bundlePath)
-	output, err := cmd.CombinedOutput()
+	s, err := storeManager.CreateVolume(parentDir, name, store.CreateOpts{
+		Size:    "50G",
+		Backend: manageBackend,
+	})
 	if err != nil {
-		cleanup(storePath, "", "")
-		exitWithError(ExitError, "failed to create sparse bundle: %v\n%s", err, output)
+		exitWithError(ExitError, "%v", err)
 	}
 
 	// === MOUNT AT TEMP LOCATION ===
-	tempMount, err := os.MkdirTemp("", "agentfs-manage-")
+	// The temp mount point lives inside the store so backends that move the
+	// working copy (dir) stay on the same filesystem
+	tempMount, err := os.MkdirTemp(storePath, "manage-")
 	if err != nil {
 		cleanup(storePath, "", "")
 		exitWithError(ExitError, "failed to create temp directory: %v", err)
 	}
 
 	fmt.Println("Mounting store...")
-	cmd = exec.Command("hdiutil", "attach", bundlePath, "-mountpoint", tempMount)
-	output, err = cmd.CombinedOutput()
-	if err != nil {
+	if err := storeManager.MountAt(s, tempMount); err != nil {
 		cleanup(storePath, tempMount, "")
-		exitWithError(ExitError, "failed to mount sparse bundle: %v\n%s", err, output)
+		exitWithError(ExitError, "%v", err)
 	}
 
 	// === COPY DATA ===
@@ -154,10 +137,10 @@ func runManage(dirPath string) {
 
 	// Use cp -R to preserve symlinks and permissions
 	// Note: trailing /. copies contents, not the directory itself
-	cmd = exec.Command("cp", "-R", dirPath+"/.", tempMount+"/")
-	output, err = cmd.CombinedOutput()
+	cmd := exec.Command("cp", "-R", dirPath+"/.", tempMount+"/")
+	output, err := cmd.CombinedOutput()
 	if err != nil {
-		unmountAndCleanup(storePath, tempMount)
+		unmountAndCleanup(s, tempMount)
 		exitWithError(ExitError, "failed to copy files: %v\n%s", err, output)
 	}
 
@@ -187,11 +170,11 @@ func runManage(dirPath string) {
 			}
 		}
 
-		unmountAndCleanup(storePath, tempMount)
+		unmountAndCleanup(s, tempMount)
 		exitWithError(ExitError, "verification failed: file count mismatch (%d vs %d). Original unchanged.", srcCount, dstCount)
 	}
 	if srcSize != dstSize {
-		unmountAndCleanup(storePath, tempMount)
+		unmountAndCleanup(s, tempMount)
 		exitWithError(ExitError, "verification failed: size mismatch (%d vs %d bytes). Original unchanged.", srcSize, dstSize)
 	}
 
@@ -199,12 +182,10 @@ func runManage(dirPath string) {
 	fmt.Printf("  Size: %s ✓\n", backup.FormatSize(srcSize))
 
 	// === UNMOUNT TEMP ===
-	cmd = exec.Command("hdiutil", "detach", tempMount)
-	if _, err := cmd.CombinedOutput(); err != nil {
+	if err := storeManager.UnmountAt(s, tempMount); err != nil {
 		cleanup(storePath, tempMount, "")
 		exitWithError(ExitError, "failed to unmount temp: %v", err)
 	}
-	os.Remove(tempMount)
 
 	// === BACKUP ORIGINAL ===
 	fmt.Println("Moving original to backup...")
@@ -225,12 +206,10 @@ func runManage(dirPath string) {
 		exitWithError(ExitError, "failed to create mount point: %v", err)
 	}
 
-	cmd = exec.Command("hdiutil", "attach", bundlePath, "-mountpoint", dirPath)
-	output, err = cmd.CombinedOutput()
-	if err != nil {
+	if err := s.Backend.Attach(s, dirPath); err != nil {
 		restoreBackupOnFailure(backupMgr, backupEntry, dirPath)
 		cleanup(storePath, "", dirPath)
-		exitWithError(ExitError, "failed to mount at original location: %v\n%s", err, output)
+		exitWithError(ExitError, "failed to mount at original location: %v", err)
 	}
 
 	// === INITIALIZE DATABASE ===
@@ -238,7 +217,7 @@ func runManage(dirPath string) {
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "warning: failed to create database: %v\n", err)
 	} else {
-		if err := database.InitStore(name, 50*1024*1024*1024); err != nil {
+		if err := database.InitStore(name, s.SizeBytes); err != nil {
 			fmt.Fprintf(os.Stderr, "warning: failed to initialize store database: %v\n", err)
 		}
 		database.Close()
@@ -346,10 +325,10 @@ func cleanup(storePath, tempMount, mountPoint string) {
 	}
 }
 
-func unmountAndCleanup(storePath, tempMount string) {
+func unmountAndCleanup(s *store.Store, tempMount string) {
 	// Try to unmount
-	exec.Command("hdiutil", "detach", tempMount).Run()
-	cleanup(storePath, tempMount, "")
+	s.Backend.Detach(s, tempMount)
+	cleanup(s.StorePath, tempMount, "")
 }
 
 func restoreBackupOnFailure(backupMgr *backup.Manager, entry *backup.Entry, originalPath string) {
@@ -389,5 +368,6 @@ func resolveStoreForManage(dirPath string) (*store.Store, error) {
 
 func init() {
 	manageCmd.Flags().BoolVar(&manageCleanup, "cleanup", false, "remove backup after verification")
+	manageCmd.Flags().StringVar(&manageBackend, "backend", "", "storage backend (default: platform default or $AGENTFS_BACKEND)")
 	rootCmd.AddCommand(manageCmd)
 }
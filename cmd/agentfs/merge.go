@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	cpkg "github.com/sleexyz/agentfs/internal/checkpoint"
+	"github.com/sleexyz/agentfs/internal/context"
+	"github.com/sleexyz/agentfs/internal/db"
+	"github.com/sleexyz/agentfs/internal/revision"
+	"github.com/sleexyz/agentfs/internal/store"
+	"github.com/spf13/cobra"
+)
+
+var mergeCmd = &cobra.Command{
+	Use:   "merge <revision|store>",
+	Short: "Merge a checkpoint or forked store into the working copy",
+	Long: `Merge the changes of another line of work into the working copy.
+
+The argument is a revision of this store (a branch, tag, or version), or
+another store: a sibling's name (agent-a or agent-a.fs), or a path to its
+.fs directory (relative to the current directory, e.g. ../other/agent-a.fs).
+For a store, its current head checkpoint is merged.
+
+Changes are merged file by file against the common ancestor: the newest
+checkpoint both sides descend from, or for another store the checkpoint it
+was forked from (or last merged at). Files changed only on the other side
+are applied; text files changed on both sides are merged line by line, with
+conflict markers where the changes overlap. Binary files changed on both
+sides keep the working copy's version, and a file deleted on one side and
+changed on the other keeps the changed version; both are listed as
+conflicts.
+
+Unsaved changes are saved as a "pre-merge" checkpoint first. The result is
+recorded as a merge checkpoint with both parents, conflict markers included:
+resolve the conflicts, then create another checkpoint. Exits with status 1
+if there were conflicts.
+
+Examples:
+  agentfs merge approach-b     # Merge a branch
+  agentfs merge agent-a        # Merge the fork agent-a.fs/`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Resolve store
+		storePath, err := context.MustResolveStore(storeFlag, "")
+		if err != nil {
+			exitWithError(ExitUsageError, "%v", err)
+		}
+
+		// Get store info
+		s, err := storeManager.GetFromPath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		if s == nil {
+			exitWithError(ExitStoreNotFound, "store not found")
+		}
+
+		// Open per-store database
+		database, err := db.OpenFromStorePath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "failed to open database: %v", err)
+		}
+		defer database.Close()
+
+		// Create checkpoint manager
+		cpManager := cpkg.NewManager(storeManager, database, s)
+
+		// A revision of this store, or else another store, locked with this one
+		var other *store.Store
+		if _, err := revision.Resolve(database, args[0]); err != nil {
+			if other = findMergeStore(s, args[0]); other == nil {
+				resolveRevision(database, args[0]) // Reports the revision error
+			}
+		}
+		lockPaths := []string{storePath}
+		if other != nil {
+			lockPaths = append(lockPaths, other.StorePath)
+		}
+		for _, lock := range lockStores(lockPaths...) {
+			defer lock.Unlock()
+		}
+
+		src := cpManager
+		var srcStore string
+		var label string
+		var version int
+		if other != nil {
+			otherDB, err := db.OpenFromStorePath(other.StorePath)
+			if err != nil {
+				exitWithError(ExitError, "failed to open database of %s: %v", other.Name, err)
+			}
+			defer otherDB.Close()
+
+			src = cpkg.NewManager(storeManager, otherDB, other)
+			head, err := src.Head()
+			if err != nil {
+				exitWithError(ExitError, "%v", err)
+			}
+			if head == nil {
+				exitWithError(ExitCPNotFound, "%s has no checkpoints", other.Name)
+			}
+			version = head.Version
+			srcStore = other.StorePath
+			label = fmt.Sprintf("%s v%d", other.Name, version)
+			if storeManager.IsMounted(other) {
+				if changed, err := src.HasChanges(); err == nil && changed {
+					fmt.Fprintf(os.Stderr, "warning: %s has unsaved changes, which are not merged\n", other.Name)
+				}
+			}
+		} else {
+			version = resolveRevision(database, args[0])
+			label = fmt.Sprintf("v%d", version)
+		}
+
+		start := time.Now()
+		result, err := cpManager.Merge(src, version)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		duration := time.Since(start)
+
+		if jsonFlag {
+			type conflictJSON struct {
+				Path string `json:"path"`
+				Kind string `json:"kind"`
+			}
+			type mergeJSON struct {
+				Version     string         `json:"version"`
+				Store       string         `json:"store,omitempty"`
+				BaseVersion string         `json:"base_version"`
+				BaseStore   string         `json:"base_store"`
+				UpToDate    bool           `json:"up_to_date"`
+				Applied     []string       `json:"applied"`
+				Merged      []string       `json:"merged"`
+				Conflicts   []conflictJSON `json:"conflicts"`
+				PreMerge    string         `json:"pre_merge,omitempty"`
+				Checkpoint  string         `json:"checkpoint,omitempty"`
+				DurationMs  int64          `json:"duration_ms"`
+			}
+
+			output := mergeJSON{
+				Version:     fmt.Sprintf("v%d", version),
+				Store:       srcStore,
+				BaseVersion: fmt.Sprintf("v%d", result.BaseVersion),
+				BaseStore:   result.BaseStore,
+				UpToDate:    result.UpToDate,
+				Applied:     append([]string{}, result.Applied...),
+				Merged:      append([]string{}, result.Merged...),
+				Conflicts:   []conflictJSON{},
+				DurationMs:  duration.Milliseconds(),
+			}
+			for _, c := range result.Conflicts {
+				output.Conflicts = append(output.Conflicts, conflictJSON{Path: c.Path, Kind: c.Kind})
+			}
+			if result.PreMerge != nil {
+				output.PreMerge = fmt.Sprintf("v%d", result.PreMerge.Version)
+			}
+			if result.Checkpoint != nil {
+				output.Checkpoint = fmt.Sprintf("v%d", result.Checkpoint.Version)
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(output)
+		} else {
+			base := fmt.Sprintf("v%d", result.BaseVersion)
+			if result.BaseStore != storePath {
+				base = fmt.Sprintf("%s v%d", strings.TrimSuffix(filepath.Base(result.BaseStore), ".fs"), result.BaseVersion)
+			}
+			printMergeResult(result, label, base)
+		}
+
+		if len(result.Conflicts) > 0 {
+			os.Exit(ExitError)
+		}
+	},
+}
+
+// findMergeStore returns the store named by arg, or nil if there is none. A
+// bare name (agent-a or agent-a.fs) is a sibling of s; anything with a path
+// separator is a path to a .fs directory, relative to the current directory.
+func findMergeStore(s *store.Store, arg string) *store.Store {
+	path := arg
+	if !strings.ContainsRune(arg, filepath.Separator) {
+		path = filepath.Join(filepath.Dir(s.StorePath), strings.TrimSuffix(arg, ".fs")+".fs")
+	}
+	path, err := filepath.Abs(path)
+	if err != nil || path == s.StorePath {
+		return nil
+	}
+	other, err := storeManager.GetFromPath(path)
+	if err != nil {
+		return nil
+	}
+	return other
+}
+
+// printMergeResult prints what a merge did
+func printMergeResult(result *cpkg.MergeResult, label, base string) {
+	if result.PreMerge != nil {
+		fmt.Printf("Saved unsaved changes as v%d \"pre-merge\"\n", result.PreMerge.Version)
+	}
+	if result.UpToDate {
+		fmt.Printf("Already up to date with %s\n", label)
+		return
+	}
+
+	fmt.Printf("Merging %s (common ancestor %s)\n", label, base)
+	printMergedFiles(result.Applied, result.Merged, result.Conflicts)
+
+	if result.Checkpoint == nil {
+		return
+	}
+	if n := len(result.Conflicts); n > 0 {
+		fmt.Printf("Created v%d %q with %d conflict%s; resolve and checkpoint again\n", result.Checkpoint.Version, result.Checkpoint.Message, n, plural(n))
+	} else {
+		fmt.Printf("Created v%d %q\n", result.Checkpoint.Version, result.Checkpoint.Message)
+	}
+}
+
+// printMergedFiles prints one line per file applied, merged or in conflict
+func printMergedFiles(applied, merged []string, conflicts []cpkg.MergeConflict) {
+	for _, path := range applied {
+		fmt.Printf("  applied   %s\n", path)
+	}
+	for _, path := range merged {
+		fmt.Printf("  merged    %s\n", path)
+	}
+	for _, c := range conflicts {
+		switch c.Kind {
+		case cpkg.ConflictText:
+			fmt.Printf("  conflict  %s (conflict markers written)\n", c.Path)
+		case cpkg.ConflictBinary:
+			fmt.Printf("  conflict  %s (binary, kept current version)\n", c.Path)
+		case cpkg.ConflictDeleted:
+			fmt.Printf("  conflict  %s (deleted on one side, kept changed version)\n", c.Path)
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(mergeCmd)
+}
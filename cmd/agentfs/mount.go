@@ -60,8 +60,11 @@ Examples:
 			exitWithError(ExitStoreNotFound, "store not found: %s", storePath)
 		}
 
+		lock := lockStore(storePath, false)
+		defer lock.Unlock()
+
 		// Check if already mounted
-		if storeManager.IsMounted(s.MountPath) {
+		if storeManager.IsMounted(s) {
 			fmt.Printf("Already mounted at ./%s/\n", s.Name)
 			return
 		}
@@ -126,7 +129,7 @@ func mountAll() {
 		}
 
 		// Check if already mounted
-		if storeManager.IsMounted(s.MountPath) {
+		if storeManager.IsMounted(s) {
 			// Already mounted, just update timestamp
 			reg.UpdateLastMounted(s.StorePath)
 			continue
@@ -134,7 +137,10 @@ func mountAll() {
 
 		// Mount the store
 		fmt.Printf("Mounting %s... ", filepath.Base(regStore.StorePath))
-		if err := storeManager.Mount(s); err != nil {
+		lock := lockStore(s.StorePath, false)
+		err = storeManager.Mount(s)
+		lock.Unlock()
+		if err != nil {
 			fmt.Printf("failed: %v\n", err)
 			skipped++
 			continue
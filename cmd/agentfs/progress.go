@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sleexyz/agentfs/internal/clone"
+)
+
+// progressDelay is how long cloning runs before progress is shown, so quick
+// checkpoints stay quiet
+const progressDelay = 500 * time.Millisecond
+
+// cloneProgress returns a clone progress callback that keeps a
+// "Cloning files... n/total" line on stderr once cloning is slow enough to
+// notice
+func cloneProgress() func(clone.Progress) {
+	start := time.Now()
+	shown := false
+	return func(p clone.Progress) {
+		if !shown && time.Since(start) < progressDelay {
+			return
+		}
+		shown = true
+		fmt.Fprintf(os.Stderr, "\rCloning files... %d/%d", p.Done, p.Total)
+		if p.Done == p.Total {
+			fmt.Fprintln(os.Stderr)
+		}
+	}
+}
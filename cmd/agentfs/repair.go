@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	cpkg "github.com/sleexyz/agentfs/internal/checkpoint"
+	"github.com/sleexyz/agentfs/internal/context"
+	"github.com/sleexyz/agentfs/internal/db"
+	"github.com/spf13/cobra"
+)
+
+var repairRebuildDBFlag bool
+
+var repairCmd = &cobra.Command{
+	Use:   "repair",
+	Short: "Repair store metadata",
+	Long: `Repair a store's metadata.
+
+With --rebuild-db, metadata.db is replaced by a fresh database whose
+checkpoints are reconstructed from checkpoints/: each vN directory's sidecar
+(checkpoints/vN.json) supplies its message, creation time, parent and
+duration. Snapshots without a sidecar are recorded as "recovered" and dated
+by their directory's mtime. The old database is kept as metadata.db.bak
+(or metadata.db.bak.N, if an earlier backup exists).
+
+Use this when metadata.db was deleted or is corrupt. For smaller
+inconsistencies, use 'agentfs fsck --repair'.
+
+Requires confirmation unless -f/--force is specified.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !repairRebuildDBFlag {
+			exitWithError(ExitUsageError, "nothing to repair: pass --rebuild-db (or run 'agentfs fsck --repair')")
+		}
+
+		// Resolve store
+		storePath, err := context.MustResolveStore(storeFlag, "")
+		if err != nil {
+			exitWithError(ExitUsageError, "%v", err)
+		}
+
+		// Get store info
+		s, err := storeManager.GetFromPath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		if s == nil {
+			exitWithError(ExitStoreNotFound, "store not found")
+		}
+
+		versions, err := s.Backend.ListSnapshots(s)
+		if err != nil {
+			exitWithError(ExitError, "failed to list snapshots: %v", err)
+		}
+
+		prompt := fmt.Sprintf("Rebuild metadata.db from %d checkpoint directories? The current database will be kept as a backup.", len(versions))
+		if !confirmPrompt(prompt) {
+			fmt.Println("Cancelled")
+			return
+		}
+
+		lock := lockStore(storePath, false)
+		defer lock.Unlock()
+
+		backupPath, err := db.MoveAside(storePath)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+
+		// Open a fresh per-store database
+		database, err := db.OpenFromStorePath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "failed to create database: %v", err)
+		}
+		defer database.Close()
+
+		if err := database.InitStore(s.Name, s.SizeBytes); err != nil {
+			exitWithError(ExitError, "failed to initialize store info: %v", err)
+		}
+
+		cpManager := cpkg.NewManager(storeManager, database, s)
+		result, err := cpManager.RebuildDB()
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+
+		if jsonFlag {
+			type repairJSON struct {
+				Imported       int      `json:"imported"`
+				WithoutSidecar []string `json:"without_sidecar"`
+				Backup         string   `json:"backup,omitempty"`
+			}
+
+			output := repairJSON{
+				Imported:       result.Imported,
+				WithoutSidecar: []string{},
+				Backup:         backupPath,
+			}
+			for _, v := range result.WithoutSidecar {
+				output.WithoutSidecar = append(output.WithoutSidecar, fmt.Sprintf("v%d", v))
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(output)
+			return
+		}
+
+		if backupPath != "" {
+			fmt.Printf("Moved old database to %s\n", backupPath)
+		}
+		for _, v := range result.WithoutSidecar {
+			fmt.Fprintf(os.Stderr, "warning: v%d has no metadata sidecar; recorded as %q\n", v, "recovered")
+		}
+		fmt.Printf("Rebuilt metadata.db with %d checkpoints\n", result.Imported)
+	},
+}
+
+func init() {
+	repairCmd.Flags().BoolVar(&repairRebuildDBFlag, "rebuild-db", false, "reconstruct metadata.db from checkpoint sidecars")
+	rootCmd.AddCommand(repairCmd)
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	cpkg "github.com/sleexyz/agentfs/internal/checkpoint"
 	"github.com/sleexyz/agentfs/internal/context"
@@ -12,18 +14,40 @@ import (
 )
 
 var restoreCmd = &cobra.Command{
-	Use:   "restore <version>",
+	Use:   "restore <revision> [-- <path>...]",
 	Short: "Restore to a checkpoint",
 	Long: `Restore the store to a previous checkpoint.
 
 This will:
 1. Create a checkpoint of the current state (unless --no-backup)
 2. Unmount the store
-3. Swap the sparse bundle bands with the checkpoint
+3. Replace the store's data with the checkpoint's snapshot
 4. Remount the store
 
+The checkpoint can be given as:
+  v12, 12          Version number
+  latest           Newest checkpoint
+  green-tests      Tag
+  approach-b       Branch head
+  @{10 min ago}    Newest checkpoint at or before a time
+  :/refactor       Newest checkpoint whose message matches a regexp
+  latest~3, v12^   Ancestors (~N walks N parents, ^ is the parent)
+
+The same forms work for diff, tag, and checkpoint info/delete.
+
+With paths, only those files are copied back from the checkpoint; the rest
+of the working copy is left as it is. Paths are relative to the current
+directory (inside the store) or the store root, and may be glob patterns
+(quote them; * doesn't match /). A directory restores every file under it.
+Files added since the checkpoint are kept. Unsaved changes are saved as a
+"pre-restore" checkpoint first, and the result is recorded as a new
+checkpoint:
+
+  agentfs restore v12 -- src/app.ts
+  agentfs restore v12 -- 'src/*.go' docs
+
 Requires confirmation unless -f/--force is specified.`,
-	Args: cobra.ExactArgs(1),
+	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		// Resolve store
 		storePath, err := context.MustResolveStore(storeFlag, "")
@@ -50,10 +74,11 @@ Requires confirmation unless -f/--force is specified.`,
 		// Create checkpoint manager
 		cpManager := cpkg.NewManager(storeManager, database, s)
 
-		version, err := parseVersion(args[0])
-		if err != nil {
-			exitWithError(ExitUsageError, "invalid version: %v", err)
-		}
+		// Resolve the revision under the lock, so it can't move before the restore
+		lock := lockStore(storePath, false)
+		defer lock.Unlock()
+
+		version := resolveRevision(database, args[0])
 
 		// Get the target checkpoint first
 		targetCp, err := cpManager.Get(version)
@@ -64,6 +89,11 @@ Requires confirmation unless -f/--force is specified.`,
 			exitWithError(ExitCPNotFound, "checkpoint v%d not found", version)
 		}
 
+		if len(args) > 1 {
+			restorePaths(s.MountPath, cpManager, version, args[1:])
+			return
+		}
+
 		// Get next version for pre-restore checkpoint
 		nextVersion := version + 1
 		if latest, _ := cpManager.GetLatest(); latest != nil {
@@ -81,6 +111,9 @@ Requires confirmation unless -f/--force is specified.`,
 		fmt.Printf("Restoring from v%d...\n", version)
 		fmt.Println("Mounting...")
 
+		if !jsonFlag {
+			s.Progress = cloneProgress()
+		}
 		cp, duration, err := cpManager.Restore(version, true)
 		if err != nil {
 			exitWithError(ExitError, "%v", err)
@@ -119,6 +152,72 @@ Requires confirmation unless -f/--force is specified.`,
 	},
 }
 
+// restorePaths copies the given paths from a checkpoint into the working copy.
+// The caller holds the store lock.
+func restorePaths(mountPath string, cpManager *cpkg.Manager, version int, args []string) {
+	var patterns []string
+	for _, arg := range args {
+		path, err := storeRelativePath(mountPath, arg)
+		if err != nil {
+			exitWithError(ExitUsageError, "%v", err)
+		}
+		patterns = append(patterns, path)
+	}
+
+	prompt := fmt.Sprintf("Restore %s from v%d? Unsaved changes will be saved as a checkpoint first.", strings.Join(patterns, " "), version)
+	if !confirmPrompt(prompt) {
+		fmt.Println("Cancelled")
+		return
+	}
+
+	start := time.Now()
+	result, err := cpManager.RestorePaths(version, patterns)
+	if err != nil {
+		exitWithError(ExitError, "%v", err)
+	}
+	duration := time.Since(start)
+
+	if jsonFlag {
+		type partialRestoreJSON struct {
+			Version    string   `json:"version"`
+			Restored   []string `json:"restored"`
+			PreRestore string   `json:"pre_restore,omitempty"`
+			Checkpoint string   `json:"checkpoint,omitempty"`
+			DurationMs int64    `json:"duration_ms"`
+		}
+
+		output := partialRestoreJSON{
+			Version:    fmt.Sprintf("v%d", version),
+			Restored:   result.Restored,
+			DurationMs: duration.Milliseconds(),
+		}
+		if result.PreRestore != nil {
+			output.PreRestore = fmt.Sprintf("v%d", result.PreRestore.Version)
+		}
+		if result.Checkpoint != nil {
+			output.Checkpoint = fmt.Sprintf("v%d", result.Checkpoint.Version)
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(output)
+		return
+	}
+
+	if result.PreRestore != nil {
+		fmt.Printf("Saved unsaved changes as v%d \"pre-restore\"\n", result.PreRestore.Version)
+	}
+	fmt.Printf("Restored %d file%s from v%d (%dms)\n", len(result.Restored), plural(len(result.Restored)), version, duration.Milliseconds())
+	for _, path := range result.Restored {
+		fmt.Printf("  %s\n", path)
+	}
+	if result.Checkpoint != nil {
+		fmt.Printf("Created v%d %q\n", result.Checkpoint.Version, result.Checkpoint.Message)
+	} else {
+		fmt.Println("Files already matched the checkpoint; no checkpoint created")
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(restoreCmd)
 }
@@ -16,6 +16,7 @@ const (
 	ExitStoreNotFound = 3
 	ExitCPNotFound    = 4
 	ExitMountFailed   = 5
+	ExitLocked        = 6
 )
 
 var (
@@ -23,6 +24,8 @@ var (
 	storeFlag string
 	jsonFlag  bool
 	forceFlag bool
+	waitFlag  bool
+	noWait    bool
 
 	// Shared store manager (no global database needed anymore)
 	storeManager *store.Manager
@@ -30,9 +33,10 @@ var (
 
 var rootCmd = &cobra.Command{
 	Use:   "agentfs",
-	Short: "Instant checkpoint and restore for macOS projects",
+	Short: "Instant checkpoint and restore for project directories",
 	Long: `AgentFS provides instant checkpointing (~20ms) and fast restore (<500ms)
-for macOS projects using sparse bundles and APFS reflinks.
+for project directories, using sparse bundles and APFS reflinks on macOS,
+reflinked loop images on Linux, or content-addressed file manifests.
 
 Stores are self-contained in foo.fs/ directories with adjacent foo/ mount points.
 
@@ -55,6 +59,9 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&storeFlag, "store", "", "specify store name")
 	rootCmd.PersistentFlags().BoolVar(&jsonFlag, "json", false, "output as JSON")
 	rootCmd.PersistentFlags().BoolVarP(&forceFlag, "force", "f", false, "skip confirmation prompts")
+	rootCmd.PersistentFlags().BoolVar(&waitFlag, "wait", false, "wait if another agentfs process holds the store lock (default)")
+	rootCmd.PersistentFlags().BoolVar(&noWait, "no-wait", false, "fail immediately if another agentfs process holds the store lock")
+	rootCmd.MarkFlagsMutuallyExclusive("wait", "no-wait")
 }
 
 // exitWithError prints an error message and exits with the given code
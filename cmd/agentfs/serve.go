@@ -2,14 +2,13 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -17,6 +16,8 @@ import (
 
 	"github.com/sleexyz/agentfs/internal/context"
 	"github.com/sleexyz/agentfs/internal/db"
+	"github.com/sleexyz/agentfs/internal/revision"
+	"github.com/sleexyz/agentfs/internal/store"
 	"github.com/spf13/cobra"
 )
 
@@ -82,6 +83,7 @@ type Delta struct {
 // Server holds the HTTP server state
 type Server struct {
 	index    *Index
+	database *db.DB // Resolves revisions in API paths
 	mu       sync.RWMutex
 	staticFS http.FileSystem
 }
@@ -211,8 +213,11 @@ On startup, the server:
 
 The API endpoints are:
   GET /api/checkpoints         - List all checkpoints with summary stats
-  GET /api/manifest/:version   - Full file tree for a checkpoint
-  GET /api/diff/:v1/:v2        - Delta between two versions`,
+  GET /api/manifest/:rev       - Full file tree for a checkpoint
+  GET /api/diff/:rev1/:rev2    - Delta between two checkpoints
+  GET /api/diff?from=&to=      - Same, for revisions containing '/'
+
+Revisions are anything 'agentfs restore' accepts: v5, latest~1, a tag...`,
 	Args: cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
 		// Resolve store
@@ -238,7 +243,7 @@ The API endpoints are:
 		defer database.Close()
 
 		// Check if mounted
-		if !storeManager.IsMounted(s.MountPath) {
+		if !storeManager.IsMounted(s) {
 			exitWithError(ExitError, "store '%s' is not mounted. Run 'agentfs mount' first.", s.Name)
 		}
 
@@ -270,7 +275,7 @@ The API endpoints are:
 		if index == nil {
 			fmt.Printf("Building index for %s...\n", s.Name)
 
-			index, err = buildIndex(storePath, s.MountPath, database, serveWorkersFlag)
+			index, err = buildIndex(s, database, serveWorkersFlag)
 			if err != nil {
 				exitWithError(ExitError, "failed to build index: %v", err)
 			}
@@ -286,7 +291,8 @@ The API endpoints are:
 
 		// Create server
 		server := &Server{
-			index: index,
+			index:    index,
+			database: database,
 		}
 
 		// Set up routes
@@ -295,6 +301,7 @@ The API endpoints are:
 		// API routes
 		mux.HandleFunc("/api/checkpoints", server.handleCheckpoints)
 		mux.HandleFunc("/api/manifest/", server.handleManifest)
+		mux.HandleFunc("/api/diff", server.handleDiff)
 		mux.HandleFunc("/api/diff/", server.handleDiff)
 		mux.HandleFunc("/api/index", server.handleIndex)
 
@@ -327,8 +334,8 @@ The API endpoints are:
 <h2>API Endpoints</h2>
 <ul>
 <li><a href="/api/checkpoints">/api/checkpoints</a> - List checkpoints</li>
-<li>/api/manifest/:version - Get manifest for a version</li>
-<li>/api/diff/:v1/:v2 - Get diff between versions</li>
+<li>/api/manifest/:rev - Get manifest for a checkpoint</li>
+<li>/api/diff/:rev1/:rev2 - Get diff between checkpoints</li>
 <li><a href="/api/index">/api/index</a> - Full index data</li>
 </ul>
 </body>
@@ -359,13 +366,11 @@ func init() {
 }
 
 // buildIndex builds the index by scanning checkpoints and computing deltas
-func buildIndex(storePath, mountPath string, database *db.DB, workers int) (*Index, error) {
-	storeName := context.StoreNameFromPath(storePath)
-
+func buildIndex(s *store.Store, database *db.DB, workers int) (*Index, error) {
 	index := &Index{
-		MountPath: mountPath,
-		StorePath: storePath,
-		StoreName: storeName,
+		MountPath: s.MountPath,
+		StorePath: s.StorePath,
+		StoreName: s.Name,
 		Manifests: make(map[int]*Manifest),
 		Deltas:    make(map[string]*Delta),
 	}
@@ -386,7 +391,7 @@ func buildIndex(storePath, mountPath string, database *db.DB, workers int) (*Ind
 	})
 
 	// Build manifests in parallel
-	manifests, err := buildManifestsParallel(checkpoints, storePath, workers)
+	manifests, err := buildManifestsParallel(checkpoints, s, workers)
 	if err != nil {
 		return nil, err
 	}
@@ -435,7 +440,7 @@ func buildIndex(storePath, mountPath string, database *db.DB, workers int) (*Ind
 }
 
 // buildManifestsParallel builds manifests for all checkpoints using a worker pool
-func buildManifestsParallel(checkpoints []*db.Checkpoint, storePath string, workers int) (map[int]*Manifest, error) {
+func buildManifestsParallel(checkpoints []*db.Checkpoint, s *store.Store, workers int) (map[int]*Manifest, error) {
 	if workers < 1 {
 		workers = 1
 	}
@@ -476,7 +481,7 @@ func buildManifestsParallel(checkpoints []*db.Checkpoint, storePath string, work
 			sem <- struct{}{}
 			defer func() { <-sem }()
 
-			manifest, err := buildManifest(cp.Version, storePath)
+			manifest, err := buildManifest(s, cp.Version)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "\nwarning: failed to build manifest for v%d: %v\n", cp.Version, err)
 				return
@@ -500,8 +505,8 @@ func buildManifestsParallel(checkpoints []*db.Checkpoint, storePath string, work
 }
 
 // buildManifest builds a file manifest for a checkpoint version
-func buildManifest(version int, storePath string) (*Manifest, error) {
-	checkpointsPath := filepath.Join(storePath, "checkpoints")
+func buildManifest(s *store.Store, version int) (*Manifest, error) {
+	checkpointsPath := storeManager.GetCheckpointsPath(s)
 	cpPath := filepath.Join(checkpointsPath, fmt.Sprintf("v%d", version))
 
 	// Verify checkpoint exists
@@ -521,7 +526,7 @@ func buildManifest(version int, storePath string) (*Manifest, error) {
 	// Actually, we need to mount to walk. Let's use differ's internal method pattern
 	// but create our own temporary mount
 
-	tmpMount, cleanup, err := mountCheckpointForWalk(cpPath, storePath, version)
+	tmpMount, cleanup, err := mountCheckpointForWalk(s, cpPath, version)
 	if err != nil {
 		return nil, err
 	}
@@ -573,63 +578,22 @@ func buildManifest(version int, storePath string) (*Manifest, error) {
 }
 
 // mountCheckpointForWalk creates a temporary mount of a checkpoint for walking
-func mountCheckpointForWalk(cpPath, storePath string, version int) (string, func(), error) {
-	bundlePath := filepath.Join(storePath, "data.sparsebundle")
-
-	// Create temp bundle
-	timestamp := time.Now().UnixNano()
-	tmpBundle := filepath.Join(os.TempDir(), fmt.Sprintf("agentfs-serve-v%d-%d.sparsebundle", version, timestamp))
-	tmpMount := filepath.Join(os.TempDir(), fmt.Sprintf("agentfs-serve-v%d-%d-mount", version, timestamp))
-
-	// Create bundle directory
-	if err := os.MkdirAll(tmpBundle, 0755); err != nil {
+func mountCheckpointForWalk(s *store.Store, cpPath string, version int) (string, func(), error) {
+	workDir, err := os.MkdirTemp("", fmt.Sprintf("agentfs-serve-v%d-", version))
+	if err != nil {
 		return "", nil, err
 	}
+	tmpMount := filepath.Join(workDir, "mount")
 
-	// Copy Info.plist from original bundle
-	infoPlist := filepath.Join(bundlePath, "Info.plist")
-	infoDst := filepath.Join(tmpBundle, "Info.plist")
-	if data, err := os.ReadFile(infoPlist); err == nil {
-		os.WriteFile(infoDst, data, 0644)
-	}
-
-	// Copy token if exists
-	tokenFile := filepath.Join(bundlePath, "token")
-	tokenDst := filepath.Join(tmpBundle, "token")
-	if data, err := os.ReadFile(tokenFile); err == nil {
-		os.WriteFile(tokenDst, data, 0644)
-	}
-
-	// Clone bands from checkpoint using APFS reflink
-	bandsDir := filepath.Join(tmpBundle, "bands")
-	cmd := exec.Command("/bin/cp", "-Rc", cpPath+"/", bandsDir+"/")
-	if output, err := cmd.CombinedOutput(); err != nil {
-		os.RemoveAll(tmpBundle)
-		return "", nil, fmt.Errorf("failed to clone bands: %w\n%s", err, output)
-	}
-
-	// Create mount point
-	if err := os.MkdirAll(tmpMount, 0755); err != nil {
-		os.RemoveAll(tmpBundle)
+	if err := s.Backend.AttachSnapshot(s, cpPath, workDir, tmpMount); err != nil {
+		os.RemoveAll(workDir)
 		return "", nil, err
 	}
 
-	// Mount
-	cmd = exec.Command("hdiutil", "attach", tmpBundle,
-		"-mountpoint", tmpMount,
-		"-nobrowse",
-		"-quiet")
-	if output, err := cmd.CombinedOutput(); err != nil {
-		os.RemoveAll(tmpBundle)
-		os.RemoveAll(tmpMount)
-		return "", nil, fmt.Errorf("failed to mount: %w\n%s", err, output)
-	}
-
 	// Cleanup function
 	cleanup := func() {
-		exec.Command("hdiutil", "detach", tmpMount, "-quiet").Run()
-		os.RemoveAll(tmpMount)
-		os.RemoveAll(tmpBundle)
+		s.Backend.DetachSnapshot(s, workDir, tmpMount)
+		os.RemoveAll(workDir)
 	}
 
 	return tmpMount, cleanup, nil
@@ -644,6 +608,7 @@ func shouldSkipFile(path string) bool {
 		".Trashes",
 		".fseventsd",
 		".TemporaryItems",
+		"lost+found",
 	}
 
 	for _, pattern := range skipPatterns {
@@ -708,13 +673,9 @@ func (s *Server) handleCheckpoints(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleManifest(w http.ResponseWriter, r *http.Request) {
-	// Parse version from URL: /api/manifest/5 or /api/manifest/v5
-	path := strings.TrimPrefix(r.URL.Path, "/api/manifest/")
-	path = strings.TrimPrefix(path, "v")
-
-	version, err := strconv.Atoi(path)
-	if err != nil {
-		http.Error(w, "invalid version", http.StatusBadRequest)
+	// Parse revision from URL: /api/manifest/5, /api/manifest/v5, /api/manifest/latest~1
+	version, ok := s.resolve(w, strings.TrimPrefix(r.URL.Path, "/api/manifest/"))
+	if !ok {
 		return
 	}
 
@@ -732,23 +693,24 @@ func (s *Server) handleManifest(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleDiff(w http.ResponseWriter, r *http.Request) {
-	// Parse versions from URL: /api/diff/3/5 or /api/diff/v3/v5
-	path := strings.TrimPrefix(r.URL.Path, "/api/diff/")
-	parts := strings.Split(path, "/")
+	// Parse revisions from URL: /api/diff/3/5, /api/diff/v3/latest,
+	// or /api/diff?from=feature/x&to=latest for revisions containing '/'
+	from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	if from == "" && to == "" {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/diff/"), "/")
+		if len(parts) != 2 {
+			http.Error(w, "expected /api/diff/:v1/:v2", http.StatusBadRequest)
+			return
+		}
+		from, to = parts[0], parts[1]
+	}
 
-	if len(parts) != 2 {
-		http.Error(w, "expected /api/diff/:v1/:v2", http.StatusBadRequest)
+	v1, ok := s.resolve(w, from)
+	if !ok {
 		return
 	}
-
-	v1Str := strings.TrimPrefix(parts[0], "v")
-	v2Str := strings.TrimPrefix(parts[1], "v")
-
-	v1, err1 := strconv.Atoi(v1Str)
-	v2, err2 := strconv.Atoi(v2Str)
-
-	if err1 != nil || err2 != nil {
-		http.Error(w, "invalid version numbers", http.StatusBadRequest)
+	v2, ok := s.resolve(w, to)
+	if !ok {
 		return
 	}
 
@@ -777,6 +739,21 @@ func (s *Server) handleDiff(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(delta)
 }
 
+// resolve resolves a revision from a request, writing an error response if
+// it doesn't name a checkpoint
+func (s *Server) resolve(w http.ResponseWriter, rev string) (int, bool) {
+	version, err := revision.Resolve(s.database, rev)
+	if errors.Is(err, revision.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return 0, false
+	}
+	if err != nil {
+		http.Error(w, "invalid revision: "+err.Error(), http.StatusBadRequest)
+		return 0, false
+	}
+	return version, true
+}
+
 func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
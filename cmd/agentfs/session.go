@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	cpkg "github.com/sleexyz/agentfs/internal/checkpoint"
+	"github.com/sleexyz/agentfs/internal/context"
+	"github.com/sleexyz/agentfs/internal/db"
+	"github.com/sleexyz/agentfs/internal/diff"
+	"github.com/spf13/cobra"
+)
+
+var sessionCmd = &cobra.Command{
+	Use:   "session",
+	Short: "Inspect and undo agent sessions",
+	Long: `List, diff, and revert the work of agent sessions.
+
+Checkpoints created with 'checkpoint create --from-hook' record the Claude
+Code session_id they came from. A session can be named by its full ID or any
+unique prefix (the 8 characters shown in auto checkpoint messages).`,
+}
+
+var sessionListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List agent sessions",
+	Long:  `List the agent sessions that created checkpoints, most recently active first.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Resolve store
+		storePath, err := context.MustResolveStore(storeFlag, "")
+		if err != nil {
+			exitWithError(ExitUsageError, "%v", err)
+		}
+
+		// Get store info
+		s, err := storeManager.GetFromPath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		if s == nil {
+			exitWithError(ExitStoreNotFound, "store not found")
+		}
+
+		// Open per-store database
+		database, err := db.OpenFromStorePath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "failed to open database: %v", err)
+		}
+		defer database.Close()
+
+		cpManager := cpkg.NewManager(storeManager, database, s)
+
+		sessions, err := cpManager.ListSessions()
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+
+		if jsonFlag {
+			type sessionJSON struct {
+				ID          string `json:"id"`
+				Checkpoints int    `json:"checkpoints"`
+				First       string `json:"first"`
+				Last        string `json:"last"`
+				Base        *int   `json:"base_version"`
+				StartedAt   string `json:"started_at"`
+				EndedAt     string `json:"ended_at"`
+				DurationMs  int64  `json:"duration_ms"`
+			}
+
+			output := []sessionJSON{}
+			for _, sess := range sessions {
+				output = append(output, sessionJSON{
+					ID:          sess.ID,
+					Checkpoints: len(sess.Checkpoints),
+					First:       fmt.Sprintf("v%d", sess.First().Version),
+					Last:        fmt.Sprintf("v%d", sess.Last().Version),
+					Base:        sess.Base(),
+					StartedAt:   sess.First().CreatedAt.Format(time.RFC3339),
+					EndedAt:     sess.Last().CreatedAt.Format(time.RFC3339),
+					DurationMs:  sess.Duration().Milliseconds(),
+				})
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(output)
+			return
+		}
+
+		if len(sessions) == 0 {
+			fmt.Println("No sessions found. Checkpoints created with --from-hook record their session.")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SESSION\tCHECKPOINTS\tFIRST\tLAST\tSTARTED\tDURATION")
+		for _, sess := range sessions {
+			fmt.Fprintf(w, "%s\t%d\tv%d\tv%d\t%s\t%s\n",
+				shortSessionID(sess.ID),
+				len(sess.Checkpoints),
+				sess.First().Version,
+				sess.Last().Version,
+				humanize.Time(sess.First().CreatedAt),
+				sess.Duration().Round(time.Second),
+			)
+		}
+		w.Flush()
+	},
+}
+
+var sessionDiffCmd = &cobra.Command{
+	Use:   "diff <session> [-- <path>]",
+	Short: "Show the net change made by a session",
+	Long: `Show the net change made by an agent session: the diff from the checkpoint
+it started from (its first checkpoint's parent) to its last checkpoint.
+
+Usage:
+  agentfs session diff f55a4d56
+  agentfs session diff f55a4d56 --stat
+  agentfs session diff f55a4d56 -- src/app.ts`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Resolve store
+		storePath, err := context.MustResolveStore(storeFlag, "")
+		if err != nil {
+			exitWithError(ExitUsageError, "%v", err)
+		}
+
+		// Get store info
+		s, err := storeManager.GetFromPath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		if s == nil {
+			exitWithError(ExitStoreNotFound, "store not found")
+		}
+
+		// Open per-store database
+		database, err := db.OpenFromStorePath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "failed to open database: %v", err)
+		}
+		defer database.Close()
+
+		cpManager := cpkg.NewManager(storeManager, database, s)
+
+		sess := getSession(cpManager, args[0])
+		base := sessionBase(sess)
+
+		differ := diff.NewDiffer(storeManager, s)
+		if len(args) > 1 {
+			if err := differ.DiffFile(base, sess.Last().Version, args[1]); err != nil {
+				exitWithError(ExitError, "%v", err)
+			}
+			return
+		}
+
+		result, err := differ.Diff(base, sess.Last().Version)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+
+		switch {
+		case jsonFlag:
+			outputJSON(result)
+		case diffNameOnlyFlag:
+			outputNameOnly(result)
+		case diffStatFlag:
+			outputStat(result)
+		default:
+			outputDefault(result)
+		}
+	},
+}
+
+var sessionRevertCmd = &cobra.Command{
+	Use:   "revert <session>",
+	Short: "Restore the state from before a session",
+	Long: `Undo an agent session by restoring the checkpoint it started from (its
+first checkpoint's parent).
+
+The current state is first saved as a "pre-restore" checkpoint, so the
+session's work can be restored again.
+
+Requires confirmation unless -f/--force is specified.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Resolve store
+		storePath, err := context.MustResolveStore(storeFlag, "")
+		if err != nil {
+			exitWithError(ExitUsageError, "%v", err)
+		}
+
+		// Get store info
+		s, err := storeManager.GetFromPath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		if s == nil {
+			exitWithError(ExitStoreNotFound, "store not found")
+		}
+
+		// Open per-store database
+		database, err := db.OpenFromStorePath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "failed to open database: %v", err)
+		}
+		defer database.Close()
+
+		cpManager := cpkg.NewManager(storeManager, database, s)
+
+		sess := getSession(cpManager, args[0])
+		base := sessionBase(sess)
+
+		nextVersion := base + 1
+		if latest, _ := cpManager.GetLatest(); latest != nil {
+			nextVersion = latest.Version + 1
+		}
+
+		prompt := fmt.Sprintf("Revert session %s (%d checkpoints) by restoring v%d? Current state will be saved as v%d.",
+			shortSessionID(sess.ID), len(sess.Checkpoints), base, nextVersion)
+		if !confirmPrompt(prompt) {
+			fmt.Println("Cancelled")
+			return
+		}
+
+		lock := lockStore(storePath, false)
+		defer lock.Unlock()
+
+		cp, duration, err := cpManager.Restore(base, true)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+
+		if jsonFlag {
+			type revertJSON struct {
+				Session    string `json:"session"`
+				Version    string `json:"version"`
+				Message    string `json:"message,omitempty"`
+				DurationMs int64  `json:"duration_ms"`
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(revertJSON{
+				Session:    sess.ID,
+				Version:    fmt.Sprintf("v%d", cp.Version),
+				Message:    cp.Message,
+				DurationMs: duration.Milliseconds(),
+			})
+			return
+		}
+
+		output := fmt.Sprintf("Reverted session %s: restored v%d", shortSessionID(sess.ID), cp.Version)
+		if cp.Message != "" {
+			output += fmt.Sprintf(" %q", cp.Message)
+		}
+		output += fmt.Sprintf(" (%dms)", duration.Milliseconds())
+		fmt.Println(output)
+	},
+}
+
+// getSession looks up a session by ID or prefix, exiting if there is none
+func getSession(cpManager *cpkg.Manager, id string) *cpkg.Session {
+	sess, err := cpManager.GetSession(id)
+	if errors.Is(err, cpkg.ErrSessionNotFound) {
+		exitWithError(ExitCPNotFound, "%v", err)
+	}
+	if err != nil {
+		exitWithError(ExitError, "%v", err)
+	}
+	return sess
+}
+
+// sessionBase returns the version a session started from, exiting if it
+// started with the store's first checkpoint
+func sessionBase(sess *cpkg.Session) int {
+	base := sess.Base()
+	if base == nil {
+		exitWithError(ExitError, "session %s started with the store's first checkpoint v%d; there is no earlier state",
+			shortSessionID(sess.ID), sess.First().Version)
+	}
+	return *base
+}
+
+// shortSessionID returns the short form of a session ID used in messages
+func shortSessionID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+func init() {
+	sessionDiffCmd.Flags().BoolVar(&diffStatFlag, "stat", false, "show summary statistics only")
+	sessionDiffCmd.Flags().BoolVar(&diffNameOnlyFlag, "name-only", false, "just list changed file names")
+	sessionCmd.AddCommand(sessionListCmd)
+	sessionCmd.AddCommand(sessionDiffCmd)
+	sessionCmd.AddCommand(sessionRevertCmd)
+	rootCmd.AddCommand(sessionCmd)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	cpkg "github.com/sleexyz/agentfs/internal/checkpoint"
+	"github.com/sleexyz/agentfs/internal/context"
+	"github.com/sleexyz/agentfs/internal/db"
+	"github.com/spf13/cobra"
+)
+
+var squashMessageFlag string
+
+var squashCmd = &cobra.Command{
+	Use:   "squash <from> <to>",
+	Short: "Collapse a range of checkpoints into one",
+	Long: `Collapse the checkpoints from <from> to <to> into <to>.
+
+<from> must be an ancestor of <to>. <to> keeps its state and takes the new
+message and <from>'s parent; the checkpoints before it are deleted, and their
+messages are kept on <to> (see 'agentfs checkpoint info'). Checkpoints that
+forked from the deleted ones continue from <to>.
+
+Tagged checkpoints and branch heads can only end a range.
+
+Usage:
+  agentfs squash v12 v31 -m "Add OAuth login"
+  agentfs squash main~5 main -m "Refactor auth"`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if squashMessageFlag == "" {
+			exitWithError(ExitUsageError, "a message is required (-m)")
+		}
+
+		// Resolve store
+		storePath, err := context.MustResolveStore(storeFlag, "")
+		if err != nil {
+			exitWithError(ExitUsageError, "%v", err)
+		}
+
+		// Get store info
+		s, err := storeManager.GetFromPath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		if s == nil {
+			exitWithError(ExitStoreNotFound, "store not found")
+		}
+
+		// Open per-store database
+		database, err := db.OpenFromStorePath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "failed to open database: %v", err)
+		}
+		defer database.Close()
+
+		cpManager := cpkg.NewManager(storeManager, database, s)
+
+		lock := lockStore(storePath, false)
+		defer lock.Unlock()
+
+		from := resolveRevision(database, args[0])
+		to := resolveRevision(database, args[1])
+
+		result, err := cpManager.Squash(from, to, squashMessageFlag)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+
+		if jsonFlag {
+			type squashJSON struct {
+				Version       string   `json:"version"`
+				Message       string   `json:"message"`
+				ParentVersion *int     `json:"parent_version"`
+				Deleted       []string `json:"deleted"`
+				Reparented    []string `json:"reparented,omitempty"`
+			}
+
+			output := squashJSON{
+				Version:       fmt.Sprintf("v%d", result.Checkpoint.Version),
+				Message:       result.Checkpoint.Message,
+				ParentVersion: result.Checkpoint.ParentVersion,
+				Deleted:       []string{},
+			}
+			for _, cp := range result.Deleted {
+				output.Deleted = append(output.Deleted, fmt.Sprintf("v%d", cp.Version))
+			}
+			for _, v := range result.Reparented {
+				output.Reparented = append(output.Reparented, fmt.Sprintf("v%d", v))
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(output)
+			return
+		}
+
+		fmt.Printf("Squashed v%d..v%d into v%d %q (deleted %d checkpoints)\n",
+			from, to, to, result.Checkpoint.Message, len(result.Deleted))
+		for _, v := range result.Reparented {
+			fmt.Printf("v%d now continues from v%d\n", v, to)
+		}
+	},
+}
+
+func init() {
+	squashCmd.Flags().StringVarP(&squashMessageFlag, "message", "m", "", "message for the squashed checkpoint")
+	rootCmd.AddCommand(squashCmd)
+}
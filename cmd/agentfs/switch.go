@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	cpkg "github.com/sleexyz/agentfs/internal/checkpoint"
+	"github.com/sleexyz/agentfs/internal/context"
+	"github.com/sleexyz/agentfs/internal/db"
+	"github.com/spf13/cobra"
+)
+
+var switchCreateFlag bool
+
+var switchCmd = &cobra.Command{
+	Use:   "switch <branch>",
+	Short: "Switch to another branch",
+	Long: `Make another branch current and restore its head.
+
+Changes since the current branch's head are first saved on the current
+branch as a "pre-switch" checkpoint, so nothing is lost.
+
+Usage:
+  agentfs switch approach-b         # Switch to an existing branch
+  agentfs switch -c approach-b      # Create a branch here and switch to it
+  agentfs switch -c approach-b v3   # Create a branch at v3 and switch to it`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) > 1 && !switchCreateFlag {
+			exitWithError(ExitUsageError, "a revision can only be given with -c/--create")
+		}
+
+		// Resolve store
+		storePath, err := context.MustResolveStore(storeFlag, "")
+		if err != nil {
+			exitWithError(ExitUsageError, "%v", err)
+		}
+
+		// Get store info
+		s, err := storeManager.GetFromPath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		if s == nil {
+			exitWithError(ExitStoreNotFound, "store not found")
+		}
+
+		// Open per-store database
+		database, err := db.OpenFromStorePath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "failed to open database: %v", err)
+		}
+		defer database.Close()
+
+		cpManager := cpkg.NewManager(storeManager, database, s)
+
+		lock := lockStore(storePath, false)
+		defer lock.Unlock()
+
+		if switchCreateFlag {
+			createBranch(cpManager, database, args)
+		}
+
+		result, err := cpManager.Switch(args[0])
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+
+		if jsonFlag {
+			type switchJSON struct {
+				Branch     string `json:"branch"`
+				Head       string `json:"head,omitempty"`
+				Saved      string `json:"saved,omitempty"`
+				DurationMs int64  `json:"duration_ms"`
+			}
+
+			output := switchJSON{
+				Branch:     result.Branch.Name,
+				DurationMs: result.Duration.Milliseconds(),
+			}
+			if result.Branch.HeadVersion != nil {
+				output.Head = fmt.Sprintf("v%d", *result.Branch.HeadVersion)
+			}
+			if result.Saved != nil {
+				output.Saved = fmt.Sprintf("v%d", result.Saved.Version)
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(output)
+			return
+		}
+
+		if result.Saved != nil {
+			fmt.Printf("Saved changes on %s as v%d \"pre-switch\"\n", result.Saved.Branch, result.Saved.Version)
+		}
+		output := fmt.Sprintf("Switched to branch %s", result.Branch.Name)
+		if result.Branch.HeadVersion != nil {
+			output += fmt.Sprintf(" at v%d", *result.Branch.HeadVersion)
+		}
+		output += fmt.Sprintf(" (%dms)", result.Duration.Milliseconds())
+		fmt.Println(output)
+	},
+}
+
+func init() {
+	switchCmd.Flags().BoolVarP(&switchCreateFlag, "create", "c", false, "create the branch first")
+	rootCmd.AddCommand(switchCmd)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	cpkg "github.com/sleexyz/agentfs/internal/checkpoint"
+	"github.com/sleexyz/agentfs/internal/context"
+	"github.com/sleexyz/agentfs/internal/db"
+	"github.com/spf13/cobra"
+)
+
+var tagDeleteFlag bool
+var tagListFlag bool
+
+var tagCmd = &cobra.Command{
+	Use:   "tag [name] [revision]",
+	Short: "Name checkpoints",
+	Long: `Create, delete, or list tags: names for checkpoints.
+
+Tags can be used anywhere a version is expected (restore, diff,
+checkpoint info, checkpoint delete).
+
+Usage:
+  agentfs tag green-tests        # Tag the latest checkpoint
+  agentfs tag before-migration v3  # Tag v3
+  agentfs tag known-good latest~2  # Tag the latest checkpoint's grandparent
+  agentfs tag -f green-tests v5  # Move an existing tag
+  agentfs tag -d green-tests     # Delete a tag
+  agentfs tag --list             # List tags (also: agentfs tag)
+
+A tag is deleted along with its checkpoint.`,
+	Args: cobra.MaximumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if tagListFlag && len(args) > 0 {
+			exitWithError(ExitUsageError, "--list takes no arguments")
+		}
+		if tagDeleteFlag && len(args) != 1 {
+			exitWithError(ExitUsageError, "--delete takes exactly one tag name")
+		}
+
+		// Resolve store
+		storePath, err := context.MustResolveStore(storeFlag, "")
+		if err != nil {
+			exitWithError(ExitUsageError, "%v", err)
+		}
+
+		// Get store info
+		s, err := storeManager.GetFromPath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		if s == nil {
+			exitWithError(ExitStoreNotFound, "store not found")
+		}
+
+		// Open per-store database
+		database, err := db.OpenFromStorePath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "failed to open database: %v", err)
+		}
+		defer database.Close()
+
+		cpManager := cpkg.NewManager(storeManager, database, s)
+
+		if len(args) == 0 {
+			listTags(cpManager)
+			return
+		}
+		name := args[0]
+
+		lock := lockStore(storePath, false)
+		defer lock.Unlock()
+
+		if tagDeleteFlag {
+			version, err := cpManager.Untag(name)
+			if err != nil {
+				exitWithError(ExitError, "%v", err)
+			}
+			fmt.Printf("Deleted tag %s (was v%d)\n", name, version)
+			return
+		}
+
+		var version int
+		if len(args) > 1 {
+			version = resolveRevision(database, args[1])
+		} else {
+			latest, err := cpManager.GetLatest()
+			if err != nil {
+				exitWithError(ExitError, "%v", err)
+			}
+			if latest == nil {
+				exitWithError(ExitCPNotFound, "no checkpoints to tag")
+			}
+			version = latest.Version
+		}
+
+		if err := cpManager.Tag(name, version, forceFlag); err != nil {
+			if errors.Is(err, db.ErrTagExists) {
+				exitWithError(ExitError, "tag %s already exists (use -f to move it)", name)
+			}
+			exitWithError(ExitError, "%v", err)
+		}
+
+		if jsonFlag {
+			type tagJSON struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(tagJSON{Name: name, Version: fmt.Sprintf("v%d", version)})
+			return
+		}
+
+		fmt.Printf("Tagged v%d as %s\n", version, name)
+	},
+}
+
+// listTags prints all tags with the checkpoint each points at
+func listTags(cpManager *cpkg.Manager) {
+	tags, err := cpManager.ListTags()
+	if err != nil {
+		exitWithError(ExitError, "%v", err)
+	}
+
+	if jsonFlag {
+		type tagJSON struct {
+			Name      string `json:"name"`
+			Version   string `json:"version"`
+			Message   string `json:"message,omitempty"`
+			CreatedAt string `json:"created_at"`
+		}
+
+		output := []tagJSON{}
+		for _, t := range tags {
+			tj := tagJSON{
+				Name:      t.Name,
+				Version:   fmt.Sprintf("v%d", t.Version),
+				CreatedAt: t.CreatedAt.Format(time.RFC3339),
+			}
+			if cp, _ := cpManager.Get(t.Version); cp != nil {
+				tj.Message = cp.Message
+			}
+			output = append(output, tj)
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(output)
+		return
+	}
+
+	if len(tags) == 0 {
+		fmt.Println("No tags. Use 'agentfs tag <name>' to tag the latest checkpoint.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TAG\tVERSION\tMESSAGE")
+	for _, t := range tags {
+		message := ""
+		if cp, _ := cpManager.Get(t.Version); cp != nil {
+			message = cp.Message
+		}
+		if len(message) > 40 {
+			message = message[:37] + "..."
+		}
+		fmt.Fprintf(w, "%s\tv%d\t%s\n", t.Name, t.Version, message)
+	}
+	w.Flush()
+}
+
+func init() {
+	tagCmd.Flags().BoolVarP(&tagDeleteFlag, "delete", "d", false, "delete the named tag")
+	tagCmd.Flags().BoolVarP(&tagListFlag, "list", "l", false, "list tags")
+	tagCmd.MarkFlagsMutuallyExclusive("delete", "list")
+	rootCmd.AddCommand(tagCmd)
+}
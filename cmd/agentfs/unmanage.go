@@ -89,7 +89,7 @@ func runUnmanage(dirPath, storePath string) {
 	}
 
 	// Check if mounted
-	if !storeManager.IsMounted(dirPath) {
+	if !storeManager.IsMounted(s) {
 		exitWithError(ExitError, "store not mounted. Mount first with 'agentfs mount' or delete with 'agentfs delete'")
 	}
 
@@ -115,6 +115,9 @@ func runUnmanage(dirPath, storePath string) {
 		return
 	}
 
+	lock := lockStore(storePath, false)
+	defer lock.Unlock()
+
 	// === COPY OUT ===
 	fmt.Println("Copying files out...")
 
@@ -154,16 +157,12 @@ func runUnmanage(dirPath, storePath string) {
 	// === UNMOUNT ===
 	fmt.Println("Unmounting store...")
 
-	cmd = exec.Command("hdiutil", "detach", dirPath)
-	output, err = cmd.CombinedOutput()
-	if err != nil {
+	// Unmount also removes the mount point directory (should be empty after unmount)
+	if err := storeManager.UnmountAt(s, dirPath); err != nil {
 		os.RemoveAll(tempDir)
-		exitWithError(ExitError, "failed to unmount: %v\n%s", err, output)
+		exitWithError(ExitError, "%v", err)
 	}
 
-	// Remove mount point directory (should be empty after unmount)
-	os.Remove(dirPath)
-
 	// === RESTORE ===
 	fmt.Println("Restoring files...")
 
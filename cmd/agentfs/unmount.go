@@ -47,8 +47,11 @@ Examples:
 			exitWithError(ExitStoreNotFound, "store not found")
 		}
 
+		lock := lockStore(storePath, false)
+		defer lock.Unlock()
+
 		// Check if mounted
-		if !storeManager.IsMounted(s.MountPath) {
+		if !storeManager.IsMounted(s) {
 			fmt.Printf("Store '%s' is not mounted\n", s.Name)
 			return
 		}
@@ -92,13 +95,16 @@ func unmountAll() {
 		}
 
 		// Check if mounted
-		if !storeManager.IsMounted(s.MountPath) {
+		if !storeManager.IsMounted(s) {
 			continue
 		}
 
 		// Unmount the store
 		fmt.Printf("Unmounting %s... ", filepath.Base(regStore.StorePath))
-		if err := storeManager.Unmount(s); err != nil {
+		lock := lockStore(s.StorePath, false)
+		err = storeManager.Unmount(s)
+		lock.Unlock()
+		if err != nil {
 			fmt.Printf("failed: %v\n", err)
 			continue
 		}
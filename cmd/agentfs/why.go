@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	cpkg "github.com/sleexyz/agentfs/internal/checkpoint"
+	"github.com/sleexyz/agentfs/internal/context"
+	"github.com/sleexyz/agentfs/internal/db"
+	"github.com/sleexyz/agentfs/internal/diff"
+	"github.com/spf13/cobra"
+)
+
+var whyCmd = &cobra.Command{
+	Use:   "why <path>",
+	Short: "Show which agent tool calls changed a file",
+	Long: `List the agent tool calls that changed a file, or any file under a
+directory, newest first.
+
+Tool calls are recorded when 'agentfs checkpoint create --auto --from-hook'
+runs from both PreToolUse and PostToolUse hooks; each call's changes are
+found by comparing the checkpoints taken before and after it.
+
+The path may be absolute or relative to the current directory (inside the
+store), or relative to the store root.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Resolve store
+		storePath, err := context.MustResolveStore(storeFlag, "")
+		if err != nil {
+			exitWithError(ExitUsageError, "%v", err)
+		}
+
+		// Get store info
+		s, err := storeManager.GetFromPath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+		if s == nil {
+			exitWithError(ExitStoreNotFound, "store not found")
+		}
+
+		// Open per-store database
+		database, err := db.OpenFromStorePath(storePath)
+		if err != nil {
+			exitWithError(ExitError, "failed to open database: %v", err)
+		}
+		defer database.Close()
+
+		cpManager := cpkg.NewManager(storeManager, database, s)
+
+		path, err := storeRelativePath(s.MountPath, args[0])
+		if err != nil {
+			exitWithError(ExitUsageError, "%v", err)
+		}
+
+		// Why reads snapshots and records what it finds
+		lock := lockStore(storePath, false)
+		defer lock.Unlock()
+
+		attributions, err := cpManager.Why(path)
+		if err != nil {
+			exitWithError(ExitError, "%v", err)
+		}
+
+		if jsonFlag {
+			type changeJSON struct {
+				Path string `json:"path"`
+				Type string `json:"type"`
+			}
+			type callJSON struct {
+				ToolUseID string       `json:"tool_use_id"`
+				SessionID string       `json:"session_id,omitempty"`
+				ToolName  string       `json:"tool_name,omitempty"`
+				Input     string       `json:"input,omitempty"`
+				Before    string       `json:"before"`
+				After     string       `json:"after"`
+				StartedAt string       `json:"started_at"`
+				Changes   []changeJSON `json:"changes"`
+			}
+
+			output := []callJSON{}
+			for _, a := range attributions {
+				call := callJSON{
+					ToolUseID: a.Call.ID,
+					SessionID: a.Call.SessionID,
+					ToolName:  a.Call.ToolName,
+					Input:     a.Call.Input,
+					Before:    fmt.Sprintf("v%d", a.Call.Before),
+					After:     fmt.Sprintf("v%d", *a.Call.After),
+					StartedAt: a.Call.StartedAt.Format(time.RFC3339),
+				}
+				for _, c := range a.Changes {
+					call.Changes = append(call.Changes, changeJSON{
+						Path: c.Path,
+						Type: strings.ToLower(c.Type.String()),
+					})
+				}
+				output = append(output, call)
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(output)
+			return
+		}
+
+		if len(attributions) == 0 {
+			calls, err := cpManager.ListToolCalls()
+			if err != nil {
+				exitWithError(ExitError, "%v", err)
+			}
+			if len(calls) == 0 {
+				fmt.Println("No tool calls recorded. Run 'agentfs checkpoint create --auto --from-hook' from PreToolUse and PostToolUse hooks to record them.")
+				return
+			}
+			fmt.Printf("No recorded tool call changed %s\n", path)
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CHECKPOINTS\tTOOL\tINPUT\tSESSION\tWHEN\tCHANGES")
+		for _, a := range attributions {
+			fmt.Fprintf(w, "v%d → v%d\t%s\t%s\t%s\t%s\t%s\n",
+				a.Call.Before,
+				*a.Call.After,
+				a.Call.ToolName,
+				toolInputSummary(a.Call.Input),
+				shortSessionID(a.Call.SessionID),
+				humanize.Time(a.Call.StartedAt),
+				changesSummary(a.Changes),
+			)
+		}
+		w.Flush()
+	},
+}
+
+// storeRelativePath returns arg relative to the store root at mountPath.
+// Absolute paths and paths given from inside the store are resolved against
+// it; others are taken as relative to the root already.
+func storeRelativePath(mountPath, arg string) (string, error) {
+	path := arg
+	if !filepath.IsAbs(path) {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return filepath.Clean(arg), nil
+		}
+		if rel, err := filepath.Rel(mountPath, cwd); err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+			return filepath.Clean(arg), nil
+		}
+		path = filepath.Join(cwd, path)
+	}
+
+	rel, err := filepath.Rel(mountPath, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("%s is outside the store (%s)", arg, mountPath)
+	}
+	return rel, nil
+}
+
+// toolInputSummary shortens a tool's command or file path for a table cell
+func toolInputSummary(input string) string {
+	if strings.HasPrefix(input, "/") {
+		return filepath.Base(input)
+	}
+	if len(input) > 40 {
+		input = input[:37] + "..."
+	}
+	return input
+}
+
+// changesSummary describes a tool call's changes in a few characters
+func changesSummary(changes []diff.Change) string {
+	if len(changes) == 1 {
+		return fmt.Sprintf("%s %s", changes[0].Type.String()[:1], changes[0].Path)
+	}
+	return fmt.Sprintf("%d files", len(changes))
+}
+
+func init() {
+	rootCmd.AddCommand(whyCmd)
+}
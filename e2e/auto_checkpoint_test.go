@@ -0,0 +1,47 @@
+package e2e
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestAutoCheckpoint_DetectsSameSizeEdit tests that --auto skips unchanged stores
+// but catches edits that don't change any band's size
+func TestAutoCheckpoint_DetectsSameSizeEdit(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.CreateStore("test-auto")
+
+	if output, err := h.RunAgentFSInStore("checkpoint", "create", "--auto"); err != nil {
+		t.Fatalf("failed to create auto checkpoint: %v\n%s", err, output)
+	}
+
+	// No changes: nothing new
+	if output, err := h.RunAgentFSInStore("checkpoint", "create", "--auto"); err != nil {
+		t.Fatalf("failed to run auto checkpoint: %v\n%s", err, output)
+	}
+	checkpoints, err := h.ListCheckpoints()
+	if err != nil {
+		t.Fatalf("failed to list checkpoints: %v", err)
+	}
+	if len(checkpoints) != 1 {
+		t.Fatalf("expected 1 checkpoint without changes, got %d", len(checkpoints))
+	}
+
+	// Rewrite a file with content of the same length
+	if err := os.WriteFile(filepath.Join(h.mountDir, "test.txt"), []byte("TEST CONTENT"), 0644); err != nil {
+		t.Fatalf("failed to modify file: %v", err)
+	}
+	if output, err := h.RunAgentFSInStore("checkpoint", "create", "--auto"); err != nil {
+		t.Fatalf("failed to run auto checkpoint: %v\n%s", err, output)
+	}
+	checkpoints, err = h.ListCheckpoints()
+	if err != nil {
+		t.Fatalf("failed to list checkpoints: %v", err)
+	}
+	if len(checkpoints) != 2 {
+		t.Errorf("expected same-size edit to create a checkpoint, got %d checkpoints", len(checkpoints))
+	}
+}
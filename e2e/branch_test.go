@@ -0,0 +1,103 @@
+package e2e
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestBranches_SwitchKeepsLinesSeparate tests that checkpoints follow the current branch's head
+func TestBranches_SwitchKeepsLinesSeparate(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.CreateStore("test-branches")
+	testFile := filepath.Join(h.mountDir, "approach.txt")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+	expectParent := func(cp *checkpointJSON, parent int, branch string) {
+		t.Helper()
+		if cp.ParentVersion == nil || *cp.ParentVersion != parent {
+			t.Errorf("expected %s parent_version to be %d, got %v", cp.Version, parent, cp.ParentVersion)
+		}
+		if cp.Branch != branch {
+			t.Errorf("expected %s on branch %s, got %q", cp.Version, branch, cp.Branch)
+		}
+	}
+
+	write("base")
+	if _, err := h.CreateCheckpoint("base"); err != nil {
+		t.Fatalf("failed to create v1: %v", err)
+	}
+	write("approach a")
+	if _, err := h.CreateCheckpoint("approach a"); err != nil {
+		t.Fatalf("failed to create v2: %v", err)
+	}
+
+	// Branch from v1 and try another approach (switch unmounts, so run it from outside the store)
+	if output, err := h.RunAgentFS("switch", "--store", h.storeDir, "-c", "approach-b", "v1"); err != nil {
+		t.Fatalf("switch -c failed: %v\n%s", err, output)
+	}
+	if content, _ := os.ReadFile(testFile); string(content) != "base" {
+		t.Errorf("expected approach-b to start from v1, got %q", content)
+	}
+	write("approach b")
+	cp3, err := h.CreateCheckpoint("approach b")
+	if err != nil {
+		t.Fatalf("failed to create v3: %v", err)
+	}
+	expectParent(cp3, 1, "approach-b")
+
+	// Unsaved work is checkpointed on approach-b before switching back
+	write("approach b, unsaved")
+	if output, err := h.RunAgentFS("switch", "--store", h.storeDir, "main"); err != nil {
+		t.Fatalf("switch failed: %v\n%s", err, output)
+	}
+	if content, _ := os.ReadFile(testFile); string(content) != "approach a" {
+		t.Errorf("expected main's head after switch, got %q", content)
+	}
+	saved, err := h.GetCheckpointInfo("approach-b")
+	if err != nil {
+		t.Fatalf("checkpoint info by branch failed: %v", err)
+	}
+	if saved.Version != "v4" || saved.Message != "pre-switch" {
+		t.Errorf("expected approach-b's head to be v4 \"pre-switch\", got %s %q", saved.Version, saved.Message)
+	}
+	expectParent(saved, 3, "approach-b")
+
+	// main continues from its own head, not the latest checkpoint
+	write("approach a, continued")
+	cp5, err := h.CreateCheckpoint("approach a, continued")
+	if err != nil {
+		t.Fatalf("failed to create v5: %v", err)
+	}
+	expectParent(cp5, 2, "main")
+
+	output, err := h.RunAgentFSInStore("branch", "--json")
+	if err != nil {
+		t.Fatalf("branch list failed: %v\n%s", err, output)
+	}
+	var branches []struct {
+		Name    string `json:"name"`
+		Head    string `json:"head"`
+		Current bool   `json:"current"`
+	}
+	if err := json.Unmarshal([]byte(output), &branches); err != nil {
+		t.Fatalf("failed to parse branch list: %v\n%s", err, output)
+	}
+	heads := map[string]string{}
+	for _, b := range branches {
+		heads[b.Name] = b.Head
+		if b.Current != (b.Name == "main") {
+			t.Errorf("expected only main to be current, got %+v", b)
+		}
+	}
+	if heads["main"] != "v5" || heads["approach-b"] != "v4" {
+		t.Errorf("expected heads main=v5 approach-b=v4, got %v", heads)
+	}
+}
@@ -16,6 +16,8 @@ type checkpointJSON struct {
 	CreatedAt     string `json:"created_at"`
 	DurationMs    int64  `json:"duration_ms,omitempty"`
 	ParentVersion *int   `json:"parent_version"`
+	MergeParent   *int   `json:"merge_parent,omitempty"`
+	Branch        string `json:"branch,omitempty"`
 }
 
 // TestHelper provides utilities for e2e tests
@@ -85,9 +87,11 @@ func findProjectDir() (string, error) {
 func (h *TestHelper) Cleanup() {
 	h.t.Helper()
 
-	// Unmount if mounted
-	if h.mountDir != "" {
-		exec.Command("hdiutil", "detach", h.mountDir).Run()
+	// Unmount if mounted (through agentfs so every backend is handled)
+	if h.storeDir != "" {
+		cmd := exec.Command(h.agentfsBin, "unmount", "--store", h.storeDir)
+		cmd.Dir = h.tempDir
+		cmd.Run()
 	}
 
 	// Remove temp directory
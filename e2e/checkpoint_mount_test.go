@@ -0,0 +1,88 @@
+package e2e
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestCheckpoint_MountUnmount tests that a checkpoint can be browsed at its
+// own path, next to an unchanged working copy, until it is unmounted
+func TestCheckpoint_MountUnmount(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.CreateStore("test-cp-mount")
+
+	file := filepath.Join(h.mountDir, "app.txt")
+	if err := os.WriteFile(file, []byte("old"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	h.CreateCheckpoint("old state")
+	if err := os.WriteFile(file, []byte("new"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	h.CreateCheckpoint("new state")
+
+	output, err := h.RunAgentFSInStore("checkpoint", "mount", "v1")
+	if err != nil {
+		t.Fatalf("checkpoint mount failed: %v\n%s", err, output)
+	}
+	defer h.RunAgentFSInStore("checkpoint", "unmount")
+
+	view := h.mountDir + "@v1"
+	if content, err := os.ReadFile(filepath.Join(view, "app.txt")); err != nil || string(content) != "old" {
+		t.Errorf("expected the mount to show v1, got %q (err: %v)", content, err)
+	}
+	if content, _ := os.ReadFile(file); string(content) != "new" {
+		t.Errorf("expected the working copy to be untouched, got %q", content)
+	}
+
+	custom := filepath.Join(h.tempDir, "latest-view")
+	if output, err := h.RunAgentFSInStore("checkpoint", "mount", "latest", custom); err != nil {
+		t.Fatalf("checkpoint mount at a path failed: %v\n%s", err, output)
+	}
+	if output, err := h.RunAgentFSInStore("checkpoint", "mount", "v1"); err == nil {
+		t.Errorf("expected mounting over an existing mount to fail, got: %s", output)
+	}
+	if output, err := h.RunAgentFSInStore("checkpoint", "mount", "v1", filepath.Join(h.mountDir, "..view")); err == nil {
+		t.Errorf("expected mounting inside the working copy to fail, got: %s", output)
+	}
+
+	output, err = h.RunAgentFSInStore("checkpoint", "mount", "--json")
+	if err != nil {
+		t.Fatalf("listing mounts failed: %v\n%s", err, output)
+	}
+	var mounts []struct {
+		Version string `json:"version"`
+		Path    string `json:"path"`
+	}
+	if err := json.Unmarshal([]byte(output), &mounts); err != nil {
+		t.Fatalf("failed to parse mounts: %v\n%s", err, output)
+	}
+	if len(mounts) != 2 || mounts[0].Path != view || mounts[1].Version != "v2" || mounts[1].Path != custom {
+		t.Errorf("expected v1 at %s and v2 at %s, got %+v", view, custom, mounts)
+	}
+
+	// Unmount by revision, then everything else
+	if output, err := h.RunAgentFSInStore("checkpoint", "unmount", "v1"); err != nil {
+		t.Fatalf("checkpoint unmount failed: %v\n%s", err, output)
+	}
+	if _, err := os.Stat(view); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed, got err %v", view, err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(custom, "app.txt")); string(content) != "new" {
+		t.Errorf("expected the other mount to stay, got %q", content)
+	}
+
+	if output, err := h.RunAgentFSInStore("checkpoint", "unmount"); err != nil {
+		t.Fatalf("checkpoint unmount of all failed: %v\n%s", err, output)
+	}
+	if _, err := os.Stat(custom); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed, got err %v", custom, err)
+	}
+	if output, _ := h.RunAgentFSInStore("checkpoint", "mount"); output != "No checkpoints mounted\n" {
+		t.Errorf("expected no mounts left, got: %s", output)
+	}
+}
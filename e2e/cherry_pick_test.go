@@ -0,0 +1,145 @@
+package e2e
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCherryPick_Checkpoint tests that cherry-picking replays one
+// checkpoint's changes onto the working copy, patching text files changed
+// since and reporting conflicts
+func TestCherryPick_Checkpoint(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.CreateStore("test-cherry-pick")
+
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(h.mountDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	read := func(name string) string {
+		t.Helper()
+		content, err := os.ReadFile(filepath.Join(h.mountDir, name))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		return string(content)
+	}
+	cherryPick := func(revision string, conflicts bool) (result struct {
+		Parent    string   `json:"parent"`
+		Applied   []string `json:"applied"`
+		Merged    []string `json:"merged"`
+		Conflicts []struct {
+			Path string `json:"path"`
+			Kind string `json:"kind"`
+		} `json:"conflicts"`
+		PreCherryPick string `json:"pre_cherry_pick"`
+		Checkpoint    string `json:"checkpoint"`
+	}) {
+		t.Helper()
+		output, err := h.RunAgentFSInStore("cherry-pick", revision, "--json")
+		if (err != nil) != conflicts {
+			t.Fatalf("cherry-pick %s: expected failure %v, got %v\n%s", revision, conflicts, err, output)
+		}
+		if err := json.Unmarshal([]byte(output), &result); err != nil {
+			t.Fatalf("failed to parse cherry-pick output: %v\n%s", err, output)
+		}
+		return result
+	}
+
+	write("app.txt", "one\ntwo\nthree\nfour\nfive\n")
+	write("old.txt", "old")
+	h.CreateCheckpoint("base")
+
+	write("app.txt", "BROKEN\ntwo\nthree\nfour\nfive\n")
+	h.CreateCheckpoint("bad change")
+
+	write("app.txt", "BROKEN\ntwo\nthree\nfour\nFIVE\n")
+	write("new.txt", "good")
+	if err := os.Remove(filepath.Join(h.mountDir, "old.txt")); err != nil {
+		t.Fatalf("failed to remove old.txt: %v", err)
+	}
+	h.CreateCheckpoint("good change")
+
+	if err := h.RestoreCheckpoint("v1"); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	write("app.txt", "uno\ntwo\nthree\nfour\nfive\n")
+
+	// Only v3's changes are replayed, on top of the unsaved edit
+	result := cherryPick("v3", false)
+	if result.Parent != "v2" {
+		t.Errorf("expected changes relative to v2, got %s", result.Parent)
+	}
+	if strings.Join(result.Applied, ",") != "new.txt,old.txt" {
+		t.Errorf("expected new.txt and old.txt to be applied, got %v", result.Applied)
+	}
+	if strings.Join(result.Merged, ",") != "app.txt" {
+		t.Errorf("expected app.txt to be patched, got %v", result.Merged)
+	}
+	if result.PreCherryPick == "" || result.Checkpoint == "" {
+		t.Errorf("expected pre-cherry-pick and result checkpoints, got %q and %q", result.PreCherryPick, result.Checkpoint)
+	}
+
+	if got := read("app.txt"); got != "uno\ntwo\nthree\nfour\nFIVE\n" {
+		t.Errorf("expected v3's edit patched into app.txt, got %q", got)
+	}
+	if got := read("new.txt"); got != "good" {
+		t.Errorf("expected new.txt from v3, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(h.mountDir, "old.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected old.txt to be deleted, got err %v", err)
+	}
+
+	cp, err := h.GetCheckpointInfo(result.Checkpoint)
+	if err != nil {
+		t.Fatalf("checkpoint info failed: %v", err)
+	}
+	if cp.Message != "cherry-pick v3" {
+		t.Errorf("expected the result to describe the cherry-pick, got %q", cp.Message)
+	}
+
+	// The saved unsaved changes are a restore point
+	output, err := h.RunAgentFSInStore("log", "--json")
+	if err != nil {
+		t.Fatalf("log failed: %v\n%s", err, output)
+	}
+	var entries []struct {
+		Version      string `json:"version"`
+		RestorePoint bool   `json:"restore_point"`
+	}
+	if err := json.Unmarshal([]byte(output), &entries); err != nil {
+		t.Fatalf("failed to parse log output: %v\n%s", err, output)
+	}
+	for _, e := range entries {
+		if e.Version == result.PreCherryPick && !e.RestorePoint {
+			t.Errorf("expected %s \"pre-cherry-pick\" to be a restore point", e.Version)
+		}
+	}
+
+	// Picking the same changes again changes nothing
+	if again := cherryPick("v3", false); len(again.Applied) != 0 || len(again.Conflicts) != 0 {
+		t.Errorf("expected v3 to be already applied, got %+v", again)
+	}
+	if got := read("app.txt"); got != "uno\ntwo\nthree\nfour\nFIVE\n" {
+		t.Errorf("expected app.txt unchanged by the second cherry-pick, got %q", got)
+	}
+
+	// v2 edits the line changed here too
+	conflict := cherryPick("v2", true)
+	if len(conflict.Conflicts) != 1 || conflict.Conflicts[0].Path != "app.txt" || conflict.Conflicts[0].Kind != "text" {
+		t.Errorf("expected a text conflict in app.txt, got %+v", conflict.Conflicts)
+	}
+	if got := read("app.txt"); !strings.Contains(got, "<<<<<<<") || !strings.Contains(got, "uno\n") || !strings.Contains(got, "BROKEN\n") {
+		t.Errorf("expected conflict markers in app.txt, got %q", got)
+	}
+	if conflict.Checkpoint == "" {
+		t.Errorf("expected the conflicted result to be checkpointed")
+	}
+}
@@ -0,0 +1,125 @@
+package e2e
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// TestDirBackend_RestoreRoundTrip tests checkpoint and restore on the mountless dir backend
+func TestDirBackend_RestoreRoundTrip(t *testing.T) {
+	t.Setenv("AGENTFS_BACKEND", "dir")
+
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.CreateStore("test-dir")
+
+	// The store keeps objects instead of a volume
+	if _, err := os.Stat(filepath.Join(h.storeDir, "objects")); err != nil {
+		t.Fatalf("expected objects directory: %v", err)
+	}
+
+	// Add a nested file and checkpoint
+	nested := filepath.Join(h.mountDir, "sub", "nested.txt")
+	if err := os.MkdirAll(filepath.Dir(nested), 0755); err != nil {
+		t.Fatalf("failed to create subdirectory: %v", err)
+	}
+	if err := os.WriteFile(nested, []byte("v1"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	cp1, err := h.CreateCheckpoint("first")
+	if err != nil {
+		t.Fatalf("failed to create checkpoint: %v", err)
+	}
+
+	// Modify, add and delete files
+	if err := os.WriteFile(filepath.Join(h.mountDir, "test.txt"), []byte("changed"), 0644); err != nil {
+		t.Fatalf("failed to modify file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(h.mountDir, "added.txt"), []byte("new"), 0644); err != nil {
+		t.Fatalf("failed to add file: %v", err)
+	}
+	if err := os.RemoveAll(filepath.Join(h.mountDir, "sub")); err != nil {
+		t.Fatalf("failed to delete directory: %v", err)
+	}
+
+	if err := h.RestoreCheckpoint(cp1.Version); err != nil {
+		t.Fatalf("failed to restore: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(h.mountDir, "test.txt"))
+	if err != nil || string(content) != "test content" {
+		t.Errorf("test.txt not restored: %q, %v", content, err)
+	}
+	content, err = os.ReadFile(nested)
+	if err != nil || string(content) != "v1" {
+		t.Errorf("sub/nested.txt not restored: %q, %v", content, err)
+	}
+	if _, err := os.Stat(filepath.Join(h.mountDir, "added.txt")); !os.IsNotExist(err) {
+		t.Errorf("added.txt should have been removed by restore")
+	}
+}
+
+// TestDirBackend_MountReadOnly tests that a checkpoint mounted with the dir
+// backend, a plain copy, can't be written to
+func TestDirBackend_MountReadOnly(t *testing.T) {
+	t.Setenv("AGENTFS_BACKEND", "dir")
+
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.CreateStore("test-dir-mount")
+	if err := os.MkdirAll(filepath.Join(h.mountDir, "sub"), 0755); err != nil {
+		t.Fatalf("failed to create subdirectory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(h.mountDir, "sub", "nested.txt"), []byte("v1"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	h.CreateCheckpoint("first")
+
+	view := filepath.Join(h.tempDir, "view")
+	if output, err := h.RunAgentFSInStore("checkpoint", "mount", "v1", view); err != nil {
+		t.Fatalf("checkpoint mount failed: %v\n%s", err, output)
+	}
+
+	// Root ignores permission bits, so as root hand the mount to an
+	// unprivileged user and write as that user
+	const nobody = 65534
+	if os.Geteuid() == 0 {
+		if err := os.Chmod(h.tempDir, 0755); err != nil {
+			t.Fatalf("failed to open up the temp directory: %v", err)
+		}
+		filepath.Walk(view, func(path string, info os.FileInfo, err error) error {
+			if err == nil {
+				err = os.Lchown(path, nobody, nobody)
+			}
+			return err
+		})
+	}
+	write := func(path string) error {
+		if os.Geteuid() != 0 {
+			return os.WriteFile(path, []byte("changed"), 0644)
+		}
+		cmd := exec.Command("sh", "-c", `echo changed > "$1"`, "sh", path)
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: nobody, Gid: nobody}}
+		return cmd.Run()
+	}
+	for _, name := range []string{"test.txt", "new.txt", "sub/new.txt"} {
+		if err := write(filepath.Join(view, name)); err == nil {
+			t.Errorf("expected writing %s under the mount to fail", name)
+		}
+	}
+	if content, _ := os.ReadFile(filepath.Join(view, "test.txt")); string(content) != "test content" {
+		t.Errorf("expected the mount to be unchanged, got %q", content)
+	}
+
+	if output, err := h.RunAgentFSInStore("checkpoint", "unmount"); err != nil {
+		t.Fatalf("checkpoint unmount failed: %v\n%s", err, output)
+	}
+	if _, err := os.Stat(view); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed, got err %v", view, err)
+	}
+}
@@ -0,0 +1,92 @@
+package e2e
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestFork_IndependentStore tests that forking a checkpoint creates a mounted
+// store holding that state, which records where it came from and shares
+// nothing with the original afterwards
+func TestFork_IndependentStore(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.CreateStore("test-fork")
+
+	file := filepath.Join(h.mountDir, "app.txt")
+	if err := os.WriteFile(file, []byte("known good"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	h.CreateCheckpoint("known good")
+	if err := os.WriteFile(file, []byte("broken"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	h.CreateCheckpoint("broken")
+
+	forkDir := filepath.Join(h.tempDir, "agent-a")
+	forkStore := forkDir + ".fs"
+	output, err := h.RunAgentFSInStore("fork", "v1", "agent-a")
+	if err != nil {
+		t.Fatalf("fork failed: %v\n%s", err, output)
+	}
+	defer func() {
+		cmd := exec.Command(h.agentfsBin, "delete", "-f", "agent-a")
+		cmd.Dir = h.tempDir
+		cmd.Run()
+	}()
+
+	if content, err := os.ReadFile(filepath.Join(forkDir, "app.txt")); err != nil || string(content) != "known good" {
+		t.Errorf("expected the fork to hold v1, got %q (err: %v)", content, err)
+	}
+	if content, err := os.ReadFile(filepath.Join(forkDir, ".agentfs")); err != nil || strings.TrimSpace(string(content)) != forkStore {
+		t.Errorf("expected the fork's .agentfs to point at %s, got %q (err: %v)", forkStore, content, err)
+	}
+
+	// The fork starts its own history at v1, recording its source
+	runInFork := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command(h.agentfsBin, args...)
+		cmd.Dir = forkDir
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("agentfs %s in fork failed: %v\n%s", strings.Join(args, " "), err, output)
+		}
+		return string(output)
+	}
+	var checkpoints []struct {
+		Version string            `json:"version"`
+		Message string            `json:"message"`
+		Meta    map[string]string `json:"meta"`
+	}
+	output = runInFork("checkpoint", "list", "--json")
+	if err := json.Unmarshal([]byte(output), &checkpoints); err != nil {
+		t.Fatalf("failed to parse checkpoints: %v\n%s", err, output)
+	}
+	if len(checkpoints) != 1 || checkpoints[0].Message != "fork of test-fork v1" {
+		t.Fatalf("expected one fork checkpoint, got %+v", checkpoints)
+	}
+	if meta := checkpoints[0].Meta; meta["forked_from_store"] != h.storeDir || meta["forked_from_version"] != "v1" {
+		t.Errorf("expected provenance %s v1, got %v", h.storeDir, meta)
+	}
+
+	// Work in the fork doesn't reach the original
+	if err := os.WriteFile(filepath.Join(forkDir, "app.txt"), []byte("agent a"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	runInFork("checkpoint", "create", "agent a work")
+	if content, _ := os.ReadFile(file); string(content) != "broken" {
+		t.Errorf("expected the original working copy to be untouched, got %q", content)
+	}
+	if _, err := h.GetCheckpointInfo("v3"); err == nil {
+		t.Errorf("expected the original store to have no v3")
+	}
+
+	if output, err := h.RunAgentFSInStore("fork", "v2", "agent-a"); err == nil {
+		t.Errorf("expected forking into an existing store to fail, got: %s", output)
+	}
+}
@@ -0,0 +1,87 @@
+package e2e
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fsckJSON represents the JSON output from fsck
+type fsckJSON struct {
+	Issues []struct {
+		Kind     string `json:"kind"`
+		Version  string `json:"version"`
+		Repaired bool   `json:"repaired"`
+	} `json:"issues"`
+	Unrepaired int `json:"unrepaired"`
+}
+
+// TestFsck_RepairsSnapshotsAndRecords tests that fsck re-registers a snapshot
+// with no record, drops a record with no snapshot and rebuilds latest
+func TestFsck_RepairsSnapshotsAndRecords(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.CreateStore("test-fsck")
+
+	for _, msg := range []string{"first", "second"} {
+		if _, err := h.CreateCheckpoint(msg); err != nil {
+			t.Fatalf("failed to create checkpoint: %v", err)
+		}
+	}
+
+	output, err := h.RunAgentFSInStore("fsck")
+	if err != nil {
+		t.Fatalf("fsck on a healthy store failed: %v\n%s", err, output)
+	}
+
+	// Lose v2's snapshot and move v1's to an unrecorded v5
+	checkpointsDir := filepath.Join(h.storeDir, "checkpoints")
+	if err := os.RemoveAll(filepath.Join(checkpointsDir, "v2")); err != nil {
+		t.Fatalf("failed to remove v2: %v", err)
+	}
+	if err := os.Rename(filepath.Join(checkpointsDir, "v1"), filepath.Join(checkpointsDir, "v5")); err != nil {
+		t.Fatalf("failed to rename v1: %v", err)
+	}
+
+	if output, err := h.RunAgentFSInStore("fsck"); err == nil {
+		t.Fatalf("expected fsck to fail on a damaged store\n%s", output)
+	}
+
+	output, err = h.RunAgentFSInStore("fsck", "--repair", "--json")
+	if err != nil {
+		t.Fatalf("fsck --repair failed: %v\n%s", err, output)
+	}
+	var report fsckJSON
+	if err := json.Unmarshal([]byte(output), &report); err != nil {
+		t.Fatalf("failed to parse JSON: %v\n%s", err, output)
+	}
+	kinds := make(map[string]bool)
+	for _, issue := range report.Issues {
+		kinds[issue.Kind+" "+issue.Version] = true
+		if !issue.Repaired {
+			t.Errorf("issue %s %s not repaired", issue.Kind, issue.Version)
+		}
+	}
+	for _, want := range []string{"missing-snapshot v1", "missing-snapshot v2", "orphan-snapshot v5", "stale-latest "} {
+		if !kinds[want] {
+			t.Errorf("expected issue %q, got %+v", want, report.Issues)
+		}
+	}
+
+	checkpoints, err := h.ListCheckpoints()
+	if err != nil {
+		t.Fatalf("failed to list checkpoints: %v", err)
+	}
+	if len(checkpoints) != 1 || checkpoints[0].Version != "v5" {
+		t.Fatalf("expected only v5 after repair, got %+v", checkpoints)
+	}
+	if target, _ := os.Readlink(filepath.Join(checkpointsDir, "latest")); target != "v5" {
+		t.Errorf("expected latest -> v5, got %q", target)
+	}
+
+	if output, err := h.RunAgentFSInStore("fsck"); err != nil {
+		t.Errorf("fsck after repair failed: %v\n%s", err, output)
+	}
+}
@@ -0,0 +1,109 @@
+package e2e
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestGC_KeepsTaggedAndBranchHeads tests that gc applies the retention policy
+// without deleting tagged checkpoints or branch heads
+func TestGC_KeepsTaggedAndBranchHeads(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.CreateStore("test-gc")
+
+	for i := 1; i <= 5; i++ {
+		file := filepath.Join(h.mountDir, fmt.Sprintf("file%d.txt", i))
+		if err := os.WriteFile(file, []byte(fmt.Sprintf("content %d", i)), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+		if _, err := h.CreateCheckpoint(fmt.Sprintf("c%d", i)); err != nil {
+			t.Fatalf("failed to create checkpoint: %v", err)
+		}
+	}
+	if output, err := h.RunAgentFSInStore("tag", "release", "v1"); err != nil {
+		t.Fatalf("tag failed: %v\n%s", err, output)
+	}
+	if output, err := h.RunAgentFSInStore("branch", "experiment", "v2"); err != nil {
+		t.Fatalf("branch failed: %v\n%s", err, output)
+	}
+
+	// Without rules nothing is deleted
+	output, err := h.RunAgentFSInStore("gc")
+	if err != nil || !strings.Contains(output, "nothing to delete") {
+		t.Fatalf("expected gc without rules to do nothing: %v\n%s", err, output)
+	}
+
+	if output, err := h.RunAgentFSInStore("gc", "policy", "--keep-last", "2"); err != nil {
+		t.Fatalf("gc policy failed: %v\n%s", err, output)
+	}
+
+	var result struct {
+		Deleted []string `json:"deleted"`
+		Kept    int      `json:"kept"`
+	}
+	output, err = h.RunAgentFSInStore("gc", "--dry-run", "--json")
+	if err != nil {
+		t.Fatalf("gc --dry-run failed: %v\n%s", err, output)
+	}
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		t.Fatalf("failed to parse gc output: %v\n%s", err, output)
+	}
+	if strings.Join(result.Deleted, ",") != "v3" || result.Kept != 4 {
+		t.Fatalf("expected only v3 to be deleted, got %v (kept %d)", result.Deleted, result.Kept)
+	}
+	if _, err := h.GetCheckpointInfo("v3"); err != nil {
+		t.Fatalf("dry run deleted v3: %v", err)
+	}
+
+	if output, err := h.RunAgentFSInStore("gc"); err != nil {
+		t.Fatalf("gc failed: %v\n%s", err, output)
+	}
+	if _, err := h.GetCheckpointInfo("v3"); err == nil {
+		t.Error("expected v3 to be deleted")
+	}
+
+	// v3's child continues from v3's parent
+	info, err := h.GetCheckpointInfo("v4")
+	if err != nil {
+		t.Fatalf("checkpoint info failed: %v", err)
+	}
+	if info.ParentVersion == nil || *info.ParentVersion != 2 {
+		t.Errorf("expected v4's parent to become v2, got %v", info.ParentVersion)
+	}
+	if output, err := h.RunAgentFSInStore("fsck"); err != nil {
+		t.Errorf("fsck failed after gc: %v\n%s", err, output)
+	}
+
+	// With --auto, gc runs after each checkpoint
+	if output, err := h.RunAgentFSInStore("gc", "policy", "--auto"); err != nil {
+		t.Fatalf("gc policy --auto failed: %v\n%s", err, output)
+	}
+	if err := os.WriteFile(filepath.Join(h.mountDir, "file6.txt"), []byte("content 6"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	output, err = h.RunAgentFSInStore("checkpoint", "create", "c6")
+	if err != nil {
+		t.Fatalf("checkpoint create failed: %v\n%s", err, output)
+	}
+	if !strings.Contains(output, "gc: Deleted 1 checkpoint") {
+		t.Errorf("expected automatic gc to delete v4, got:\n%s", output)
+	}
+
+	checkpoints, err := h.ListCheckpoints()
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	var versions []string
+	for _, cp := range checkpoints {
+		versions = append(versions, cp.Version)
+	}
+	if got := strings.Join(versions, ","); got != "v6,v5,v2,v1" {
+		t.Errorf("expected v6,v5,v2,v1 to remain, got %s", got)
+	}
+}
@@ -0,0 +1,117 @@
+package e2e
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestHooks_InstallStatusUninstall tests that agentfs hooks are merged into
+// Claude Code settings next to existing hooks, and removed without them
+func TestHooks_InstallStatusUninstall(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.CreateStore("test-hooks")
+
+	home := filepath.Join(h.tempDir, "home")
+	userSettings := filepath.Join(home, ".claude", "settings.json")
+	if err := os.MkdirAll(filepath.Dir(userSettings), 0755); err != nil {
+		t.Fatalf("failed to create settings directory: %v", err)
+	}
+	existing := `{
+  "model": "opus",
+  "hooks": {
+    "PostToolUse": [
+      {"matcher": "Bash", "hooks": [{"type": "command", "command": "./lint.sh > /dev/null"}]}
+    ]
+  }
+}`
+	if err := os.WriteFile(userSettings, []byte(existing), 0644); err != nil {
+		t.Fatalf("failed to write settings: %v", err)
+	}
+
+	run := func(dir string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command(h.agentfsBin, args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "HOME="+home)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("agentfs %s failed: %v\n%s", strings.Join(args, " "), err, output)
+		}
+		return string(output)
+	}
+	type settingsJSON struct {
+		Model string `json:"model"`
+		Hooks map[string][]struct {
+			Matcher string `json:"matcher"`
+			Hooks   []struct {
+				Command string `json:"command"`
+			} `json:"hooks"`
+		} `json:"hooks"`
+	}
+	read := func(path string) settingsJSON {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read settings: %v", err)
+		}
+		var s settingsJSON
+		if err := json.Unmarshal(data, &s); err != nil {
+			t.Fatalf("failed to parse settings: %v\n%s", err, data)
+		}
+		return s
+	}
+
+	run(h.tempDir, "hooks", "install", "--events", "Stop,PostToolUse")
+	if output := run(h.tempDir, "hooks", "install", "--events", "Stop"); !strings.Contains(output, "Already installed for Stop") {
+		t.Errorf("expected a second install to skip Stop, got: %s", output)
+	}
+
+	s := read(userSettings)
+	if s.Model != "opus" {
+		t.Errorf("expected other settings to be kept, got model %q", s.Model)
+	}
+	if len(s.Hooks["Stop"]) != 1 || !strings.HasPrefix(s.Hooks["Stop"][0].Hooks[0].Command, "agentfs checkpoint create --auto") {
+		t.Errorf("expected one agentfs Stop hook, got %+v", s.Hooks["Stop"])
+	}
+	post := s.Hooks["PostToolUse"]
+	if len(post) != 2 || post[0].Hooks[0].Command != "./lint.sh > /dev/null" {
+		t.Errorf("expected the existing PostToolUse hook followed by agentfs's, got %+v", post)
+	}
+
+	// Project hooks go in the store's .claude/settings.json
+	run(h.mountDir, "hooks", "install", "--project", "--events", "PreToolUse,PostToolUse")
+	output := run(h.mountDir, "hooks", "status", "--json")
+	var scopes []struct {
+		Scope  string   `json:"scope"`
+		Path   string   `json:"path"`
+		Events []string `json:"events"`
+	}
+	if err := json.Unmarshal([]byte(output), &scopes); err != nil {
+		t.Fatalf("failed to parse status: %v\n%s", err, output)
+	}
+	if len(scopes) != 2 {
+		t.Fatalf("expected user and project scopes, got %s", output)
+	}
+	if got := strings.Join(scopes[0].Events, ","); scopes[0].Scope != "user" || got != "PostToolUse,Stop" {
+		t.Errorf("expected user hooks PostToolUse,Stop, got %s: %s", scopes[0].Scope, got)
+	}
+	if got := strings.Join(scopes[1].Events, ","); scopes[1].Path != filepath.Join(h.mountDir, ".claude", "settings.json") || got != "PreToolUse,PostToolUse" {
+		t.Errorf("expected project hooks PreToolUse,PostToolUse in the store, got %s: %s", scopes[1].Path, got)
+	}
+
+	// Uninstall leaves exactly what was there before
+	run(h.tempDir, "hooks", "uninstall")
+	s = read(userSettings)
+	if s.Model != "opus" || len(s.Hooks) != 1 || len(s.Hooks["PostToolUse"]) != 1 || s.Hooks["PostToolUse"][0].Hooks[0].Command != "./lint.sh > /dev/null" {
+		t.Errorf("expected only the original hook to remain, got %+v", s)
+	}
+	if output := run(h.tempDir, "hooks", "uninstall"); !strings.Contains(output, "No agentfs hooks installed") {
+		t.Errorf("expected nothing left to uninstall, got: %s", output)
+	}
+}
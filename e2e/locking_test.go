@@ -0,0 +1,51 @@
+package e2e
+
+import (
+	"os/exec"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentCheckpoints tests that parallel checkpoint creates get distinct versions
+func TestConcurrentCheckpoints(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.CreateStore("test-concurrent")
+
+	const n = 5
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	outputs := make([][]byte, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cmd := exec.Command(h.agentfsBin, "checkpoint", "create", "--wait")
+			cmd.Dir = h.mountDir
+			outputs[i], errs[i] = cmd.CombinedOutput()
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("checkpoint %d failed: %v\n%s", i, err, outputs[i])
+		}
+	}
+
+	checkpoints, err := h.ListCheckpoints()
+	if err != nil {
+		t.Fatalf("failed to list checkpoints: %v", err)
+	}
+	if len(checkpoints) != n {
+		t.Fatalf("expected %d checkpoints, got %d", n, len(checkpoints))
+	}
+	seen := make(map[string]bool)
+	for _, cp := range checkpoints {
+		if seen[cp.Version] {
+			t.Errorf("duplicate version %s", cp.Version)
+		}
+		seen[cp.Version] = true
+	}
+}
@@ -0,0 +1,81 @@
+package e2e
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestLog_GraphShowsForks tests that log --graph draws forked checkpoints on separate lanes
+func TestLog_GraphShowsForks(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.CreateStore("test-log")
+	testFile := filepath.Join(h.mountDir, "test.txt")
+
+	if _, err := h.CreateCheckpoint("base"); err != nil {
+		t.Fatalf("failed to create v1: %v", err)
+	}
+	if err := os.WriteFile(testFile, []byte("approach a"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if _, err := h.CreateCheckpoint("Edit test.txt (f55a4d56)"); err != nil {
+		t.Fatalf("failed to create v2: %v", err)
+	}
+	if output, err := h.RunAgentFS("switch", "--store", h.storeDir, "-c", "approach-b", "v1"); err != nil {
+		t.Fatalf("switch -c failed: %v\n%s", err, output)
+	}
+	if err := os.WriteFile(testFile, []byte("approach b"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if _, err := h.CreateCheckpoint("approach b"); err != nil {
+		t.Fatalf("failed to create v3: %v", err)
+	}
+	if output, err := h.RunAgentFS("switch", "--store", h.storeDir, "main"); err != nil {
+		t.Fatalf("switch failed: %v\n%s", err, output)
+	}
+
+	output, err := h.RunAgentFSInStore("log", "--graph")
+	if err != nil {
+		t.Fatalf("log --graph failed: %v\n%s", err, output)
+	}
+	want := []string{
+		"* v3 (approach-b) approach b",
+		"| * v2 (HEAD -> main) Edit test.txt (f55a4d56)",
+		"|/",
+		"* v1 base",
+	}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("expected %d lines, got:\n%s", len(want), output)
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("line %d: expected prefix %q, got %q", i+1, prefix, lines[i])
+		}
+	}
+
+	output, err = h.RunAgentFSInStore("log", "--json", "--stat", "--session", "f55a4d56")
+	if err != nil {
+		t.Fatalf("log --json failed: %v\n%s", err, output)
+	}
+	var entries []struct {
+		Version string `json:"version"`
+		Head    bool   `json:"head"`
+		Changes *struct {
+			Modified int `json:"modified"`
+		} `json:"changes"`
+	}
+	if err := json.Unmarshal([]byte(output), &entries); err != nil {
+		t.Fatalf("failed to parse log output: %v\n%s", err, output)
+	}
+	if len(entries) != 1 || entries[0].Version != "v2" || !entries[0].Head {
+		t.Fatalf("expected only v2 (HEAD) from the session, got %+v", entries)
+	}
+	if entries[0].Changes == nil || entries[0].Changes.Modified != 1 {
+		t.Errorf("expected v2 to modify 1 file, got %+v", entries[0].Changes)
+	}
+}
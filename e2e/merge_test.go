@@ -0,0 +1,213 @@
+package e2e
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// mergeJSON represents the JSON output from merge
+type mergeJSON struct {
+	BaseVersion string   `json:"base_version"`
+	UpToDate    bool     `json:"up_to_date"`
+	Applied     []string `json:"applied"`
+	Merged      []string `json:"merged"`
+	Conflicts   []struct {
+		Path string `json:"path"`
+		Kind string `json:"kind"`
+	} `json:"conflicts"`
+	Checkpoint string `json:"checkpoint"`
+}
+
+// TestMerge_Branch tests that merging a branch applies its changes, merges
+// text edits line by line, writes conflict markers where they overlap, and
+// records a checkpoint with both parents
+func TestMerge_Branch(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.CreateStore("test-merge")
+
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(h.mountDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	read := func(name string) string {
+		t.Helper()
+		content, err := os.ReadFile(filepath.Join(h.mountDir, name))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		return string(content)
+	}
+
+	write("shared.txt", "one\ntwo\nthree\nfour\nfive\n")
+	write("conflict.txt", "original\n")
+	h.CreateCheckpoint("base")
+
+	write("shared.txt", "ONE\ntwo\nthree\nfour\nfive\n")
+	write("conflict.txt", "ours\n")
+	h.CreateCheckpoint("main work")
+
+	if output, err := h.RunAgentFS("switch", "--store", h.storeDir, "-c", "feature", "v1"); err != nil {
+		t.Fatalf("switch -c failed: %v\n%s", err, output)
+	}
+	write("shared.txt", "one\ntwo\nthree\nfour\nFIVE\n")
+	write("conflict.txt", "theirs\n")
+	write("added.txt", "from feature\n")
+	h.CreateCheckpoint("feature work")
+
+	if output, err := h.RunAgentFS("switch", "--store", h.storeDir, "main"); err != nil {
+		t.Fatalf("switch failed: %v\n%s", err, output)
+	}
+
+	// A conflict exits non-zero but still records the merge
+	output, err := h.RunAgentFSInStore("merge", "feature", "--json")
+	if err == nil {
+		t.Fatalf("expected merge with a conflict to fail, got:\n%s", output)
+	}
+	var result mergeJSON
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		t.Fatalf("failed to parse merge output: %v\n%s", err, output)
+	}
+	if result.BaseVersion != "v1" {
+		t.Errorf("expected common ancestor v1, got %s", result.BaseVersion)
+	}
+	if len(result.Applied) != 1 || result.Applied[0] != "added.txt" {
+		t.Errorf("expected added.txt to be applied, got %v", result.Applied)
+	}
+	if len(result.Merged) != 1 || result.Merged[0] != "shared.txt" {
+		t.Errorf("expected shared.txt to be merged, got %v", result.Merged)
+	}
+	if len(result.Conflicts) != 1 || result.Conflicts[0].Path != "conflict.txt" || result.Conflicts[0].Kind != "text" {
+		t.Errorf("expected a text conflict in conflict.txt, got %v", result.Conflicts)
+	}
+
+	if got := read("shared.txt"); got != "ONE\ntwo\nthree\nfour\nFIVE\n" {
+		t.Errorf("expected both edits in shared.txt, got %q", got)
+	}
+	if got := read("added.txt"); got != "from feature\n" {
+		t.Errorf("expected added.txt from feature, got %q", got)
+	}
+	conflict := read("conflict.txt")
+	for _, want := range []string{"<<<<<<<", "ours\n", "=======", "theirs\n", ">>>>>>>"} {
+		if !strings.Contains(conflict, want) {
+			t.Errorf("expected conflict markers in conflict.txt, got %q", conflict)
+			break
+		}
+	}
+
+	// The merge follows main's head and records feature's as its second parent
+	cp, err := h.GetCheckpointInfo(result.Checkpoint)
+	if err != nil {
+		t.Fatalf("checkpoint info failed: %v", err)
+	}
+	if cp.ParentVersion == nil || *cp.ParentVersion < 2 || *cp.ParentVersion == 3 {
+		t.Errorf("expected %s to follow main, got parent %v", cp.Version, cp.ParentVersion)
+	}
+	if cp.MergeParent == nil || *cp.MergeParent != 3 {
+		t.Errorf("expected %s to have merge parent v3, got %v", cp.Version, cp.MergeParent)
+	}
+	if cp.Branch != "main" {
+		t.Errorf("expected the merge on main, got %q", cp.Branch)
+	}
+
+	// The graph draws both parents
+	output, err = h.RunAgentFSInStore("log", "--graph")
+	if err != nil {
+		t.Fatalf("log --graph failed: %v\n%s", err, output)
+	}
+	if !regexp.MustCompile(`merge v3  \([^)]*\)\n\|\\\n`).MatchString(output) || !strings.Contains(output, "\n| * v3 (feature) feature work") {
+		t.Errorf("expected the merge to branch off to v3 in the graph, got:\n%s", output)
+	}
+
+	// Once resolved, the branch is already merged
+	write("conflict.txt", "resolved\n")
+	h.CreateCheckpoint("resolved")
+	output, err = h.RunAgentFSInStore("merge", "feature", "--json")
+	if err != nil {
+		t.Fatalf("second merge failed: %v\n%s", err, output)
+	}
+	result = mergeJSON{}
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		t.Fatalf("failed to parse merge output: %v\n%s", err, output)
+	}
+	if !result.UpToDate || result.Checkpoint != "" {
+		t.Errorf("expected feature to be already merged, got %+v", result)
+	}
+}
+
+// TestMerge_Fork tests that merging a forked store applies the fork's
+// changes since the checkpoint it was forked from
+func TestMerge_Fork(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.CreateStore("test-merge-fork")
+
+	if err := os.WriteFile(filepath.Join(h.mountDir, "app.txt"), []byte("v1\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	h.CreateCheckpoint("base")
+
+	forkDir := filepath.Join(h.tempDir, "agent-a")
+	if output, err := h.RunAgentFSInStore("fork", "v1", "agent-a"); err != nil {
+		t.Fatalf("fork failed: %v\n%s", err, output)
+	}
+	defer func() {
+		cmd := exec.Command(h.agentfsBin, "delete", "-f", "agent-a")
+		cmd.Dir = h.tempDir
+		cmd.Run()
+	}()
+
+	if err := os.WriteFile(filepath.Join(forkDir, "app.txt"), []byte("v1\nfrom agent-a\n"), 0644); err != nil {
+		t.Fatalf("failed to write file in fork: %v", err)
+	}
+	cmd := exec.Command(h.agentfsBin, "checkpoint", "create", "agent-a work")
+	cmd.Dir = forkDir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("checkpoint in fork failed: %v\n%s", err, output)
+	}
+
+	output, err := h.RunAgentFSInStore("merge", "agent-a", "--json")
+	if err != nil {
+		t.Fatalf("merge failed: %v\n%s", err, output)
+	}
+	var result mergeJSON
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		t.Fatalf("failed to parse merge output: %v\n%s", err, output)
+	}
+	if len(result.Applied) != 1 || result.Applied[0] != "app.txt" || len(result.Conflicts) != 0 {
+		t.Errorf("expected app.txt to be applied without conflicts, got %+v", result)
+	}
+	if content, _ := os.ReadFile(filepath.Join(h.mountDir, "app.txt")); string(content) != "v1\nfrom agent-a\n" {
+		t.Errorf("expected the fork's change in the working copy, got %q", content)
+	}
+
+	cp, err := h.GetCheckpointInfo(result.Checkpoint)
+	if err != nil {
+		t.Fatalf("checkpoint info failed: %v", err)
+	}
+	if cp.Message != "merge agent-a v2" || cp.MergeParent != nil {
+		t.Errorf("expected a merge checkpoint of agent-a v2 without a local merge parent, got %q (%v)", cp.Message, cp.MergeParent)
+	}
+
+	// The .fs name also resolves next to the store, not the current directory
+	output, err = h.RunAgentFSInStore("merge", "agent-a.fs", "--json")
+	if err != nil {
+		t.Fatalf("merge by .fs name failed: %v\n%s", err, output)
+	}
+	result = mergeJSON{}
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		t.Fatalf("failed to parse merge output: %v\n%s", err, output)
+	}
+	if !result.UpToDate {
+		t.Errorf("expected agent-a to be already merged, got %+v", result)
+	}
+}
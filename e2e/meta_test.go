@@ -0,0 +1,101 @@
+package e2e
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMeta_HookFieldsAndFilters tests that hook fields and --meta are kept as
+// checkpoint metadata and that checkpoints can be listed by it
+func TestMeta_HookFieldsAndFilters(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.CreateStore("test-meta")
+
+	hooks := []string{
+		`{"session_id":"f55a4d56-0000-4000-8000-000000000001","tool_name":"Bash","hook_event_name":"PostToolUse","tool_input":{"command":"go test ./..."}}`,
+		`{"session_id":"f55a4d56-0000-4000-8000-000000000001","tool_name":"Edit","hook_event_name":"PostToolUse","tool_input":{"file_path":"/src/main.go"}}`,
+		`{"session_id":"0badc0de-0000-4000-8000-000000000002","tool_name":"Bash","hook_event_name":"PostToolUse","tool_input":{"command":"make"}}`,
+	}
+	for i, hook := range hooks {
+		file := filepath.Join(h.mountDir, "file.txt")
+		if err := os.WriteFile(file, []byte(strings.Repeat("x", i+1)), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+		cmd := exec.Command(h.agentfsBin, "checkpoint", "create", "--auto", "--from-hook")
+		cmd.Dir = h.mountDir
+		cmd.Stdin = strings.NewReader(hook)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("auto checkpoint failed: %v\n%s", err, output)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(h.mountDir, "notes.txt"), []byte("notes"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if output, err := h.RunAgentFSInStore("checkpoint", "create", "manual", "--meta", "ticket=ENG-42"); err != nil {
+		t.Fatalf("checkpoint create --meta failed: %v\n%s", err, output)
+	}
+
+	var info struct {
+		Meta map[string]string `json:"meta"`
+	}
+	output, err := h.RunAgentFSInStore("checkpoint", "info", "v1", "--json")
+	if err != nil {
+		t.Fatalf("checkpoint info failed: %v\n%s", err, output)
+	}
+	if err := json.Unmarshal([]byte(output), &info); err != nil {
+		t.Fatalf("failed to parse info: %v\n%s", err, output)
+	}
+	if info.Meta["tool_name"] != "Bash" || info.Meta["command"] != "go test ./..." ||
+		info.Meta["session_id"] != "f55a4d56-0000-4000-8000-000000000001" || info.Meta["hook_event_name"] != "PostToolUse" {
+		t.Errorf("hook fields not recorded: %v", info.Meta)
+	}
+
+	list := func(args ...string) string {
+		t.Helper()
+		output, err := h.RunAgentFSInStore(append([]string{"checkpoint", "list", "--json"}, args...)...)
+		if err != nil {
+			t.Fatalf("checkpoint list failed: %v\n%s", err, output)
+		}
+		var checkpoints []checkpointJSON
+		if err := json.Unmarshal([]byte(output), &checkpoints); err != nil {
+			t.Fatalf("failed to parse list: %v\n%s", err, output)
+		}
+		var versions []string
+		for _, cp := range checkpoints {
+			versions = append(versions, cp.Version)
+		}
+		return strings.Join(versions, ",")
+	}
+
+	if got := list("--meta", "session_id=f55a4d56*", "--meta", "tool_name=Bash"); got != "v1" {
+		t.Errorf("expected Bash checkpoints of session f55a4d56 to be v1, got %q", got)
+	}
+	if got := list("--meta", "tool_name=Bash"); got != "v3,v1" {
+		t.Errorf("expected Bash checkpoints to be v3,v1, got %q", got)
+	}
+	if got := list("--meta", "ticket=ENG-42"); got != "v4" {
+		t.Errorf("expected ticket ENG-42 to be v4, got %q", got)
+	}
+
+	output, err = h.RunAgentFSInStore("log", "--session", "f55a4d56")
+	if err != nil {
+		t.Fatalf("log --session failed: %v\n%s", err, output)
+	}
+	if !strings.Contains(output, "v2 ") || !strings.Contains(output, "v1 ") || strings.Contains(output, "v3 ") {
+		t.Errorf("expected log --session to show v2 and v1 only, got:\n%s", output)
+	}
+
+	// Metadata survives rebuilding the database from sidecars
+	if output, err := h.RunAgentFSInStore("repair", "--rebuild-db", "-f"); err != nil {
+		t.Fatalf("repair failed: %v\n%s", err, output)
+	}
+	if got := list("--meta", "tool_name=Edit"); got != "v2" {
+		t.Errorf("expected tool_name=Edit to be v2 after rebuild, got %q", got)
+	}
+}
@@ -0,0 +1,187 @@
+package e2e
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// TestRestore_Paths tests that restoring paths copies only the selected files
+// back from a checkpoint and records the result as a checkpoint
+func TestRestore_Paths(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.CreateStore("test-partial-restore")
+
+	files := map[string]string{
+		"README.md":     "readme v1",
+		"src/app.go":    "app v1",
+		"src/util.go":   "util v1",
+		"src/notes.txt": "notes v1",
+	}
+	write := func(files map[string]string) {
+		t.Helper()
+		for name, content := range files {
+			path := filepath.Join(h.mountDir, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatalf("failed to create directory: %v", err)
+			}
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatalf("failed to write %s: %v", name, err)
+			}
+		}
+	}
+	write(files)
+	h.CreateCheckpoint("v1 state")
+
+	write(map[string]string{
+		"README.md":     "readme changed",
+		"src/app.go":    "app changed",
+		"src/util.go":   "util changed",
+		"src/notes.txt": "notes changed",
+		"src/new.go":    "added later",
+	})
+
+	output, err := h.RunAgentFSInStore("restore", "v1", "-f", "--json", "--", "src/*.go")
+	if err != nil {
+		t.Fatalf("partial restore failed: %v\n%s", err, output)
+	}
+	var result struct {
+		Restored   []string `json:"restored"`
+		PreRestore string   `json:"pre_restore"`
+		Checkpoint string   `json:"checkpoint"`
+	}
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		t.Fatalf("failed to parse restore output: %v\n%s", err, output)
+	}
+	if len(result.Restored) != 2 || result.Restored[0] != "src/app.go" || result.Restored[1] != "src/util.go" {
+		t.Errorf("expected src/app.go and src/util.go to be restored, got %v", result.Restored)
+	}
+	if result.PreRestore != "v2" || result.Checkpoint != "v3" {
+		t.Errorf("expected pre-restore v2 and result v3, got %q and %q", result.PreRestore, result.Checkpoint)
+	}
+
+	expected := map[string]string{
+		"README.md":     "readme changed",
+		"src/app.go":    "app v1",
+		"src/util.go":   "util v1",
+		"src/notes.txt": "notes changed",
+		"src/new.go":    "added later",
+	}
+	for name, want := range expected {
+		content, err := os.ReadFile(filepath.Join(h.mountDir, name))
+		if err != nil || string(content) != want {
+			t.Errorf("expected %s to be %q, got %q (err: %v)", name, want, content, err)
+		}
+	}
+
+	// The overwritten edits are kept in the pre-restore checkpoint
+	output, err = h.RunAgentFSInStore("diff", "v2", "v3", "--name-only")
+	if err != nil {
+		t.Fatalf("diff failed: %v\n%s", err, output)
+	}
+	if output != "src/app.go\nsrc/util.go\n" {
+		t.Errorf("expected v2..v3 to change only the restored files, got:\n%s", output)
+	}
+
+	cp, err := h.GetCheckpointInfo("v3")
+	if err != nil {
+		t.Fatalf("checkpoint info failed: %v", err)
+	}
+	if cp.Message != "restore v1 -- src/*.go" {
+		t.Errorf("expected v3 to describe the partial restore, got %q", cp.Message)
+	}
+
+	// A directory restores everything under it, from a subdirectory too
+	cmd := exec.Command(h.agentfsBin, "restore", "v1", "-f", "--", ".")
+	cmd.Dir = filepath.Join(h.mountDir, "src")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("directory restore failed: %v\n%s", err, output)
+	}
+	if content, _ := os.ReadFile(filepath.Join(h.mountDir, "src", "notes.txt")); string(content) != "notes v1" {
+		t.Errorf("expected src/notes.txt to be restored, got %q", content)
+	}
+	if content, _ := os.ReadFile(filepath.Join(h.mountDir, "README.md")); string(content) != "readme changed" {
+		t.Errorf("expected README.md outside src to be untouched, got %q", content)
+	}
+
+	if output, err := h.RunAgentFSInStore("restore", "v1", "-f", "--", "missing.txt"); err == nil {
+		t.Errorf("expected restoring a path missing from the checkpoint to fail, got: %s", output)
+	}
+}
+
+// TestRestore_PathsReplaceSymlink tests that restoring a file over a symlink
+// in the working copy replaces the link instead of writing through it
+func TestRestore_PathsReplaceSymlink(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.CreateStore("test-restore-symlink")
+
+	file := filepath.Join(h.mountDir, "a.txt")
+	if err := os.WriteFile(file, []byte("a v1"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(h.mountDir, "src"), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(h.mountDir, "src", "b.txt"), []byte("b v1"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	h.CreateCheckpoint("v1 state")
+
+	// Point a.txt at a file outside the store
+	victim := filepath.Join(h.tempDir, "victim")
+	if err := os.WriteFile(victim, []byte("outside"), 0644); err != nil {
+		t.Fatalf("failed to write victim: %v", err)
+	}
+	if err := os.Remove(file); err != nil {
+		t.Fatalf("failed to remove file: %v", err)
+	}
+	if err := os.Symlink(victim, file); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	if output, err := h.RunAgentFSInStore("restore", "v1", "-f", "--", "a.txt"); err != nil {
+		t.Fatalf("partial restore failed: %v\n%s", err, output)
+	}
+
+	if content, _ := os.ReadFile(victim); string(content) != "outside" {
+		t.Errorf("expected the symlink's target to be untouched, got %q", content)
+	}
+	info, err := os.Lstat(file)
+	if err != nil {
+		t.Fatalf("failed to stat a.txt: %v", err)
+	}
+	if !info.Mode().IsRegular() {
+		t.Errorf("expected a.txt to be a regular file again, got mode %v", info.Mode())
+	}
+	if content, _ := os.ReadFile(file); string(content) != "a v1" {
+		t.Errorf("expected a.txt to be restored, got %q", content)
+	}
+
+	// Point src/ at a directory outside the store
+	outside := filepath.Join(h.tempDir, "outside")
+	if err := os.MkdirAll(outside, 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "b.txt"), []byte("outside"), 0644); err != nil {
+		t.Fatalf("failed to write victim: %v", err)
+	}
+	if err := os.RemoveAll(filepath.Join(h.mountDir, "src")); err != nil {
+		t.Fatalf("failed to remove directory: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(h.mountDir, "src")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	if output, err := h.RunAgentFSInStore("restore", "v1", "-f", "--", "src/b.txt"); err == nil {
+		t.Errorf("expected restoring through a symlinked directory to fail, got:\n%s", output)
+	}
+	if content, _ := os.ReadFile(filepath.Join(outside, "b.txt")); string(content) != "outside" {
+		t.Errorf("expected the file outside the store to be untouched, got %q", content)
+	}
+}
@@ -0,0 +1,163 @@
+package e2e
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// TestRecovery_InterruptedCheckpoint tests that a checkpoint left half-created
+// by a crashed process is rolled back by the next mutating command
+func TestRecovery_InterruptedCheckpoint(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.CreateStore("test-recovery")
+
+	if _, err := h.CreateCheckpoint("first"); err != nil {
+		t.Fatalf("failed to create checkpoint: %v", err)
+	}
+
+	// Simulate a crash after v2 was reserved but before its clone finished
+	database, err := sql.Open("sqlite3", filepath.Join(h.storeDir, "metadata.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	_, err = database.Exec(`
+		INSERT INTO checkpoints (version, message, created_at) VALUES (2, 'crashed', 0);
+		INSERT INTO operations (kind, version, step, started_at) VALUES ('checkpoint', 2, 'reserved', 0);
+	`)
+	database.Close()
+	if err != nil {
+		t.Fatalf("failed to simulate crash: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(h.storeDir, "checkpoints", "v2"), 0755); err != nil {
+		t.Fatalf("failed to create partial checkpoint: %v", err)
+	}
+
+	output, err := h.RunAgentFSInStore("checkpoint", "create", "second")
+	if err != nil {
+		t.Fatalf("checkpoint create failed: %v\n%s", err, output)
+	}
+	if !strings.Contains(output, "Recovered: rolled back interrupted checkpoint v2") {
+		t.Errorf("expected recovery message, got:\n%s", output)
+	}
+
+	checkpoints, err := h.ListCheckpoints()
+	if err != nil {
+		t.Fatalf("failed to list checkpoints: %v", err)
+	}
+	if len(checkpoints) != 2 {
+		t.Fatalf("expected 2 checkpoints, got %d", len(checkpoints))
+	}
+	for _, cp := range checkpoints {
+		if cp.Message == "crashed" {
+			t.Errorf("interrupted checkpoint %s was not rolled back", cp.Version)
+		}
+	}
+}
+
+// TestRecovery_FailedPreRestoreKeepsHead tests that a pre-restore checkpoint
+// that can't be created leaves the branch at its previous head, not at the
+// restore target it was parented on
+func TestRecovery_FailedPreRestoreKeepsHead(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.CreateStore("test-failed-pre-restore")
+
+	if _, err := h.CreateCheckpoint("first"); err != nil {
+		t.Fatalf("failed to create checkpoint: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(h.mountDir, "app.txt"), []byte("v2"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	head, err := h.CreateCheckpoint("second")
+	if err != nil {
+		t.Fatalf("failed to create checkpoint: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(h.mountDir, "app.txt"), []byte("unsaved"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	// A file where the pre-restore snapshot goes makes its clone fail
+	checkpoints, err := h.ListCheckpoints()
+	if err != nil {
+		t.Fatalf("failed to list checkpoints: %v", err)
+	}
+	next := fmt.Sprintf("v%d", len(checkpoints)+1)
+	if err := os.WriteFile(filepath.Join(h.storeDir, "checkpoints", next), nil, 0644); err != nil {
+		t.Fatalf("failed to block the snapshot path: %v", err)
+	}
+
+	if output, err := h.RunAgentFSInStore("restore", "v1", "-f"); err == nil {
+		t.Fatalf("expected restore to fail, got:\n%s", output)
+	}
+
+	output, err := h.RunAgentFSInStore("branch", "--json")
+	if err != nil {
+		t.Fatalf("branch list failed: %v\n%s", err, output)
+	}
+	var branches []struct {
+		Name string `json:"name"`
+		Head string `json:"head"`
+	}
+	if err := json.Unmarshal([]byte(output), &branches); err != nil {
+		t.Fatalf("failed to parse branch list: %v\n%s", err, output)
+	}
+	if len(branches) != 1 || branches[0].Head != head.Version {
+		t.Errorf("expected main to stay at %s, got %+v", head.Version, branches)
+	}
+	if content, _ := os.ReadFile(filepath.Join(h.mountDir, "app.txt")); string(content) != "unsaved" {
+		t.Errorf("expected the working copy to be untouched, got %q", content)
+	}
+}
+
+// TestRecovery_InterruptedSquash tests that the deletes a crashed squash left
+// journaled are finished by the next mutating command
+func TestRecovery_InterruptedSquash(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.CreateStore("test-recovery-squash")
+
+	for _, message := range []string{"first", "second"} {
+		if _, err := h.CreateCheckpoint(message); err != nil {
+			t.Fatalf("failed to create checkpoint: %v", err)
+		}
+	}
+
+	// Simulate a crash after v1 was squashed into v2, before it was deleted
+	database, err := sql.Open("sqlite3", filepath.Join(h.storeDir, "metadata.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	_, err = database.Exec(`
+		UPDATE checkpoints SET parent_version = NULL WHERE version = 2;
+		INSERT INTO operations (kind, version, step, started_at) VALUES ('squash', 2, 'squashed', 0);
+		INSERT INTO operations (kind, version, step, started_at) VALUES ('delete-checkpoint', 1, 'deleting', 0);
+	`)
+	database.Close()
+	if err != nil {
+		t.Fatalf("failed to simulate crash: %v", err)
+	}
+
+	output, err := h.RunAgentFSInStore("checkpoint", "create", "third")
+	if err != nil {
+		t.Fatalf("checkpoint create failed: %v\n%s", err, output)
+	}
+	for _, want := range []string{"Recovered: completed interrupted squash into v2", "Recovered: completed interrupted delete of v1"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q, got:\n%s", want, output)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(h.storeDir, "checkpoints", "v1")); !os.IsNotExist(err) {
+		t.Errorf("expected v1's snapshot to be removed, got err %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package e2e
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestRepair_RebuildDB tests that checkpoint history survives losing metadata.db
+func TestRepair_RebuildDB(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.CreateStore("test-rebuild")
+
+	for _, msg := range []string{"first", "second"} {
+		if _, err := h.CreateCheckpoint(msg); err != nil {
+			t.Fatalf("failed to create checkpoint: %v", err)
+		}
+	}
+	before, err := h.ListCheckpoints()
+	if err != nil {
+		t.Fatalf("failed to list checkpoints: %v", err)
+	}
+
+	if err := os.Remove(filepath.Join(h.storeDir, "metadata.db")); err != nil {
+		t.Fatalf("failed to remove metadata.db: %v", err)
+	}
+	if lost, _ := h.ListCheckpoints(); len(lost) != 0 {
+		t.Fatalf("expected no checkpoints without metadata.db, got %d", len(lost))
+	}
+
+	output, err := h.RunAgentFSInStore("repair", "--rebuild-db", "-f")
+	if err != nil {
+		t.Fatalf("repair --rebuild-db failed: %v\n%s", err, output)
+	}
+
+	after, err := h.ListCheckpoints()
+	if err != nil {
+		t.Fatalf("failed to list checkpoints: %v", err)
+	}
+	if len(after) != len(before) {
+		t.Fatalf("expected %d checkpoints after rebuild, got %d", len(before), len(after))
+	}
+	for i := range before {
+		b, a := before[i], after[i]
+		if a.Version != b.Version || a.Message != b.Message || a.CreatedAt != b.CreatedAt || a.DurationMs != b.DurationMs {
+			t.Errorf("checkpoint %s: expected %+v, got %+v", b.Version, b, a)
+		}
+		if (a.ParentVersion == nil) != (b.ParentVersion == nil) ||
+			(a.ParentVersion != nil && *a.ParentVersion != *b.ParentVersion) {
+			t.Errorf("checkpoint %s: parent_version not preserved", b.Version)
+		}
+	}
+	// Repairing again keeps the earlier backup
+	backup := filepath.Join(h.storeDir, "metadata.db.bak")
+	first, err := os.ReadFile(backup)
+	if err != nil {
+		t.Fatalf("expected a backup at %s: %v", backup, err)
+	}
+	if output, err := h.RunAgentFSInStore("repair", "--rebuild-db", "-f"); err != nil {
+		t.Fatalf("second repair --rebuild-db failed: %v\n%s", err, output)
+	}
+	if content, err := os.ReadFile(backup); err != nil || string(content) != string(first) {
+		t.Errorf("expected the first backup to be kept (err: %v)", err)
+	}
+	if _, err := os.Stat(backup + ".1"); err != nil {
+		t.Errorf("expected the second backup at metadata.db.bak.1: %v", err)
+	}
+}
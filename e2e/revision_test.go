@@ -0,0 +1,59 @@
+package e2e
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestRevisions_ResolveExpressions tests the revision forms accepted in place of a version
+func TestRevisions_ResolveExpressions(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.CreateStore("test-revisions")
+
+	for _, msg := range []string{"first", "refactor parser", "third", "fourth"} {
+		if _, err := h.CreateCheckpoint(msg); err != nil {
+			t.Fatalf("failed to create checkpoint: %v", err)
+		}
+	}
+	if output, err := h.RunAgentFSInStore("tag", "green", "v2"); err != nil {
+		t.Fatalf("tag failed: %v\n%s", err, output)
+	}
+
+	tests := []struct {
+		rev  string
+		want string
+	}{
+		{"latest", "v4"},
+		{"latest~3", "v1"},
+		{"v4^", "v3"},
+		{"v4^^", "v2"},
+		{"green~", "v1"},
+		{":/refactor", "v2"},
+		{"@{now}", "v4"},
+	}
+	for _, tt := range tests {
+		info, err := h.GetCheckpointInfo(tt.rev)
+		if err != nil {
+			t.Errorf("checkpoint info %s failed: %v", tt.rev, err)
+			continue
+		}
+		if info.Version != tt.want {
+			t.Errorf("expected %s to be %s, got %s", tt.rev, tt.want, info.Version)
+		}
+	}
+
+	// Walking past the first checkpoint names no checkpoint
+	output, err := h.RunAgentFSInStore("checkpoint", "info", "latest~9")
+	if err == nil {
+		t.Fatal("expected latest~9 to fail")
+	}
+	if !strings.Contains(output, "v1 has no parent") {
+		t.Errorf("expected a missing-parent error, got:\n%s", output)
+	}
+
+	if _, err := h.RunAgentFSInStore("checkpoint", "info", "@{1 hour ago}"); err == nil {
+		t.Error("expected @{1 hour ago} to predate every checkpoint")
+	}
+}
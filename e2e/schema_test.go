@@ -0,0 +1,45 @@
+package e2e
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// TestSchema_RefusesNewerDatabase tests that a store migrated by a newer
+// agentfs isn't opened (and so can't be modified) by this one
+func TestSchema_RefusesNewerDatabase(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.CreateStore("test-schema")
+
+	if _, err := h.CreateCheckpoint("first"); err != nil {
+		t.Fatalf("failed to create checkpoint: %v", err)
+	}
+
+	database, err := sql.Open("sqlite3", filepath.Join(h.storeDir, "metadata.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	_, err = database.Exec(`UPDATE schema_version SET version = version + 1 WHERE component = 'db'`)
+	database.Close()
+	if err != nil {
+		t.Fatalf("failed to bump schema version: %v", err)
+	}
+
+	output, err := h.RunAgentFSInStore("checkpoint", "create", "second")
+	if err == nil {
+		t.Fatalf("expected checkpoint create to fail on a newer schema\n%s", output)
+	}
+	if !strings.Contains(output, "newer than this agentfs") {
+		t.Errorf("expected schema error, got:\n%s", output)
+	}
+
+	if checkpoints, _ := h.ListCheckpoints(); len(checkpoints) != 0 {
+		t.Errorf("expected checkpoints to be unreadable, got %d", len(checkpoints))
+	}
+}
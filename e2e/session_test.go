@@ -0,0 +1,112 @@
+package e2e
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSession_ListDiffRevert tests that checkpoints are grouped by the agent
+// session that created them, and that a session's work can be diffed and undone
+func TestSession_ListDiffRevert(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.CreateStore("test-session")
+
+	testFile := filepath.Join(h.mountDir, "test.txt")
+	newFile := filepath.Join(h.mountDir, "new.txt")
+	if err := os.WriteFile(testFile, []byte("before"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	h.CreateCheckpoint("before agent")
+
+	const sessionA = "a11ce000-0000-4000-8000-000000000001"
+	const sessionB = "b0b00000-0000-4000-8000-000000000002"
+	hookCheckpoint := func(session, path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+		cmd := exec.Command(h.agentfsBin, "checkpoint", "create", "--auto", "--from-hook")
+		cmd.Dir = h.mountDir
+		cmd.Stdin = strings.NewReader(`{"session_id":"` + session + `","tool_name":"Write","hook_event_name":"PostToolUse","tool_input":{"file_path":"` + path + `"}}`)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("auto checkpoint failed: %v\n%s", err, output)
+		}
+	}
+	hookCheckpoint(sessionA, testFile, "during A")
+	hookCheckpoint(sessionA, newFile, "added by A")
+	hookCheckpoint(sessionB, testFile, "during B")
+
+	// list: most recently active first
+	output, err := h.RunAgentFSInStore("session", "list", "--json")
+	if err != nil {
+		t.Fatalf("session list failed: %v\n%s", err, output)
+	}
+	var sessions []struct {
+		ID          string `json:"id"`
+		Checkpoints int    `json:"checkpoints"`
+		First       string `json:"first"`
+		Last        string `json:"last"`
+	}
+	if err := json.Unmarshal([]byte(output), &sessions); err != nil {
+		t.Fatalf("failed to parse session list: %v\n%s", err, output)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d: %s", len(sessions), output)
+	}
+	if sessions[0].ID != sessionB || sessions[1].ID != sessionA {
+		t.Errorf("expected sessions B then A, got %s then %s", sessions[0].ID, sessions[1].ID)
+	}
+	if a := sessions[1]; a.Checkpoints != 2 || a.First != "v2" || a.Last != "v3" {
+		t.Errorf("expected session A to be v2..v3 with 2 checkpoints, got %+v", a)
+	}
+
+	// diff: from v1 (the state before A) to v3, by ID prefix
+	output, err = h.RunAgentFSInStore("session", "diff", "a11ce", "--json")
+	if err != nil {
+		t.Fatalf("session diff failed: %v\n%s", err, output)
+	}
+	var result struct {
+		Changes []struct {
+			Path string `json:"path"`
+			Type string `json:"type"`
+		} `json:"changes"`
+	}
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		t.Fatalf("failed to parse session diff: %v\n%s", err, output)
+	}
+	changes := make(map[string]string)
+	for _, c := range result.Changes {
+		changes[c.Path] = c.Type
+	}
+	if changes["test.txt"] != "modified" || changes["new.txt"] != "added" || len(changes) != 2 {
+		t.Errorf("expected test.txt modified and new.txt added, got %s", output)
+	}
+
+	// revert: back to v1, keeping the current state as a pre-restore checkpoint
+	output, err = h.RunAgentFS("session", "revert", "a11ce", "--store", h.storeDir, "-f")
+	if err != nil {
+		t.Fatalf("session revert failed: %v\n%s", err, output)
+	}
+	if !strings.Contains(output, "restored v1") {
+		t.Errorf("expected revert to restore v1, got: %s", output)
+	}
+	if content, err := os.ReadFile(testFile); err != nil || string(content) != "before" {
+		t.Errorf("expected test.txt to be reverted to 'before', got %q (err: %v)", content, err)
+	}
+	if _, err := os.Stat(newFile); !os.IsNotExist(err) {
+		t.Errorf("expected new.txt to be removed by revert")
+	}
+	if cp, err := h.GetCheckpointInfo("v5"); err != nil || cp.Message != "pre-restore" {
+		t.Errorf("expected v5 to be a pre-restore checkpoint, got %+v (err: %v)", cp, err)
+	}
+
+	if output, err := h.RunAgentFSInStore("session", "diff", "ffffffff"); err == nil {
+		t.Errorf("expected session diff of an unknown session to fail, got: %s", output)
+	}
+}
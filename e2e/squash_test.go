@@ -0,0 +1,174 @@
+package e2e
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSquash_CollapsesRange tests squashing a line of checkpoints into its
+// last one, re-parenting a fork and keeping the squashed messages
+func TestSquash_CollapsesRange(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.CreateStore("test-squash")
+
+	testFile := filepath.Join(h.mountDir, "test.txt")
+	for _, content := range []string{"one", "two", "three", "four"} {
+		if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+		if _, err := h.CreateCheckpoint("Edit test.txt " + content); err != nil {
+			t.Fatalf("failed to create checkpoint: %v", err)
+		}
+	}
+
+	// Restoring v2 saves v4's state as v5, forked from v2
+	if err := h.RestoreCheckpoint("v2"); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+
+	// A tag inside the range would end up on a different state
+	if output, err := h.RunAgentFSInStore("tag", "mid", "v3"); err != nil {
+		t.Fatalf("tag failed: %v\n%s", err, output)
+	}
+	if output, err := h.RunAgentFS("squash", "--store", h.storeDir, "v2", "v4", "-m", "session"); err == nil {
+		t.Fatalf("expected squash over a tagged checkpoint to fail:\n%s", output)
+	}
+	if output, err := h.RunAgentFSInStore("tag", "-d", "mid"); err != nil {
+		t.Fatalf("tag -d failed: %v\n%s", err, output)
+	}
+
+	output, err := h.RunAgentFS("squash", "--store", h.storeDir, "v2", "v4", "-m", "session", "--json")
+	if err != nil {
+		t.Fatalf("squash failed: %v\n%s", err, output)
+	}
+	var result struct {
+		Deleted    []string `json:"deleted"`
+		Reparented []string `json:"reparented"`
+	}
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		t.Fatalf("failed to parse squash output: %v\n%s", err, output)
+	}
+	if strings.Join(result.Deleted, ",") != "v3,v2" || strings.Join(result.Reparented, ",") != "v5" {
+		t.Errorf("expected v3,v2 deleted and v5 re-parented, got %v and %v", result.Deleted, result.Reparented)
+	}
+
+	var info struct {
+		Message       string `json:"message"`
+		ParentVersion *int   `json:"parent_version"`
+		Squashed      []struct {
+			Version string `json:"version"`
+			Message string `json:"message"`
+		} `json:"squashed"`
+	}
+	output, err = h.RunAgentFSInStore("checkpoint", "info", "v4", "--json")
+	if err != nil {
+		t.Fatalf("checkpoint info failed: %v\n%s", err, output)
+	}
+	if err := json.Unmarshal([]byte(output), &info); err != nil {
+		t.Fatalf("failed to parse info: %v\n%s", err, output)
+	}
+	if info.Message != "session" || info.ParentVersion == nil || *info.ParentVersion != 1 {
+		t.Errorf("expected v4 \"session\" with parent v1, got %q with parent %v", info.Message, info.ParentVersion)
+	}
+	var squashed []string
+	for _, sq := range info.Squashed {
+		squashed = append(squashed, sq.Version+" "+sq.Message)
+	}
+	if got := strings.Join(squashed, ", "); got != "v2 Edit test.txt two, v3 Edit test.txt three, v4 Edit test.txt four" {
+		t.Errorf("unexpected squashed messages: %s", got)
+	}
+
+	fork, err := h.GetCheckpointInfo("v5")
+	if err != nil {
+		t.Fatalf("checkpoint info failed: %v", err)
+	}
+	if fork.ParentVersion == nil || *fork.ParentVersion != 4 {
+		t.Errorf("expected v5 to continue from v4, got %v", fork.ParentVersion)
+	}
+
+	// The surviving checkpoint holds the final state
+	if err := h.RestoreCheckpoint("v4"); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	content, err := os.ReadFile(testFile)
+	if err != nil || string(content) != "four" {
+		t.Errorf("expected v4 to hold \"four\", got %q, %v", content, err)
+	}
+}
+
+// TestSquash_MergeFromRange tests that a merge of two checkpoints folded into
+// the same one stops being a merge
+func TestSquash_MergeFromRange(t *testing.T) {
+	// Exact parents: volume backends may save pre-switch checkpoints on remount
+	t.Setenv("AGENTFS_BACKEND", "dir")
+
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.CreateStore("test-squash-merge")
+
+	testFile := filepath.Join(h.mountDir, "test.txt")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+	run := func(args ...string) {
+		t.Helper()
+		if output, err := h.RunAgentFS(append(args, "--store", h.storeDir)...); err != nil {
+			t.Fatalf("%s failed: %v\n%s", args[0], err, output)
+		}
+	}
+
+	write("one")
+	h.CreateCheckpoint("one")
+	write("two")
+	h.CreateCheckpoint("two")
+
+	// side continues from v1 and merges v2
+	run("switch", "-f", "-c", "side", "v1")
+	output, err := h.RunAgentFSInStore("merge", "main", "--json")
+	if err != nil {
+		t.Fatalf("merge failed: %v\n%s", err, output)
+	}
+	var merge mergeJSON
+	if err := json.Unmarshal([]byte(output), &merge); err != nil {
+		t.Fatalf("failed to parse merge output: %v\n%s", err, output)
+	}
+
+	run("switch", "-f", "main")
+	write("four")
+	last, err := h.CreateCheckpoint("four")
+	if err != nil {
+		t.Fatalf("failed to create checkpoint: %v", err)
+	}
+
+	output, err = h.RunAgentFS("squash", "--store", h.storeDir, "v1", last.Version, "-m", "main", "--json")
+	if err != nil {
+		t.Fatalf("squash failed: %v\n%s", err, output)
+	}
+	var result struct {
+		Reparented []string `json:"reparented"`
+	}
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		t.Fatalf("failed to parse squash output: %v\n%s", err, output)
+	}
+	if strings.Join(result.Reparented, ",") != merge.Checkpoint {
+		t.Errorf("expected only %s re-parented, got %v", merge.Checkpoint, result.Reparented)
+	}
+
+	cp, err := h.GetCheckpointInfo(merge.Checkpoint)
+	if err != nil {
+		t.Fatalf("checkpoint info failed: %v", err)
+	}
+	if cp.ParentVersion == nil || fmt.Sprintf("v%d", *cp.ParentVersion) != last.Version || cp.MergeParent != nil {
+		t.Errorf("expected %s to continue from %s without a merge parent, got parent %v and merge parent %v", merge.Checkpoint, last.Version, cp.ParentVersion, cp.MergeParent)
+	}
+}
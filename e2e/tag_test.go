@@ -0,0 +1,70 @@
+package e2e
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestTags_RestoreByName tests tagging a checkpoint and using the tag as a version
+func TestTags_RestoreByName(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.CreateStore("test-tags")
+
+	if _, err := h.CreateCheckpoint("first"); err != nil {
+		t.Fatalf("failed to create checkpoint: %v", err)
+	}
+	if output, err := h.RunAgentFSInStore("tag", "green-tests"); err != nil {
+		t.Fatalf("tag failed: %v\n%s", err, output)
+	}
+
+	testFile := filepath.Join(h.mountDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("changed"), 0644); err != nil {
+		t.Fatalf("failed to modify file: %v", err)
+	}
+	if _, err := h.CreateCheckpoint("second"); err != nil {
+		t.Fatalf("failed to create checkpoint: %v", err)
+	}
+
+	// Tags can't shadow versions, and aren't overwritten without -f
+	if _, err := h.RunAgentFSInStore("tag", "v2"); err == nil {
+		t.Error("expected a version-like tag name to be rejected")
+	}
+	if _, err := h.RunAgentFSInStore("tag", "green-tests"); err == nil {
+		t.Error("expected an existing tag to be kept without -f")
+	}
+
+	info, err := h.GetCheckpointInfo("green-tests")
+	if err != nil {
+		t.Fatalf("checkpoint info by tag failed: %v", err)
+	}
+	if info.Version != "v1" {
+		t.Errorf("expected green-tests to be v1, got %s", info.Version)
+	}
+
+	output, err := h.RunAgentFSInStore("diff", "green-tests", "--name-only")
+	if err != nil {
+		t.Fatalf("diff by tag failed: %v\n%s", err, output)
+	}
+	if !strings.Contains(output, "test.txt") {
+		t.Errorf("expected test.txt in diff, got:\n%s", output)
+	}
+
+	if err := h.RestoreCheckpoint("green-tests"); err != nil {
+		t.Fatalf("restore by tag failed: %v", err)
+	}
+	content, err := os.ReadFile(testFile)
+	if err != nil || string(content) != "test content" {
+		t.Errorf("test.txt not restored: %q, %v", content, err)
+	}
+
+	if output, err := h.RunAgentFSInStore("tag", "-d", "green-tests"); err != nil {
+		t.Fatalf("tag -d failed: %v\n%s", err, output)
+	}
+	if _, err := h.GetCheckpointInfo("green-tests"); err == nil {
+		t.Error("expected deleted tag to no longer resolve")
+	}
+}
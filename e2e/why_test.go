@@ -0,0 +1,116 @@
+package e2e
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestWhy_ToolCallAttribution tests that PreToolUse/PostToolUse checkpoints
+// are paired per tool call and that why reports the calls that changed a file
+func TestWhy_ToolCallAttribution(t *testing.T) {
+	h := NewTestHelper(t)
+	defer h.Cleanup()
+
+	h.CreateStore("test-why")
+
+	appFile := filepath.Join(h.mountDir, "app.txt")
+	if err := os.WriteFile(appFile, []byte("v1"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	h.CreateCheckpoint("base")
+
+	hook := func(event, tool, id, input string) {
+		t.Helper()
+		cmd := exec.Command(h.agentfsBin, "checkpoint", "create", "--auto", "--from-hook")
+		cmd.Dir = h.mountDir
+		cmd.Stdin = strings.NewReader(`{"session_id":"f55a4d56-0000-4000-8000-000000000001","tool_name":"` + tool +
+			`","tool_use_id":"` + id + `","hook_event_name":"` + event + `","tool_input":` + input + `}`)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%s checkpoint failed: %v\n%s", event, err, output)
+		}
+	}
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+
+	// A change made outside any tool call lands in the PreToolUse checkpoint
+	write(filepath.Join(h.mountDir, "notes.txt"), "by hand")
+	editInput := `{"file_path":"` + appFile + `"}`
+	hook("PreToolUse", "Edit", "toolu_edit", editInput)
+	write(appFile, "edited")
+	hook("PostToolUse", "Edit", "toolu_edit", editInput)
+
+	// A tool call that changes nothing is paired with the unchanged head
+	hook("PreToolUse", "Bash", "toolu_ls", `{"command":"ls"}`)
+	hook("PostToolUse", "Bash", "toolu_ls", `{"command":"ls"}`)
+
+	buildInput := `{"command":"make build"}`
+	hook("PreToolUse", "Bash", "toolu_make", buildInput)
+	write(appFile, "rebuilt by make")
+	write(filepath.Join(h.mountDir, "out", "app.bin"), "binary")
+	hook("PostToolUse", "Bash", "toolu_make", buildInput)
+
+	type callJSON struct {
+		ToolUseID string `json:"tool_use_id"`
+		ToolName  string `json:"tool_name"`
+		Input     string `json:"input"`
+		Before    string `json:"before"`
+		After     string `json:"after"`
+		Changes   []struct {
+			Path string `json:"path"`
+			Type string `json:"type"`
+		} `json:"changes"`
+	}
+	why := func(path string) []callJSON {
+		t.Helper()
+		output, err := h.RunAgentFSInStore("why", path, "--json")
+		if err != nil {
+			t.Fatalf("why %s failed: %v\n%s", path, err, output)
+		}
+		var calls []callJSON
+		if err := json.Unmarshal([]byte(output), &calls); err != nil {
+			t.Fatalf("failed to parse why: %v\n%s", err, output)
+		}
+		return calls
+	}
+
+	calls := why("app.txt")
+	if len(calls) != 2 {
+		t.Fatalf("expected 2 tool calls to have changed app.txt, got %+v", calls)
+	}
+	if calls[0].ToolUseID != "toolu_make" || calls[0].Input != "make build" || calls[0].Before != "v3" || calls[0].After != "v4" {
+		t.Errorf("expected make build (v3 → v4) to be the latest change, got %+v", calls[0])
+	}
+	if calls[1].ToolUseID != "toolu_edit" || calls[1].Input != appFile || calls[1].Before != "v2" || calls[1].After != "v3" {
+		t.Errorf("expected Edit (v2 → v3) to be the first change, got %+v", calls[1])
+	}
+
+	// Directories match the files under them; absolute paths are accepted
+	calls = why(filepath.Join(h.mountDir, "out"))
+	if len(calls) != 1 || calls[0].ToolName != "Bash" || len(calls[0].Changes) != 1 ||
+		calls[0].Changes[0].Path != "out/app.bin" || calls[0].Changes[0].Type != "added" {
+		t.Errorf("expected make build to have added out/app.bin, got %+v", calls)
+	}
+
+	if calls := why("notes.txt"); len(calls) != 0 {
+		t.Errorf("expected no tool call to have changed notes.txt, got %+v", calls)
+	}
+
+	cp, err := h.GetCheckpointInfo("v2")
+	if err != nil {
+		t.Fatalf("checkpoint info failed: %v", err)
+	}
+	if !strings.HasPrefix(cp.Message, "before Edit") {
+		t.Errorf("expected v2 to be labeled as the state before Edit, got %q", cp.Message)
+	}
+}
@@ -0,0 +1,165 @@
+package checkpoint
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sleexyz/agentfs/internal/db"
+)
+
+// ValidateBranchName checks that a branch name can't be mistaken for a
+// version or another kind of revision
+func ValidateBranchName(name string) error {
+	return validateRefName("branch", name)
+}
+
+// SwitchResult describes what Switch did
+type SwitchResult struct {
+	Branch   *db.Branch
+	Saved    *db.Checkpoint // Checkpoint of unsaved changes on the previous branch, if any
+	Restored *db.Checkpoint // Head restored to the working copy (nil if it was already there)
+	Duration time.Duration
+}
+
+// CurrentBranch returns the name of the branch new checkpoints are added to
+func (m *Manager) CurrentBranch() (string, error) {
+	return m.database.CurrentBranch()
+}
+
+// Head returns the checkpoint the working copy was last checkpointed or
+// restored as: the current branch's head, or the latest checkpoint if the
+// branch has none (or its head was deleted along with its parents)
+func (m *Manager) Head() (*db.Checkpoint, error) {
+	name, err := m.database.CurrentBranch()
+	if err != nil {
+		return nil, err
+	}
+	branch, err := m.database.GetBranch(name)
+	if err != nil {
+		return nil, err
+	}
+	if branch != nil && branch.HeadVersion != nil {
+		cp, err := m.database.GetCheckpoint(*branch.HeadVersion)
+		if err != nil || cp != nil {
+			return cp, err
+		}
+	}
+	return m.database.GetLatestCheckpoint()
+}
+
+// setHead points the current branch at a checkpoint
+func (m *Manager) setHead(version int) {
+	name, err := m.database.CurrentBranch()
+	if err == nil {
+		err = m.database.SetBranchHead(name, version)
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		fmt.Fprintf(os.Stderr, "warning: failed to update branch head: %v\n", err)
+	}
+}
+
+// CreateBranch creates a branch whose head is the given checkpoint
+func (m *Manager) CreateBranch(name string, version int) error {
+	if err := ValidateBranchName(name); err != nil {
+		return err
+	}
+	cp, err := m.database.GetCheckpoint(version)
+	if err != nil {
+		return err
+	}
+	if cp == nil {
+		return fmt.Errorf("checkpoint v%d not found", version)
+	}
+	return m.database.CreateBranch(name, &version)
+}
+
+// DeleteBranch deletes a branch other than the current one. Its checkpoints
+// are kept.
+func (m *Manager) DeleteBranch(name string) (*db.Branch, error) {
+	branch, err := m.database.GetBranch(name)
+	if err != nil {
+		return nil, err
+	}
+	if branch == nil {
+		return nil, fmt.Errorf("branch %q not found", name)
+	}
+	current, err := m.database.CurrentBranch()
+	if err != nil {
+		return nil, err
+	}
+	if name == current {
+		return nil, fmt.Errorf("can't delete the current branch %q (switch to another branch first)", name)
+	}
+	if err := m.database.DeleteBranch(name); err != nil {
+		return nil, err
+	}
+	return branch, nil
+}
+
+// ListBranches returns all branches ordered by name
+func (m *Manager) ListBranches() ([]*db.Branch, error) {
+	return m.database.ListBranches()
+}
+
+// Switch makes another branch current. Unsaved changes are checkpointed on
+// the current branch as "pre-switch", then the working copy is restored to
+// the new branch's head.
+func (m *Manager) Switch(name string) (*SwitchResult, error) {
+	start := time.Now()
+
+	branch, err := m.database.GetBranch(name)
+	if err != nil {
+		return nil, err
+	}
+	if branch == nil {
+		return nil, fmt.Errorf("branch %q not found", name)
+	}
+	previous, err := m.database.CurrentBranch()
+	if err != nil {
+		return nil, err
+	}
+	if name == previous {
+		return nil, fmt.Errorf("already on branch %q", name)
+	}
+
+	result := &SwitchResult{Branch: branch}
+
+	// Save the previous branch's work so it isn't lost by the restore
+	changed := true
+	if m.store.IsMounted(m.s) {
+		changed, err = m.HasChanges()
+		if err != nil {
+			return nil, fmt.Errorf("failed to check for changes: %w", err)
+		}
+		if changed {
+			result.Saved, _, err = m.Create(CreateOpts{Message: "pre-switch"})
+			if err != nil {
+				return nil, fmt.Errorf("failed to checkpoint changes on %s: %w", previous, err)
+			}
+		}
+	}
+
+	current, err := m.Head()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.database.SetCurrentBranch(name); err != nil {
+		return nil, err
+	}
+
+	// Restore the branch's head, unless the working copy is already there
+	// (a branch just created from it)
+	if branch.HeadVersion != nil && (changed || current == nil || current.Version != *branch.HeadVersion) {
+		result.Restored, _, err = m.Restore(*branch.HeadVersion, false)
+		if err != nil {
+			m.database.SetCurrentBranch(previous)
+			return nil, err
+		}
+	}
+
+	result.Duration = time.Since(start)
+	return result, nil
+}
@@ -0,0 +1,205 @@
+package checkpoint
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/sleexyz/agentfs/internal/clone"
+	"github.com/sleexyz/agentfs/internal/db"
+	"github.com/sleexyz/agentfs/internal/store"
+)
+
+// HasChanges checks if there are changes since the current branch's head.
+//
+// Backends that implement store.ChangeDetector compare the working copy
+// themselves. For volume backends, each data file (band) whose size, mtime and
+// ctime still match the state recorded at the last checkpoint is unchanged;
+// any other band is hashed and compared with the checkpoint's copy, whose hash
+// is cached in the database.
+func (m *Manager) HasChanges() (bool, error) {
+	// Get the checkpoint the working copy was last saved or restored as
+	latestCp, err := m.Head()
+	if err != nil {
+		return false, err
+	}
+	if latestCp == nil {
+		// No previous checkpoint = always has changes
+		return true, nil
+	}
+
+	// Flush pending writes so they reach the data files
+	m.sync()
+
+	snapshotPath := filepath.Join(m.store.GetCheckpointsPath(m.s), fmt.Sprintf("v%d", latestCp.Version))
+
+	switch b := m.s.Backend.(type) {
+	case store.ChangeDetector:
+		return b.HasChanges(m.s, snapshotPath)
+	case store.VolumeBackend:
+		return m.bandsChanged(b, latestCp, snapshotPath)
+	}
+	return true, nil
+}
+
+// bandsChanged compares the live data files with the checkpoint at snapshotPath
+func (m *Manager) bandsChanged(vb store.VolumeBackend, cp *db.Checkpoint, snapshotPath string) (bool, error) {
+	live, err := vb.DataFiles(m.s)
+	if err != nil {
+		return false, err
+	}
+
+	// A band added or removed since the checkpoint is a change
+	entries, err := os.ReadDir(snapshotPath)
+	if err != nil {
+		return false, err
+	}
+	if len(entries) != len(live) {
+		return true, nil
+	}
+	for _, entry := range entries {
+		if _, ok := live[entry.Name()]; !ok {
+			return true, nil
+		}
+	}
+
+	recorded, err := m.database.GetBandStates(cp.ID)
+	if err != nil {
+		return false, err
+	}
+
+	// Bands verified by content are saved with their new stat, so they
+	// aren't hashed again until they change
+	var verified []*db.BandState
+	defer func() {
+		if len(verified) > 0 {
+			m.database.SaveBandStates(cp.ID, verified)
+		}
+	}()
+
+	for name, path := range live {
+		st, err := statBand(name, path)
+		if err != nil {
+			return false, err
+		}
+
+		rec := recorded[name]
+		if rec != nil && rec.Size == st.Size && rec.MtimeNs == st.MtimeNs && rec.CtimeNs == st.CtimeNs {
+			continue
+		}
+
+		// Candidate band: compare content with the checkpoint's copy
+		snapBand := filepath.Join(snapshotPath, name)
+		snapInfo, err := os.Stat(snapBand)
+		if err != nil {
+			return false, err
+		}
+		if snapInfo.Size() != st.Size {
+			return true, nil
+		}
+
+		snapHash := ""
+		if rec != nil {
+			snapHash = rec.Hash
+		}
+		if snapHash == "" {
+			if snapHash, err = hashBand(snapBand); err != nil {
+				return false, err
+			}
+			if rec != nil {
+				// Cache the checkpoint's hash under its original state
+				rec.Hash = snapHash
+				verified = append(verified, rec)
+			}
+		}
+
+		liveHash, err := hashBand(path)
+		if err != nil {
+			return false, err
+		}
+		if liveHash != snapHash {
+			return true, nil
+		}
+
+		st.Hash = snapHash
+		verified = append(verified, st)
+	}
+
+	return false, nil
+}
+
+// statBands records the current state of the store's data files (nil for
+// backends without data files)
+func (m *Manager) statBands() ([]*db.BandState, error) {
+	vb, ok := m.s.Backend.(store.VolumeBackend)
+	if !ok {
+		return nil, nil
+	}
+
+	live, err := vb.DataFiles(m.s)
+	if err != nil {
+		return nil, err
+	}
+
+	var states []*db.BandState
+	for name, path := range live {
+		st, err := statBand(name, path)
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, st)
+	}
+	return states, nil
+}
+
+// sync flushes filesystem buffers for the mount point
+func (m *Manager) sync() {
+	cmd := exec.Command("sync", "-f", m.s.MountPath)
+	cmd.Run() // Ignore errors, sync is best-effort
+}
+
+// statBand returns the size, mtime and ctime of a data file
+func statBand(name, path string) (*db.BandState, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &db.BandState{
+		Name:    name,
+		Size:    info.Size(),
+		MtimeNs: info.ModTime().UnixNano(),
+		CtimeNs: ctimeNs(info),
+	}, nil
+}
+
+// hashBand returns a SHA-256 over the data regions of a file (with their
+// offsets), so holes in sparse images aren't read
+func hashBand(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	size := info.Size()
+
+	h := sha256.New()
+	err = clone.DataRegions(f, size, func(start, end int64) error {
+		fmt.Fprintf(h, "%d:%d\n", start, end)
+		_, err := io.CopyN(h, f, end-start)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(h, "size:%d\n", size)
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/sleexyz/agentfs/internal/db"
+	"github.com/sleexyz/agentfs/internal/filehash"
 	"github.com/sleexyz/agentfs/internal/store"
 )
 
@@ -32,7 +33,9 @@ func NewManager(storeManager *store.Manager, database *db.DB, s *store.Store) *M
 // CreateOpts contains options for creating a checkpoint
 type CreateOpts struct {
 	Message       string
-	ParentVersion *int // Explicit parent version (if nil, uses latest checkpoint's version)
+	ParentVersion *int              // Explicit parent version (if nil, uses the current branch's head)
+	MergeParent   *int              // Second parent, for a merge of a checkpoint of this store
+	Meta          map[string]string // Key/value metadata (e.g., hook fields)
 }
 
 // Create creates a new checkpoint
@@ -40,13 +43,18 @@ func (m *Manager) Create(opts CreateOpts) (*db.Checkpoint, time.Duration, error)
 	start := time.Now()
 
 	// Check if mounted
-	if !m.store.IsMounted(m.s.MountPath) {
+	if !m.store.IsMounted(m.s) {
 		return nil, 0, fmt.Errorf("store '%s' is not mounted", m.s.Name)
 	}
 
 	// Sync filesystem buffers for the mount point
-	cmd := exec.Command("sync", "-f", m.s.MountPath)
-	cmd.Run() // Ignore errors, sync is best-effort
+	m.sync()
+
+	// The checkpoint goes on the current branch
+	branch, err := m.database.CurrentBranch()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get current branch: %w", err)
+	}
 
 	// Determine parent version
 	var parentVersion *int
@@ -54,36 +62,57 @@ func (m *Manager) Create(opts CreateOpts) (*db.Checkpoint, time.Duration, error)
 		// Explicit parent version provided
 		parentVersion = opts.ParentVersion
 	} else {
-		// Default to latest checkpoint's version
-		latestCp, err := m.database.GetLatestCheckpoint()
+		// Default to the head of the current branch
+		headCp, err := m.Head()
 		if err != nil {
-			return nil, 0, fmt.Errorf("failed to get latest checkpoint: %w", err)
+			return nil, 0, fmt.Errorf("failed to get branch head: %w", err)
 		}
-		if latestCp != nil {
-			parentVersion = &latestCp.Version
+		if headCp != nil {
+			parentVersion = &headCp.Version
 		}
-		// If no latest checkpoint, parentVersion stays nil (first checkpoint)
+		// If no head, parentVersion stays nil (first checkpoint)
 	}
 
-	// Get next version number
-	version, err := m.database.GetNextVersion()
+	// Reserve the next version number (allocated, recorded and journaled
+	// atomically); the checkpoint becomes the branch's head
+	cp := &db.Checkpoint{
+		Message:       opts.Message,
+		CreatedAt:     time.Now(),
+		ParentVersion: parentVersion,
+		MergeParent:   opts.MergeParent,
+		Branch:        branch,
+	}
+	opID, err := m.database.ReserveCheckpoint(cp, stepReserved)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to get next version: %w", err)
+		return nil, 0, fmt.Errorf("failed to reserve version: %w", err)
+	}
+	version := cp.Version
+
+	if len(opts.Meta) > 0 {
+		if err := m.database.SetMeta(version, opts.Meta); err != nil {
+			m.rollbackCheckpoint(opID, version)
+			return nil, 0, fmt.Errorf("failed to record metadata: %w", err)
+		}
 	}
 
 	// Get paths
-	bandsPath := m.store.GetBandsPath(m.s)
 	checkpointsPath := m.store.GetCheckpointsPath(m.s)
 	versionPath := filepath.Join(checkpointsPath, fmt.Sprintf("v%d", version))
 
-	// Clone bands directory using APFS reflink (cp -Rc)
-	// Use /bin/cp explicitly to ensure macOS native cp with clonefile support
-	cmd = exec.Command("/bin/cp", "-Rc", bandsPath+"/", versionPath+"/")
-	output, err := cmd.CombinedOutput()
+	// Record data file state before cloning, so later writes are always detected
+	bands, err := m.statBands()
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to create checkpoint: %w\n%s", err, output)
+		m.rollbackCheckpoint(opID, version)
+		return nil, 0, fmt.Errorf("failed to stat data files: %w", err)
 	}
 
+	// Clone the store's data into the checkpoint directory
+	if err := m.s.Backend.CloneSnapshot(m.s, versionPath); err != nil {
+		m.rollbackCheckpoint(opID, version)
+		return nil, 0, fmt.Errorf("failed to create checkpoint: %w", err)
+	}
+	m.database.SetOperationStep(opID, stepCloned)
+
 	// Update latest symlink
 	latestPath := filepath.Join(checkpointsPath, "latest")
 	os.Remove(latestPath) // Remove old symlink if exists
@@ -92,26 +121,68 @@ func (m *Manager) Create(opts CreateOpts) (*db.Checkpoint, time.Duration, error)
 		fmt.Fprintf(os.Stderr, "warning: failed to update latest symlink: %v\n", err)
 	}
 
-	// Calculate duration before recording to database
+	// Record duration
 	duration := time.Since(start)
+	cp.DurationMs = duration.Milliseconds()
+	if err := m.database.SetCheckpointDuration(version, cp.DurationMs); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to record checkpoint duration: %v\n", err)
+	}
 
-	// Record in database
-	cp := &db.Checkpoint{
-		Version:       version,
-		Message:       opts.Message,
-		CreatedAt:     time.Now(),
-		DurationMs:    duration.Milliseconds(),
-		ParentVersion: parentVersion,
+	// Keep a copy of the metadata next to the snapshot for 'agentfs repair --rebuild-db'
+	if err := m.writeSidecar(cp); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to write checkpoint metadata: %v\n", err)
 	}
-	if err := m.database.CreateCheckpoint(cp); err != nil {
-		// Clean up the checkpoint directory
-		os.RemoveAll(versionPath)
-		return nil, 0, fmt.Errorf("failed to record checkpoint: %w", err)
+
+	if len(bands) > 0 {
+		if err := m.database.SaveBandStates(cp.ID, bands); err != nil {
+			// Non-fatal, change detection falls back to hashing
+			fmt.Fprintf(os.Stderr, "warning: failed to record band state: %v\n", err)
+		}
+	}
+
+	// Index manifest-based snapshots so file versions can be queried by content
+	if mb, ok := m.s.Backend.(store.ManifestBackend); ok {
+		if err := m.indexManifest(cp, versionPath, mb); err != nil {
+			// Non-fatal, the manifest on disk is authoritative
+			fmt.Fprintf(os.Stderr, "warning: failed to index file versions: %v\n", err)
+		}
 	}
 
+	m.database.EndOperation(opID)
 	return cp, duration, nil
 }
 
+// rollbackCheckpoint removes a reserved checkpoint that couldn't be created
+func (m *Manager) rollbackCheckpoint(opID int64, version int) {
+	m.removeSnapshot(version)
+	m.database.UnreserveCheckpoint(opID, version)
+	m.database.EndOperation(opID)
+}
+
+// indexManifest records a snapshot's manifest in the file_versions table
+func (m *Manager) indexManifest(cp *db.Checkpoint, versionPath string, mb store.ManifestBackend) error {
+	entries, err := mb.ReadManifest(versionPath)
+	if err != nil {
+		return err
+	}
+
+	files := filehash.NewManager(m.database.SQL())
+
+	var results []filehash.HashResult
+	for _, e := range entries {
+		if e.Hash == "" {
+			continue // Symlinks have no content
+		}
+		results = append(results, filehash.HashResult{
+			Path:        e.Path,
+			ContentHash: e.Hash,
+			Size:        e.Size,
+			Mtime:       e.Mtime,
+		})
+	}
+	return files.StoreFileVersions(cp.ID, results)
+}
+
 // List returns all checkpoints
 func (m *Manager) List(limit int) ([]*db.Checkpoint, error) {
 	return m.database.ListCheckpoints(limit)
@@ -124,19 +195,42 @@ func (m *Manager) Get(version int) (*db.Checkpoint, error) {
 
 // Delete deletes a checkpoint
 func (m *Manager) Delete(version int) error {
-	// Delete checkpoint directory
-	checkpointsPath := m.store.GetCheckpointsPath(m.s)
-	versionPath := filepath.Join(checkpointsPath, fmt.Sprintf("v%d", version))
+	// Journal the delete so a partially removed checkpoint is finished later
+	opID, err := m.database.BeginOperation(db.OpDeleteCheckpoint, version, stepDeleting)
+	if err != nil {
+		return fmt.Errorf("failed to journal delete: %w", err)
+	}
+	return m.finishDelete(opID, version)
+}
 
-	if err := os.RemoveAll(versionPath); err != nil {
+// finishDelete deletes a checkpoint whose delete is journaled as opID
+func (m *Manager) finishDelete(opID int64, version int) error {
+	// Delete checkpoint directory and sidecar
+	if err := m.removeSnapshot(version); err != nil {
 		return fmt.Errorf("failed to delete checkpoint files: %w", err)
 	}
 
+	children, err := m.database.ListChildren(version)
+	if err != nil {
+		return fmt.Errorf("failed to list child checkpoints: %w", err)
+	}
+
 	// Delete from database
 	if err := m.database.DeleteCheckpoint(version); err != nil {
 		return fmt.Errorf("failed to delete checkpoint record: %w", err)
 	}
 
+	// Children now continue from the deleted checkpoint's parent
+	for _, child := range children {
+		m.syncSidecar(child)
+	}
+
+	// Deleting the newest checkpoint leaves latest dangling
+	if err := m.updateLatest(); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to update latest symlink: %v\n", err)
+	}
+
+	m.database.EndOperation(opID)
 	return nil
 }
 
@@ -163,8 +257,9 @@ func (m *Manager) Restore(version int, createPreRestore bool) (*db.Checkpoint, t
 
 	// Create pre-restore checkpoint if requested
 	// The pre-restore checkpoint's parent is the target version we're restoring to,
-	// which captures the "forked from vN" semantics
-	if createPreRestore && m.store.IsMounted(m.s.MountPath) {
+	// which captures the "forked from vN" semantics; it becomes the branch's head
+	preRestore := createPreRestore && m.store.IsMounted(m.s)
+	if preRestore {
 		_, _, err := m.Create(CreateOpts{
 			Message:       "pre-restore",
 			ParentVersion: &version,
@@ -174,51 +269,50 @@ func (m *Manager) Restore(version int, createPreRestore bool) (*db.Checkpoint, t
 		}
 	}
 
+	// Journal the restore so an interrupted one is completed by the next command
+	wasMounted := m.store.IsMounted(m.s)
+	step := stepRestoringUnmounted
+	if wasMounted {
+		step = stepRestoring
+	}
+	opID, err := m.database.BeginOperation(db.OpRestore, version, step)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to journal restore: %w", err)
+	}
+
 	// Unmount the store
-	wasMounted := m.store.IsMounted(m.s.MountPath)
 	if wasMounted {
 		if err := m.store.Unmount(m.s); err != nil {
+			m.database.EndOperation(opID)
 			return nil, 0, fmt.Errorf("failed to unmount: %w", err)
 		}
 	}
 
-	// Swap bands
-	bandsPath := m.store.GetBandsPath(m.s)
-	backupPath := bandsPath + ".pre-restore"
-
-	// Backup current bands
-	if err := os.Rename(bandsPath, backupPath); err != nil {
-		// Try to remount and fail
+	// Swap the store's data with the checkpoint
+	if err := m.s.Backend.RestoreSnapshot(m.s, targetPath); err != nil {
+		// Remount and fail
 		if wasMounted {
 			m.store.Mount(m.s)
 		}
-		return nil, 0, fmt.Errorf("failed to backup current bands: %w", err)
+		m.database.EndOperation(opID)
+		return nil, 0, err
 	}
 
-	// Clone target checkpoint to bands
-	// Use /bin/cp explicitly to ensure macOS native cp with clonefile support
-	cmd := exec.Command("/bin/cp", "-Rc", targetPath+"/", bandsPath+"/")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		// Restore backup and remount
-		os.RemoveAll(bandsPath)
-		os.Rename(backupPath, bandsPath)
-		if wasMounted {
-			m.store.Mount(m.s)
-		}
-		return nil, 0, fmt.Errorf("failed to restore checkpoint: %w\n%s", err, output)
+	// Without a pre-restore checkpoint, the branch continues from the target
+	if !preRestore {
+		m.setHead(version)
 	}
 
 	// Remount
 	if wasMounted {
+		m.database.SetOperationStep(opID, stepRestored)
 		if err := m.store.Mount(m.s); err != nil {
+			// Left journaled: the next command retries the mount
 			return nil, 0, fmt.Errorf("failed to remount after restore: %w", err)
 		}
 	}
 
-	// Clean up backup
-	os.RemoveAll(backupPath)
-
+	m.database.EndOperation(opID)
 	return cp, time.Since(start), nil
 }
 
@@ -254,7 +348,7 @@ func (m *Manager) Diff(fromVersion, toVersion int) (*DiffResult, error) {
 
 	if fromVersion == 0 {
 		// Current state
-		if !m.store.IsMounted(m.s.MountPath) {
+		if !m.store.IsMounted(m.s) {
 			return nil, fmt.Errorf("store must be mounted to diff against current state")
 		}
 		fromPath = m.s.MountPath
@@ -267,7 +361,7 @@ func (m *Manager) Diff(fromVersion, toVersion int) (*DiffResult, error) {
 
 	if toVersion == 0 {
 		// Current state
-		if !m.store.IsMounted(m.s.MountPath) {
+		if !m.store.IsMounted(m.s) {
 			return nil, fmt.Errorf("store must be mounted to diff against current state")
 		}
 		toPath = m.s.MountPath
@@ -351,67 +445,3 @@ func CountLines(fromFile, toFile string) (added, deleted int) {
 	}
 	return
 }
-
-// HasChanges checks if there are changes since the last checkpoint
-// by comparing band files (names + sizes) between current bands and last checkpoint
-func (m *Manager) HasChanges() (bool, error) {
-	// Get the latest checkpoint
-	latestCp, err := m.database.GetLatestCheckpoint()
-	if err != nil {
-		return false, err
-	}
-	if latestCp == nil {
-		// No previous checkpoint = always has changes
-		return true, nil
-	}
-
-	// Get paths
-	currentBands := m.store.GetBandsPath(m.s)
-	checkpointsPath := m.store.GetCheckpointsPath(m.s)
-	lastBands := filepath.Join(checkpointsPath, fmt.Sprintf("v%d", latestCp.Version))
-
-	// Compare directories by listing files with sizes
-	return !dirsEqual(currentBands, lastBands), nil
-}
-
-// listDirWithSizes returns a map of filename -> size for all files in a directory
-func listDirWithSizes(dir string) (map[string]int64, error) {
-	entries, err := os.ReadDir(dir)
-	if err != nil {
-		return nil, err
-	}
-
-	result := make(map[string]int64)
-	for _, entry := range entries {
-		info, err := entry.Info()
-		if err != nil {
-			continue
-		}
-		result[entry.Name()] = info.Size()
-	}
-	return result, nil
-}
-
-// dirsEqual compares two directories by file names and sizes
-func dirsEqual(dir1, dir2 string) bool {
-	entries1, err := listDirWithSizes(dir1)
-	if err != nil {
-		return false
-	}
-
-	entries2, err := listDirWithSizes(dir2)
-	if err != nil {
-		return false
-	}
-
-	if len(entries1) != len(entries2) {
-		return false
-	}
-
-	for name, size1 := range entries1 {
-		if size2, ok := entries2[name]; !ok || size1 != size2 {
-			return false
-		}
-	}
-	return true
-}
@@ -0,0 +1,115 @@
+package checkpoint
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sleexyz/agentfs/internal/context"
+	"github.com/sleexyz/agentfs/internal/db"
+	"github.com/sleexyz/agentfs/internal/diff"
+)
+
+// MetaCherryPickedFrom records the checkpoint whose changes a cherry-pick
+// replayed
+const MetaCherryPickedFrom = "cherry_picked_from"
+
+// CherryPickResult describes what CherryPick did
+type CherryPickResult struct {
+	Parent        int      // The parent the picked changes were computed against
+	Applied       []string // Files added, deleted or replaced as in the checkpoint
+	Merged        []string // Text files also changed in the working copy, patched without conflicts
+	Conflicts     []MergeConflict
+	PreCherryPick *db.Checkpoint // Unsaved changes from before, or nil if there were none
+	Checkpoint    *db.Checkpoint // The state after, or nil if the changes were already there
+}
+
+// CherryPick replays the changes a checkpoint made to its parent onto the
+// working copy. Added and deleted files are added and deleted; modified text
+// files are patched with diff3, so edits made since to other lines are kept
+// (overlapping ones get conflict markers). Conflicts are handled as for
+// Merge. Unsaved changes are checkpointed first, and the result is recorded
+// as a new checkpoint.
+func (m *Manager) CherryPick(version int) (*CherryPickResult, error) {
+	cp, err := m.database.GetCheckpoint(version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get checkpoint: %w", err)
+	}
+	if cp == nil {
+		return nil, fmt.Errorf("checkpoint v%d not found", version)
+	}
+	if cp.ParentVersion == nil {
+		return nil, fmt.Errorf("v%d has no parent to take its changes from", version)
+	}
+	if !m.store.IsMounted(m.s) {
+		return nil, fmt.Errorf("store must be mounted to cherry-pick")
+	}
+	parent := *cp.ParentVersion
+
+	// Read both from temporary mounts, never the snapshots themselves
+	differ := diff.NewDiffer(m.store, m.s)
+	baseRoot, cleanup, err := differ.MountCheckpoint(parent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mount v%d: %w", parent, err)
+	}
+	if cleanup != nil {
+		defer cleanup()
+	}
+	theirRoot, cleanup, err := differ.MountCheckpoint(version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mount v%d: %w", version, err)
+	}
+	if cleanup != nil {
+		defer cleanup()
+	}
+
+	changes, err := differ.CompareDirectories(baseRoot, theirRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff v%d: %w", version, err)
+	}
+	var paths []string
+	for i, change := range changes {
+		if change.Path == context.ContextFileName || (i > 0 && changes[i-1].Path == change.Path) {
+			continue
+		}
+		paths = append(paths, change.Path)
+	}
+
+	result := &CherryPickResult{Parent: parent}
+	changed, err := m.HasChanges()
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		if result.PreCherryPick, _, err = m.Create(CreateOpts{Message: "pre-cherry-pick"}); err != nil {
+			return nil, fmt.Errorf("failed to create pre-cherry-pick checkpoint: %w", err)
+		}
+	}
+
+	labels := [3]string{"current", fmt.Sprintf("parent (v%d)", parent), fmt.Sprintf("v%d", version)}
+	merge := &MergeResult{}
+	err = mergePaths(baseRoot, m.s.MountPath, theirRoot, paths, labels, merge)
+	result.Applied, result.Merged, result.Conflicts = merge.Applied, merge.Merged, merge.Conflicts
+	if err != nil {
+		return result, err
+	}
+
+	if changed, err = m.HasChanges(); err != nil || !changed {
+		return result, err
+	}
+	meta := map[string]string{MetaCherryPickedFrom: fmt.Sprintf("v%d", version)}
+	if len(result.Conflicts) > 0 {
+		var conflicts []string
+		for _, c := range result.Conflicts {
+			conflicts = append(conflicts, c.Path)
+		}
+		meta[MetaMergeConflicts] = strings.Join(conflicts, " ")
+	}
+	result.Checkpoint, _, err = m.Create(CreateOpts{
+		Message: fmt.Sprintf("cherry-pick v%d", version),
+		Meta:    meta,
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed to record cherry-pick: %w", err)
+	}
+	return result, nil
+}
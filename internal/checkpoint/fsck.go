@@ -0,0 +1,312 @@
+package checkpoint
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sleexyz/agentfs/internal/db"
+	"github.com/sleexyz/agentfs/internal/store"
+)
+
+// Issue kinds reported by Fsck
+const (
+	IssueMissingSnapshot  = "missing-snapshot"  // Checkpoint recorded, vN directory missing
+	IssueOrphanSnapshot   = "orphan-snapshot"   // vN directory with no checkpoint record
+	IssueBadSnapshot      = "bad-snapshot"      // vN directory incomplete or corrupt
+	IssueChecksumMismatch = "checksum-mismatch" // Snapshot band differs from its recorded hash
+	IssueStaleLatest      = "stale-latest"      // latest symlink doesn't point at the newest checkpoint
+	IssueRestoreLeftover  = "restore-leftover"  // Staging or backup data from an interrupted restore
+	IssueBadData          = "bad-data"          // Live backend data incomplete or corrupt
+	IssueMissingSidecar   = "missing-sidecar"   // Checkpoint has no vN.json metadata
+	IssueStaleSidecar     = "stale-sidecar"     // vN.json with no snapshot
+)
+
+// FsckOpts contains options for checking a store
+type FsckOpts struct {
+	Verify bool // Re-hash snapshot data against recorded checksums
+	Repair bool // Fix what can be fixed
+}
+
+// Issue is a problem found by Fsck
+type Issue struct {
+	Kind     string
+	Version  int // Checkpoint version (0 if not checkpoint-specific)
+	Path     string
+	Message  string
+	Repaired bool
+}
+
+// FsckReport is the result of checking a store
+type FsckReport struct {
+	Checkpoints int // Checkpoints examined
+	Issues      []Issue
+}
+
+// Unrepaired returns the number of issues left unfixed
+func (r *FsckReport) Unrepaired() int {
+	n := 0
+	for _, issue := range r.Issues {
+		if !issue.Repaired {
+			n++
+		}
+	}
+	return n
+}
+
+// Fsck cross-checks the checkpoint records in the database with the snapshots
+// on disk, the backend's data files and the latest symlink.
+//
+// With Repair, orphaned snapshots are re-registered (from their sidecar when
+// present), records without a snapshot are dropped, sidecars are rewritten,
+// interrupted restores are cleaned up and latest is rebuilt. Corrupt
+// snapshots are only reported. The caller must hold the store lock.
+func (m *Manager) Fsck(opts FsckOpts) (*FsckReport, error) {
+	report := &FsckReport{}
+	checkpointsPath := m.store.GetCheckpointsPath(m.s)
+
+	checkpoints, err := m.database.ListCheckpoints(0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list checkpoints: %w", err)
+	}
+	versions, err := m.s.Backend.ListSnapshots(m.s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	onDisk := make(map[int]bool, len(versions))
+	for _, v := range versions {
+		onDisk[v] = true
+	}
+	recorded := make(map[int]*db.Checkpoint, len(checkpoints))
+	for _, cp := range checkpoints {
+		recorded[cp.Version] = cp
+	}
+
+	// Records without a snapshot
+	for _, cp := range checkpoints {
+		if onDisk[cp.Version] {
+			continue
+		}
+		issue := Issue{
+			Kind:    IssueMissingSnapshot,
+			Version: cp.Version,
+			Path:    m.versionPath(cp.Version),
+			Message: fmt.Sprintf("v%d is recorded but has no snapshot", cp.Version),
+		}
+		if opts.Repair {
+			issue.Repaired = m.database.DeleteCheckpoint(cp.Version) == nil
+			os.Remove(m.sidecarPath(cp.Version))
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+
+	// Snapshots without a record
+	for _, v := range versions {
+		if recorded[v] != nil {
+			continue
+		}
+		issue := Issue{
+			Kind:    IssueOrphanSnapshot,
+			Version: v,
+			Path:    m.versionPath(v),
+			Message: fmt.Sprintf("snapshot v%d has no checkpoint record", v),
+		}
+		if opts.Repair {
+			_, err := m.importSnapshot(v)
+			issue.Repaired = err == nil
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+
+	// Sidecar metadata (orphans imported above got one)
+	for _, cp := range checkpoints {
+		if !onDisk[cp.Version] {
+			continue
+		}
+		if _, err := os.Stat(m.sidecarPath(cp.Version)); err == nil {
+			continue
+		}
+		issue := Issue{
+			Kind:    IssueMissingSidecar,
+			Version: cp.Version,
+			Path:    m.sidecarPath(cp.Version),
+			Message: fmt.Sprintf("v%d has no metadata sidecar", cp.Version),
+		}
+		if opts.Repair {
+			issue.Repaired = m.writeSidecar(cp) == nil
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+	sidecars, _ := filepath.Glob(filepath.Join(checkpointsPath, "v*.json"))
+	for _, path := range sidecars {
+		v, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "v"), ".json"))
+		if err != nil || onDisk[v] || recorded[v] != nil {
+			continue // Records without a snapshot are reported above
+		}
+		issue := Issue{
+			Kind:    IssueStaleSidecar,
+			Version: v,
+			Path:    path,
+			Message: fmt.Sprintf("metadata sidecar for v%d has no snapshot", v),
+		}
+		if opts.Repair {
+			issue.Repaired = os.Remove(path) == nil
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+
+	// Snapshot contents
+	checker, _ := m.s.Backend.(store.Checker)
+	for _, v := range versions {
+		report.Checkpoints++
+		if checker != nil {
+			for _, p := range checker.CheckSnapshot(m.s, m.versionPath(v), opts.Verify) {
+				report.Issues = append(report.Issues, Issue{Kind: IssueBadSnapshot, Version: v, Path: p.Path, Message: p.Message})
+			}
+		}
+		if cp := recorded[v]; cp != nil {
+			report.Issues = append(report.Issues, m.checkBands(cp, opts.Verify)...)
+		}
+	}
+
+	// Live data
+	if checker != nil {
+		for _, p := range checker.CheckData(m.s, opts.Repair) {
+			report.Issues = append(report.Issues, Issue{Kind: IssueBadData, Path: p.Path, Message: p.Message, Repaired: p.Repaired})
+		}
+	}
+
+	// Interrupted restores (journaled ones are recovered before Fsck runs)
+	leftovers := restoreLeftovers(m.s)
+	for _, path := range leftovers {
+		report.Issues = append(report.Issues, Issue{
+			Kind:    IssueRestoreLeftover,
+			Path:    path,
+			Message: fmt.Sprintf("leftover %s from an interrupted restore", filepath.Base(path)),
+		})
+	}
+	if opts.Repair && len(leftovers) > 0 && m.s.Backend.RecoverRestore(m.s) == nil {
+		for i := range report.Issues {
+			if report.Issues[i].Kind == IssueRestoreLeftover {
+				report.Issues[i].Repaired = true
+			}
+		}
+	}
+
+	// latest symlink: the newest snapshot that has a record (after repairs)
+	want := ""
+	for _, v := range versions {
+		if recorded[v] != nil || opts.Repair {
+			want = fmt.Sprintf("v%d", v)
+		}
+	}
+	latestPath := filepath.Join(checkpointsPath, "latest")
+	if got, _ := os.Readlink(latestPath); got != want {
+		issue := Issue{Kind: IssueStaleLatest, Path: latestPath}
+		switch {
+		case want == "":
+			issue.Message = fmt.Sprintf("latest points to %s but there are no checkpoints", got)
+		case got == "":
+			issue.Message = fmt.Sprintf("latest is missing, expected %s", want)
+		default:
+			issue.Message = fmt.Sprintf("latest points to %s, expected %s", got, want)
+		}
+		if opts.Repair {
+			issue.Repaired = m.updateLatest() == nil
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+
+	return report, nil
+}
+
+// checkBands compares a volume snapshot's bands with the band state recorded
+// when it was created: every recorded band must exist, and with verify, each
+// band must match its cached hash. Bands hashed for the first time have their
+// hash recorded.
+func (m *Manager) checkBands(cp *db.Checkpoint, verify bool) []Issue {
+	if _, ok := m.s.Backend.(store.VolumeBackend); !ok {
+		return nil
+	}
+	states, err := m.database.GetBandStates(cp.ID)
+	if err != nil {
+		return []Issue{{Kind: IssueBadSnapshot, Version: cp.Version, Message: fmt.Sprintf("failed to read band state: %v", err)}}
+	}
+
+	names := make([]string, 0, len(states))
+	for name := range states {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var issues []Issue
+	var unhashed []*db.BandState
+	for _, name := range names {
+		st := states[name]
+		path := filepath.Join(m.versionPath(cp.Version), name)
+		if _, err := os.Stat(path); err != nil {
+			issues = append(issues, Issue{Kind: IssueBadSnapshot, Version: cp.Version, Path: path, Message: fmt.Sprintf("band %s is missing", name)})
+			continue
+		}
+		if !verify {
+			continue
+		}
+		hash, err := hashBand(path)
+		switch {
+		case err != nil:
+			issues = append(issues, Issue{Kind: IssueBadSnapshot, Version: cp.Version, Path: path, Message: fmt.Sprintf("failed to hash band %s: %v", name, err)})
+		case st.Hash == "":
+			// Nothing to compare yet: record the hash so later runs can
+			st.Hash = hash
+			unhashed = append(unhashed, st)
+		case hash != st.Hash:
+			issues = append(issues, Issue{Kind: IssueChecksumMismatch, Version: cp.Version, Path: path, Message: fmt.Sprintf("band %s does not match its recorded hash", name)})
+		}
+	}
+
+	if len(unhashed) > 0 {
+		m.database.SaveBandStates(cp.ID, unhashed)
+	}
+	return issues
+}
+
+// updateLatest points the latest symlink at the newest checkpoint, or removes
+// it if there are none
+func (m *Manager) updateLatest() error {
+	latestPath := filepath.Join(m.store.GetCheckpointsPath(m.s), "latest")
+	os.Remove(latestPath)
+
+	latest, err := m.database.GetLatestCheckpoint()
+	if err != nil || latest == nil {
+		return err
+	}
+	return os.Symlink(fmt.Sprintf("v%d", latest.Version), latestPath)
+}
+
+// versionPath returns the snapshot directory for a checkpoint version
+func (m *Manager) versionPath(version int) string {
+	return filepath.Join(m.store.GetCheckpointsPath(m.s), fmt.Sprintf("v%d", version))
+}
+
+// restoreLeftovers finds staging and backup copies left by RestoreSnapshot,
+// which backends keep next to their data (in the store or inside the bundle)
+func restoreLeftovers(s *store.Store) []string {
+	var leftovers []string
+	for _, dir := range []string{s.StorePath, s.BundlePath} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if strings.HasSuffix(name, ".pre-restore") || strings.HasSuffix(name, ".restoring") {
+				leftovers = append(leftovers, filepath.Join(dir, name))
+			}
+		}
+	}
+	return leftovers
+}
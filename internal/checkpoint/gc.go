@@ -0,0 +1,198 @@
+package checkpoint
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/sleexyz/agentfs/internal/db"
+	"github.com/sleexyz/agentfs/internal/store"
+)
+
+// Settings holding the retention policy
+const (
+	keepLastKey   = "retention.keep_last"
+	keepHourlyKey = "retention.keep_hourly"
+	keepDailyKey  = "retention.keep_daily"
+	autoGCKey     = "retention.auto_gc"
+)
+
+// Policy decides which checkpoints GC keeps. A checkpoint is kept if any rule
+// keeps it; tagged checkpoints and branch heads are always kept.
+type Policy struct {
+	KeepLast   int  // Keep the newest N checkpoints
+	KeepHourly int  // Keep the newest checkpoint of each hour, for the last N hours
+	KeepDaily  int  // Keep the newest checkpoint of each day, for the last N days
+	Auto       bool // Run GC after each new checkpoint
+}
+
+// IsSet reports whether the policy has any rules. GC deletes nothing without.
+func (p Policy) IsSet() bool {
+	return p.KeepLast > 0 || p.KeepHourly > 0 || p.KeepDaily > 0
+}
+
+// GCResult describes what GC deleted (or, for a dry run, would delete)
+type GCResult struct {
+	Deleted   []*db.Checkpoint
+	Kept      int
+	Objects   int   // Unreferenced objects pruned, for backends that share them
+	Reclaimed int64 // Bytes freed; blocks still shared with clones stay allocated
+}
+
+// Policy returns the store's retention policy
+func (m *Manager) Policy() (Policy, error) {
+	var p Policy
+	ints := map[string]*int{keepLastKey: &p.KeepLast, keepHourlyKey: &p.KeepHourly, keepDailyKey: &p.KeepDaily}
+	for key, dst := range ints {
+		value, err := m.database.GetSetting(key)
+		if err != nil {
+			return p, err
+		}
+		if value == "" {
+			continue
+		}
+		if *dst, err = strconv.Atoi(value); err != nil {
+			return p, fmt.Errorf("invalid setting %s=%q", key, value)
+		}
+	}
+	auto, err := m.database.GetSetting(autoGCKey)
+	if err != nil {
+		return p, err
+	}
+	p.Auto = auto == "true"
+	return p, nil
+}
+
+// SetPolicy stores the store's retention policy
+func (m *Manager) SetPolicy(p Policy) error {
+	settings := map[string]string{
+		keepLastKey:   strconv.Itoa(p.KeepLast),
+		keepHourlyKey: strconv.Itoa(p.KeepHourly),
+		keepDailyKey:  strconv.Itoa(p.KeepDaily),
+		autoGCKey:     strconv.FormatBool(p.Auto),
+	}
+	for key, value := range settings {
+		if err := m.database.SetSetting(key, value); err != nil {
+			return fmt.Errorf("failed to save %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// GC deletes the checkpoints the policy doesn't keep, then data no remaining
+// checkpoint references. With dryRun nothing is deleted, but the result
+// reports what would be.
+func (m *Manager) GC(p Policy, dryRun bool) (*GCResult, error) {
+	checkpoints, err := m.database.ListCheckpoints(0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list checkpoints: %w", err)
+	}
+	keep, err := m.retained(p, checkpoints, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	result := &GCResult{}
+	skip := make(map[int]bool)
+	for _, cp := range checkpoints {
+		if keep[cp.Version] {
+			result.Kept++
+			continue
+		}
+		result.Reclaimed += diskUsage(m.versionPath(cp.Version)) + diskUsage(m.sidecarPath(cp.Version))
+		if !dryRun {
+			if err := m.Delete(cp.Version); err != nil {
+				return result, fmt.Errorf("failed to delete v%d: %w", cp.Version, err)
+			}
+		}
+		result.Deleted = append(result.Deleted, cp)
+		skip[cp.Version] = true
+	}
+
+	// Deleted snapshots are gone from disk unless this is a dry run
+	if pruner, ok := m.s.Backend.(store.Pruner); ok {
+		objects, freed, err := pruner.PruneData(m.s, skip, dryRun)
+		if err != nil {
+			return result, fmt.Errorf("failed to prune unreferenced data: %w", err)
+		}
+		result.Objects = objects
+		result.Reclaimed += freed
+	}
+	return result, nil
+}
+
+// retained returns the versions to keep: those kept by the policy's rules,
+// tagged checkpoints, branch heads and HEAD. Without rules, all are kept.
+func (m *Manager) retained(p Policy, checkpoints []*db.Checkpoint, now time.Time) (map[int]bool, error) {
+	keep := make(map[int]bool)
+	if !p.IsSet() {
+		for _, cp := range checkpoints {
+			keep[cp.Version] = true
+		}
+		return keep, nil
+	}
+
+	tags, err := m.database.ListTags()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+	for _, t := range tags {
+		keep[t.Version] = true
+	}
+	branches, err := m.database.ListBranches()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list branches: %w", err)
+	}
+	for _, b := range branches {
+		if b.HeadVersion != nil {
+			keep[*b.HeadVersion] = true
+		}
+	}
+	head, err := m.Head()
+	if err != nil {
+		return nil, err
+	}
+	if head != nil {
+		keep[head.Version] = true
+	}
+
+	// Checkpoints are newest first, so the first one seen in a bucket is kept
+	hours := make(map[int64]bool)
+	days := make(map[string]bool)
+	hourlySince := now.Add(-time.Duration(p.KeepHourly) * time.Hour)
+	dailySince := now.AddDate(0, 0, -p.KeepDaily)
+	for i, cp := range checkpoints {
+		if i < p.KeepLast {
+			keep[cp.Version] = true
+		}
+		if p.KeepHourly > 0 && cp.CreatedAt.After(hourlySince) {
+			hour := cp.CreatedAt.Unix() / 3600
+			if !hours[hour] {
+				hours[hour] = true
+				keep[cp.Version] = true
+			}
+		}
+		if p.KeepDaily > 0 && cp.CreatedAt.After(dailySince) {
+			day := cp.CreatedAt.Format("2006-01-02")
+			if !days[day] {
+				days[day] = true
+				keep[cp.Version] = true
+			}
+		}
+	}
+	return keep, nil
+}
+
+// diskUsage returns the disk space allocated to a file or directory tree
+func diskUsage(path string) int64 {
+	var total int64
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil {
+			total += allocatedBytes(info)
+		}
+		return nil
+	})
+	return total
+}
@@ -0,0 +1,479 @@
+package checkpoint
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sleexyz/agentfs/internal/context"
+	"github.com/sleexyz/agentfs/internal/db"
+	"github.com/sleexyz/agentfs/internal/diff"
+)
+
+// Metadata keys recording where a checkpoint came from, used to find the
+// common ancestor of two stores. A fork's first checkpoint records the store
+// and version it was forked from; a merge records the version merged (and
+// its store, if it was another one) and any conflicting paths.
+const (
+	MetaForkedFromStore   = "forked_from_store"
+	MetaForkedFromVersion = "forked_from_version"
+	MetaMergedFromStore   = "merged_from_store"
+	MetaMergedFromVersion = "merged_from_version"
+	MetaMergeConflicts    = "merge_conflicts"
+)
+
+// Kinds of merge conflict
+const (
+	ConflictText    = "text"    // Conflict markers were written into the file
+	ConflictBinary  = "binary"  // The working copy's version was kept
+	ConflictDeleted = "deleted" // Deleted on one side, changed on the other; the changed version was kept
+)
+
+// MergeConflict is a file both sides changed in ways that couldn't be combined
+type MergeConflict struct {
+	Path string
+	Kind string
+}
+
+// MergeResult describes what Merge did
+type MergeResult struct {
+	BaseStore   string // Store holding the common ancestor
+	BaseVersion int
+	UpToDate    bool     // The merged checkpoint was already part of the history; nothing was done
+	Applied     []string // Files taken from the merged checkpoint (changed or deleted only there)
+	Merged      []string // Text files changed on both sides, combined without conflicts
+	Conflicts   []MergeConflict
+	PreMerge    *db.Checkpoint // Unsaved changes from before, or nil if there were none
+	Checkpoint  *db.Checkpoint // The merge checkpoint
+}
+
+// ErrNoMergeBase is returned when two checkpoints have no common ancestor
+var ErrNoMergeBase = errors.New("no common ancestor")
+
+// Merge merges checkpoint version of src into the working copy, file by file
+// against their common ancestor. src is m itself for a checkpoint of this
+// store, or the manager of another store related by fork or earlier merges.
+// Files changed only in version are applied, text files changed on both
+// sides are merged with diff3 (conflicts get markers), and other conflicts
+// keep the working copy's version. Unsaved changes are checkpointed first,
+// and the result is recorded as a merge checkpoint whose second parent is
+// version (or, for another store, whose metadata names it).
+func (m *Manager) Merge(src *Manager, version int) (*MergeResult, error) {
+	cp, err := src.database.GetCheckpoint(version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get checkpoint: %w", err)
+	}
+	if cp == nil {
+		return nil, fmt.Errorf("checkpoint v%d not found", version)
+	}
+	if !m.store.IsMounted(m.s) {
+		return nil, fmt.Errorf("store must be mounted to merge")
+	}
+
+	result := &MergeResult{}
+	changed, err := m.HasChanges()
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		if result.PreMerge, _, err = m.Create(CreateOpts{Message: "pre-merge"}); err != nil {
+			return nil, fmt.Errorf("failed to create pre-merge checkpoint: %w", err)
+		}
+	}
+	head, err := m.Head()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get branch head: %w", err)
+	}
+	if head == nil {
+		return nil, fmt.Errorf("store has no checkpoint to merge into")
+	}
+
+	base, baseVersion, err := m.mergeBase(src, head.Version, version)
+	if err != nil {
+		return nil, err
+	}
+	result.BaseStore = base.s.StorePath
+	result.BaseVersion = baseVersion
+	if base == src && baseVersion == version {
+		result.UpToDate = true
+		return result, nil
+	}
+
+	// Read both from temporary mounts, never the snapshots themselves
+	baseRoot, cleanup, err := diff.NewDiffer(base.store, base.s).MountCheckpoint(baseVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mount base v%d: %w", baseVersion, err)
+	}
+	if cleanup != nil {
+		defer cleanup()
+	}
+	theirRoot, cleanup, err := diff.NewDiffer(src.store, src.s).MountCheckpoint(version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mount v%d: %w", version, err)
+	}
+	if cleanup != nil {
+		defer cleanup()
+	}
+
+	labels := [3]string{"current", fmt.Sprintf("base (v%d)", baseVersion), fmt.Sprintf("v%d", version)}
+	message := fmt.Sprintf("merge v%d", version)
+	if src != m {
+		labels[2] = fmt.Sprintf("%s v%d", src.s.Name, version)
+		message = "merge " + labels[2]
+		if base != m {
+			labels[1] = fmt.Sprintf("base (%s v%d)", base.s.Name, baseVersion)
+		}
+	}
+
+	if err := m.mergeTrees(baseRoot, m.s.MountPath, theirRoot, labels, result); err != nil {
+		return result, err
+	}
+
+	meta := map[string]string{MetaMergedFromVersion: fmt.Sprintf("v%d", version)}
+	opts := CreateOpts{Message: message, Meta: meta}
+	if src == m {
+		opts.MergeParent = &version
+	} else {
+		meta[MetaMergedFromStore] = src.s.StorePath
+	}
+	if len(result.Conflicts) > 0 {
+		var paths []string
+		for _, c := range result.Conflicts {
+			paths = append(paths, c.Path)
+		}
+		meta[MetaMergeConflicts] = strings.Join(paths, " ")
+	}
+	if result.Checkpoint, _, err = m.Create(opts); err != nil {
+		return result, fmt.Errorf("failed to create merge checkpoint: %w", err)
+	}
+	return result, nil
+}
+
+// mergeTrees merges the changes from base to theirs into ours, in place
+func (m *Manager) mergeTrees(base, ours, theirs string, labels [3]string, result *MergeResult) error {
+	paths := make(map[string]bool)
+	for _, root := range []string{base, ours, theirs} {
+		if err := listMergeFiles(root, paths); err != nil {
+			return err
+		}
+	}
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+	return mergePaths(base, ours, theirs, sorted, labels, result)
+}
+
+// mergePaths merges the changes from base to theirs into ours for the given
+// paths, relative to each root
+func mergePaths(base, ours, theirs string, paths []string, labels [3]string, result *MergeResult) error {
+	for _, path := range paths {
+		b, o, t := filepath.Join(base, path), filepath.Join(ours, path), filepath.Join(theirs, path)
+		if sameFile(o, t) || sameFile(b, t) {
+			continue // Nothing to take from theirs
+		}
+		if err := checkParents(ours, path); err != nil {
+			return fmt.Errorf("failed to apply %s: %w", path, err)
+		}
+		if sameFile(b, o) {
+			if err := takeFile(t, o); err != nil {
+				return fmt.Errorf("failed to apply %s: %w", path, err)
+			}
+			result.Applied = append(result.Applied, path)
+			continue
+		}
+
+		// Changed on both sides
+		kind, err := mergeFile(b, o, t, labels)
+		if err != nil {
+			return fmt.Errorf("failed to merge %s: %w", path, err)
+		}
+		if kind == "" {
+			result.Merged = append(result.Merged, path)
+		} else {
+			result.Conflicts = append(result.Conflicts, MergeConflict{Path: path, Kind: kind})
+		}
+	}
+	return nil
+}
+
+// mergeFile combines ours and theirs, both changed since base, into ours. It
+// returns the kind of conflict, or "" if the changes merged cleanly.
+func mergeFile(base, ours, theirs string, labels [3]string) (string, error) {
+	oursInfo, oursErr := os.Lstat(ours)
+	theirsInfo, theirsErr := os.Lstat(theirs)
+	if oursErr != nil || theirsErr != nil {
+		// Deleted on one side: keep the changes from the other
+		if oursErr != nil {
+			if err := takeFile(theirs, ours); err != nil {
+				return "", err
+			}
+		}
+		return ConflictDeleted, nil
+	}
+
+	if !oursInfo.Mode().IsRegular() || !theirsInfo.Mode().IsRegular() || isBinary(ours) || isBinary(theirs) || isBinary(base) {
+		return ConflictBinary, nil
+	}
+
+	if _, err := os.Lstat(base); err != nil {
+		base = os.DevNull // Added on both sides
+	}
+	// -E brackets only real conflicts; the default (-A) also brackets
+	// identical changes made on both sides
+	cmd := exec.Command("diff3", "-m", "-E", "-L", labels[0], "-L", labels[1], "-L", labels[2], ours, base, theirs)
+	merged, err := cmd.Output()
+	var exitErr *exec.ExitError
+	conflict := errors.As(err, &exitErr) && exitErr.ExitCode() == 1
+	if err != nil && !conflict {
+		return "", fmt.Errorf("diff3 failed: %w", err)
+	}
+	if current, err := os.ReadFile(ours); err == nil && bytes.Equal(current, merged) {
+		return "", nil // Theirs was already in ours
+	}
+	if err := os.WriteFile(ours, merged, oursInfo.Mode().Perm()); err != nil {
+		return "", err
+	}
+	if conflict {
+		return ConflictText, nil
+	}
+	return "", nil
+}
+
+// takeFile makes dst a copy of src, or removes dst if src doesn't exist
+func takeFile(src, dst string) error {
+	if _, err := os.Lstat(src); os.IsNotExist(err) {
+		if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return restoreFile(src, dst)
+}
+
+// listMergeFiles adds the files and symlinks under root to paths, skipping
+// the context file (which names a specific store) and system files
+func listMergeFiles(root string, paths map[string]bool) error {
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path != root && entry != nil && entry.IsDir() {
+				return filepath.SkipDir // e.g. lost+found
+			}
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if diff.ShouldIgnore(rel) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.IsDir() && rel != context.ContextFileName {
+			paths[rel] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", root, err)
+	}
+	return nil
+}
+
+// sameFile reports whether a and b are both missing, or the same kind of
+// file with the same mode and contents (or symlink target)
+func sameFile(a, b string) bool {
+	ai, aErr := os.Lstat(a)
+	bi, bErr := os.Lstat(b)
+	if aErr != nil || bErr != nil {
+		return aErr != nil && bErr != nil
+	}
+	if ai.Mode() != bi.Mode() {
+		return false
+	}
+	if ai.Mode()&fs.ModeSymlink != 0 {
+		at, _ := os.Readlink(a)
+		bt, _ := os.Readlink(b)
+		return at == bt
+	}
+	if ai.Size() != bi.Size() {
+		return false
+	}
+	// Clones keep their mtime, so equal sizes and mtimes are taken as equal
+	if ai.ModTime().Equal(bi.ModTime()) {
+		return true
+	}
+	return sameContents(a, b)
+}
+
+// sameContents compares two files byte by byte
+func sameContents(a, b string) bool {
+	fa, err := os.Open(a)
+	if err != nil {
+		return false
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false
+	}
+	defer fb.Close()
+
+	bufA := make([]byte, 64*1024)
+	bufB := make([]byte, 64*1024)
+	for {
+		na, errA := io.ReadFull(fa, bufA)
+		nb, errB := io.ReadFull(fb, bufB)
+		if na != nb || !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false
+		}
+		if errA != nil || errB != nil {
+			return errA == errB || (errA == io.ErrUnexpectedEOF && errB == io.ErrUnexpectedEOF)
+		}
+	}
+}
+
+// isBinary reports whether a file has a NUL byte in its first 8KB
+func isBinary(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	buf := make([]byte, 8192)
+	n, _ := f.Read(buf)
+	return bytes.IndexByte(buf[:n], 0) >= 0
+}
+
+// mergeBase returns the newest common ancestor of head (in this store) and
+// version (in src), and the manager of the store it is in. Within a store it
+// is found through parents and merge parents. Across stores it is the
+// checkpoint of src most recently merged here, or else the fork point: one
+// store forked from the other, or both from the same checkpoint.
+func (m *Manager) mergeBase(src *Manager, head, version int) (*Manager, int, error) {
+	ours, err := m.ancestors(head)
+	if err != nil {
+		return nil, 0, err
+	}
+	theirs, err := src.ancestors(version)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if src == m {
+		base := 0
+		for v := range theirs {
+			if ours[v] && v > base {
+				base = v
+			}
+		}
+		if base == 0 {
+			return nil, 0, fmt.Errorf("%w of v%d and v%d", ErrNoMergeBase, head, version)
+		}
+		return m, base, nil
+	}
+
+	ourMeta, err := m.database.ListMeta()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	theirMeta, err := src.database.ListMeta()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read metadata of %s: %w", src.s.Name, err)
+	}
+
+	// The last merge from src
+	last := 0
+	base := 0
+	for v, meta := range ourMeta {
+		if !ours[v] || v < last || meta[MetaMergedFromStore] != src.s.StorePath {
+			continue
+		}
+		if merged := parseVersion(meta[MetaMergedFromVersion]); theirs[merged] {
+			last, base = v, merged
+		}
+	}
+	if base > 0 {
+		return src, base, nil
+	}
+
+	// src forked from this store
+	for v, meta := range theirMeta {
+		if theirs[v] && meta[MetaForkedFromStore] == m.s.StorePath {
+			if forked := parseVersion(meta[MetaForkedFromVersion]); ours[forked] {
+				return m, forked, nil
+			}
+		}
+	}
+	for v, meta := range ourMeta {
+		if !ours[v] || meta[MetaForkedFromStore] == "" {
+			continue
+		}
+		// This store forked from src
+		if meta[MetaForkedFromStore] == src.s.StorePath {
+			if forked := parseVersion(meta[MetaForkedFromVersion]); theirs[forked] {
+				return src, forked, nil
+			}
+		}
+		// Both forked from the same checkpoint, which v is a copy of
+		for tv, tmeta := range theirMeta {
+			if theirs[tv] && tmeta[MetaForkedFromStore] == meta[MetaForkedFromStore] && tmeta[MetaForkedFromVersion] == meta[MetaForkedFromVersion] {
+				return m, v, nil
+			}
+		}
+	}
+
+	return nil, 0, fmt.Errorf("%w of %s and %s v%d (neither was forked from the other)", ErrNoMergeBase, m.s.Name, src.s.Name, version)
+}
+
+// ancestors returns version and every checkpoint it descends from, through
+// parents and merge parents
+func (m *Manager) ancestors(version int) (map[int]bool, error) {
+	checkpoints, err := m.database.ListCheckpoints(0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list checkpoints: %w", err)
+	}
+	byVersion := make(map[int]*db.Checkpoint, len(checkpoints))
+	for _, cp := range checkpoints {
+		byVersion[cp.Version] = cp
+	}
+
+	seen := make(map[int]bool)
+	queue := []int{version}
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		cp := byVersion[v]
+		if seen[v] || cp == nil {
+			continue
+		}
+		seen[v] = true
+		for _, p := range []*int{cp.ParentVersion, cp.MergeParent} {
+			if p != nil {
+				queue = append(queue, *p)
+			}
+		}
+	}
+	return seen, nil
+}
+
+// parseVersion parses "v12" as 12, returning 0 if it isn't a version
+func parseVersion(s string) int {
+	v, err := strconv.Atoi(strings.TrimPrefix(s, "v"))
+	if err != nil {
+		return 0
+	}
+	return v
+}
@@ -0,0 +1,32 @@
+package checkpoint
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var metaKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+// ValidateMetaKey checks that a metadata key can be given as key=value
+func ValidateMetaKey(key string) error {
+	if !metaKeyPattern.MatchString(key) {
+		return fmt.Errorf("metadata key %q must contain only letters, digits, '_', '.' and '-'", key)
+	}
+	return nil
+}
+
+// GetMeta returns a checkpoint's key/value metadata
+func (m *Manager) GetMeta(version int) (map[string]string, error) {
+	return m.database.GetMeta(version)
+}
+
+// ListMeta returns the metadata of every checkpoint that has any, by version
+func (m *Manager) ListMeta() (map[int]map[string]string, error) {
+	return m.database.ListMeta()
+}
+
+// FindByMeta returns the versions of the checkpoints whose metadata matches
+// every filter, where filter values may be glob patterns ("f55a4d56*")
+func (m *Manager) FindByMeta(filters map[string]string) (map[int]bool, error) {
+	return m.database.FindByMeta(filters)
+}
@@ -0,0 +1,112 @@
+package checkpoint
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sleexyz/agentfs/internal/db"
+	"github.com/sleexyz/agentfs/internal/store"
+)
+
+// DefaultMountPath returns where a checkpoint is mounted by default: next to
+// the working copy, as foo@v3
+func (m *Manager) DefaultMountPath(version int) string {
+	return fmt.Sprintf("%s@v%d", m.s.MountPath, version)
+}
+
+// Mount attaches a checkpoint read-only at path (DefaultMountPath if empty)
+// and records it, so it can be unmounted later. The view is a clone: the
+// checkpoint and the working copy are never touched.
+func (m *Manager) Mount(version int, path string) (*db.Mount, error) {
+	cp, err := m.database.GetCheckpoint(version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get checkpoint: %w", err)
+	}
+	if cp == nil {
+		return nil, fmt.Errorf("checkpoint v%d not found", version)
+	}
+
+	if path == "" {
+		path = m.DefaultMountPath(version)
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve mount path: %w", err)
+	}
+	for _, dir := range []string{m.s.MountPath, m.s.StorePath} {
+		if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("can't mount inside %s", dir)
+		}
+	}
+
+	existing, err := m.database.GetMount(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mount: %w", err)
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("v%d is already mounted at %s", existing.Version, path)
+	}
+	if entries, err := os.ReadDir(path); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("%s already exists and is not empty", path)
+	}
+
+	workRoot := filepath.Join(m.s.StorePath, "mounts")
+	if err := os.MkdirAll(workRoot, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create mounts directory: %w", err)
+	}
+	workDir, err := os.MkdirTemp(workRoot, fmt.Sprintf("v%d-", version))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create work directory: %w", err)
+	}
+
+	snapshotPath := filepath.Join(m.store.GetCheckpointsPath(m.s), fmt.Sprintf("v%d", version))
+	if err := m.s.Backend.AttachSnapshot(m.s, snapshotPath, workDir, path); err != nil {
+		os.RemoveAll(workDir)
+		return nil, fmt.Errorf("failed to mount v%d: %w", version, err)
+	}
+	if p, ok := m.s.Backend.(store.ViewProtector); ok {
+		if err := p.ProtectView(path); err != nil {
+			m.s.Backend.DetachSnapshot(m.s, workDir, path)
+			os.RemoveAll(workDir)
+			return nil, fmt.Errorf("failed to make the mount read-only: %w", err)
+		}
+	}
+
+	mount := &db.Mount{
+		Path:      path,
+		Version:   version,
+		WorkDir:   workDir,
+		CreatedAt: time.Now(),
+	}
+	if err := m.database.AddMount(mount); err != nil {
+		m.s.Backend.DetachSnapshot(m.s, workDir, path)
+		os.RemoveAll(workDir)
+		return nil, fmt.Errorf("failed to record mount: %w", err)
+	}
+	return mount, nil
+}
+
+// ListMounts returns the store's checkpoint mounts, oldest first
+func (m *Manager) ListMounts() ([]*db.Mount, error) {
+	mounts, err := m.database.ListMounts()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mounts: %w", err)
+	}
+	return mounts, nil
+}
+
+// Unmount detaches a checkpoint mount and forgets it. A mount that is
+// already gone (after a reboot, say) is just forgotten.
+func (m *Manager) Unmount(mount *db.Mount) error {
+	if err := m.s.Backend.DetachSnapshot(m.s, mount.WorkDir, mount.Path); err != nil {
+		return fmt.Errorf("failed to unmount %s: %w", mount.Path, err)
+	}
+	os.RemoveAll(mount.WorkDir)
+	if err := m.database.DeleteMount(mount.Path); err != nil {
+		return fmt.Errorf("failed to forget mount: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package checkpoint
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sleexyz/agentfs/internal/clone"
+	"github.com/sleexyz/agentfs/internal/context"
+	"github.com/sleexyz/agentfs/internal/db"
+	"github.com/sleexyz/agentfs/internal/diff"
+)
+
+// PartialRestoreResult describes what RestorePaths did
+type PartialRestoreResult struct {
+	Restored   []string       // Files copied back, relative to the store root
+	PreRestore *db.Checkpoint // Unsaved changes from before, or nil if there were none
+	Checkpoint *db.Checkpoint // The state after, or nil if nothing changed
+}
+
+// RestorePaths copies the files matching patterns from a checkpoint back into
+// the working copy, leaving everything else as it is. Patterns are paths
+// relative to the store root, optionally with glob characters (* doesn't
+// match /); one matching a directory selects every file under it. Unsaved
+// changes are checkpointed first, and the result is recorded as a new
+// checkpoint.
+func (m *Manager) RestorePaths(version int, patterns []string) (*PartialRestoreResult, error) {
+	cp, err := m.database.GetCheckpoint(version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get checkpoint: %w", err)
+	}
+	if cp == nil {
+		return nil, fmt.Errorf("checkpoint v%d not found", version)
+	}
+	if !m.store.IsMounted(m.s) {
+		return nil, fmt.Errorf("store must be mounted to restore files")
+	}
+	for _, p := range patterns {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+	}
+
+	// Read the checkpoint from a temporary mount, never the snapshot itself
+	root, cleanup, err := diff.NewDiffer(m.store, m.s).MountCheckpoint(version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mount v%d: %w", version, err)
+	}
+	if cleanup != nil {
+		defer cleanup()
+	}
+
+	files, err := matchFiles(root, patterns)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range patterns {
+		if len(files[p]) == 0 {
+			return nil, fmt.Errorf("%s matches no file in v%d", p, version)
+		}
+	}
+	selected := make(map[string]bool)
+	for _, paths := range files {
+		for _, path := range paths {
+			selected[path] = true
+		}
+	}
+
+	result := &PartialRestoreResult{}
+	changed, err := m.HasChanges()
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		if result.PreRestore, _, err = m.Create(CreateOpts{Message: "pre-restore"}); err != nil {
+			return nil, fmt.Errorf("failed to create pre-restore checkpoint: %w", err)
+		}
+	}
+
+	for path := range selected {
+		result.Restored = append(result.Restored, path)
+	}
+	sort.Strings(result.Restored)
+	for _, path := range result.Restored {
+		if err := checkParents(m.s.MountPath, path); err != nil {
+			return result, fmt.Errorf("failed to restore %s: %w", path, err)
+		}
+		if err := restoreFile(filepath.Join(root, path), filepath.Join(m.s.MountPath, path)); err != nil {
+			return result, fmt.Errorf("failed to restore %s: %w", path, err)
+		}
+	}
+
+	if changed, err = m.HasChanges(); err != nil || !changed {
+		return result, err
+	}
+	result.Checkpoint, _, err = m.Create(CreateOpts{
+		Message: fmt.Sprintf("restore v%d -- %s", version, strings.Join(patterns, " ")),
+		Meta: map[string]string{
+			"restored_from":  fmt.Sprintf("v%d", version),
+			"restored_paths": strings.Join(patterns, " "),
+		},
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed to record partial restore: %w", err)
+	}
+	return result, nil
+}
+
+// matchFiles returns the files and symlinks under root that each pattern
+// selects, by pattern, skipping the context file and system files
+func matchFiles(root string, patterns []string) (map[string][]string, error) {
+	matches := make(map[string][]string)
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path != root && entry != nil && entry.IsDir() {
+				return filepath.SkipDir // e.g. lost+found
+			}
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if diff.ShouldIgnore(rel) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() || rel == context.ContextFileName {
+			return nil
+		}
+		for _, p := range patterns {
+			if matchPath(p, rel) {
+				matches[p] = append(matches[p], rel)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint files: %w", err)
+	}
+	return matches, nil
+}
+
+// matchPath reports whether pattern matches path or one of its parent
+// directories
+func matchPath(pattern, path string) bool {
+	pattern = filepath.Clean(pattern)
+	if pattern == "." {
+		return true
+	}
+	for p := path; p != "." && p != string(filepath.Separator); p = filepath.Dir(p) {
+		if ok, _ := filepath.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// restoreFile replaces dst with the file or symlink at src, keeping its mode
+// and modification time so it compares equal to the checkpoint's copy. dst
+// itself is replaced, never written through; callers check its parent
+// directories with checkParents, so a symlink in the working copy can't
+// redirect the write outside the store.
+func restoreFile(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if existing, err := os.Lstat(dst); err == nil && existing.IsDir() {
+		return fmt.Errorf("%s is a directory in the working copy", dst)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	if info.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		os.Remove(dst)
+		return os.Symlink(target, dst)
+	}
+
+	// Clone next to dst and rename over it
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".agentfs-restore-*")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if _, err := clone.File(src, tmp.Name()); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := os.Chtimes(tmp.Name(), time.Now(), info.ModTime()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// checkParents returns an error if a directory on the way from root to path
+// (relative to root) exists as anything but a real directory, such as a
+// symlink out of the store. Missing directories are fine: they are created.
+func checkParents(root, path string) error {
+	dir := root
+	for _, part := range strings.Split(filepath.Dir(path), string(filepath.Separator)) {
+		if part == "." {
+			break
+		}
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory in the working copy", dir)
+		}
+	}
+	return nil
+}
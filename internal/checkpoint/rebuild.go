@@ -0,0 +1,117 @@
+package checkpoint
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sleexyz/agentfs/internal/db"
+	"github.com/sleexyz/agentfs/internal/store"
+)
+
+// recoveredMessage labels checkpoints imported without a sidecar
+const recoveredMessage = "recovered"
+
+// RebuildResult describes the checkpoints imported by RebuildDB
+type RebuildResult struct {
+	Imported       int   // Checkpoints recorded
+	WithoutSidecar []int // Versions with no (readable) sidecar, dated by directory mtime
+}
+
+// RebuildDB records every snapshot in checkpoints/ in the database, taking
+// each checkpoint's metadata from its sidecar, and points each branch at its
+// newest checkpoint. The database should be empty (a fresh metadata.db);
+// versions already recorded are skipped.
+func (m *Manager) RebuildDB() (*RebuildResult, error) {
+	versions, err := m.s.Backend.ListSnapshots(m.s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	result := &RebuildResult{}
+	for _, v := range versions {
+		if cp, err := m.database.GetCheckpoint(v); err == nil && cp != nil {
+			continue
+		}
+		fromSidecar, err := m.importSnapshot(v)
+		if err != nil {
+			return result, fmt.Errorf("failed to import v%d: %w", v, err)
+		}
+		result.Imported++
+		if !fromSidecar {
+			result.WithoutSidecar = append(result.WithoutSidecar, v)
+		}
+	}
+
+	if err := m.database.RecomputeBranches(); err != nil {
+		return result, fmt.Errorf("failed to restore branches: %w", err)
+	}
+	if err := m.updateLatest(); err != nil {
+		return result, fmt.Errorf("failed to update latest symlink: %w", err)
+	}
+	return result, nil
+}
+
+// importSnapshot records a checkpoint for the snapshot of version, using its
+// sidecar (metadata and tags) if it has a readable one and reporting whether
+// it did. Without one, the checkpoint is dated by the snapshot directory's
+// mtime and a sidecar is written for it.
+func (m *Manager) importSnapshot(version int) (bool, error) {
+	sc, err := m.readSidecar(version)
+	fromSidecar := err == nil && sc != nil
+
+	var cp *db.Checkpoint
+	if fromSidecar {
+		cp = sc.checkpoint()
+	} else {
+		info, err := os.Stat(m.versionPath(version))
+		if err != nil {
+			return false, err
+		}
+		cp = &db.Checkpoint{
+			Version:   version,
+			Message:   recoveredMessage,
+			CreatedAt: info.ModTime(),
+		}
+	}
+	if cp.Branch == "" {
+		// Recorded before branches existed
+		cp.Branch = db.DefaultBranch
+	}
+
+	if err := m.database.CreateCheckpoint(cp); err != nil {
+		return false, err
+	}
+	if fromSidecar {
+		for _, tag := range sc.Tags {
+			// A tag moved to a later checkpoint may still be in this sidecar
+			if err := m.database.SetTag(tag, version, true); err != nil {
+				return false, err
+			}
+		}
+		if err := m.database.AddSquashed(version, sc.squashed()); err != nil {
+			return false, err
+		}
+		if len(sc.Meta) > 0 {
+			if err := m.database.SetMeta(version, sc.Meta); err != nil {
+				return false, err
+			}
+		}
+		// Snapshots are imported oldest first, so a call's before checkpoint
+		// is already recorded unless it was deleted
+		for _, tc := range sc.toolCalls() {
+			if err := m.database.AddToolCall(tc); err != nil {
+				return false, err
+			}
+		}
+	} else if err := m.writeSidecar(cp); err != nil {
+		return false, err
+	}
+
+	// Manifest-based snapshots can be re-indexed from disk
+	if mb, ok := m.s.Backend.(store.ManifestBackend); ok {
+		if err := m.indexManifest(cp, m.versionPath(version), mb); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to index file versions of v%d: %v\n", version, err)
+		}
+	}
+	return fromSidecar, nil
+}
@@ -0,0 +1,125 @@
+package checkpoint
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sleexyz/agentfs/internal/db"
+)
+
+// Journal steps (see db.Operation)
+const (
+	// OpCheckpoint: version reserved in the database, clone may be partial
+	stepReserved = "reserved"
+	// OpCheckpoint: clone complete, bookkeeping may be missing
+	stepCloned = "cloned"
+	// OpRestore: data may be partially restored; remount afterwards
+	stepRestoring = "restoring"
+	// OpRestore: as stepRestoring, but the store was not mounted
+	stepRestoringUnmounted = "restoring-unmounted"
+	// OpRestore: data restored, remount pending
+	stepRestored = "restored"
+	// OpDeleteCheckpoint: files and record may be partially removed
+	stepDeleting = "deleting"
+	// OpSquash: records squashed, sidecars may be stale
+	stepSquashed = "squashed"
+)
+
+// Recover completes or rolls back operations left in the journal by a process
+// that died midway, and returns a description of each. Checkpoints are rolled
+// back unless their clone finished; restores, deletes and squashes are rolled
+// forward. The caller must hold the store lock, so no journaled operation is
+// live.
+func (m *Manager) Recover() ([]string, error) {
+	ops, err := m.database.ListOperations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+
+	var recovered []string
+	for _, op := range ops {
+		msg, err := m.recoverOperation(op)
+		if err != nil {
+			return recovered, fmt.Errorf("failed to recover interrupted %s of v%d: %w", op.Kind, op.Version, err)
+		}
+		if err := m.database.EndOperation(op.ID); err != nil {
+			return recovered, err
+		}
+		recovered = append(recovered, msg)
+	}
+	return recovered, nil
+}
+
+// recoverOperation brings one interrupted operation to a consistent end
+func (m *Manager) recoverOperation(op *db.Operation) (string, error) {
+	versionPath := m.versionPath(op.Version)
+
+	switch op.Kind {
+	case db.OpCheckpoint:
+		if op.Step == stepCloned {
+			// The snapshot is complete; only the sidecar and latest symlink may be missing
+			if cp, err := m.database.GetCheckpoint(op.Version); err == nil && cp != nil {
+				m.writeSidecar(cp)
+			}
+			m.updateLatest()
+			return fmt.Sprintf("completed interrupted checkpoint v%d", op.Version), nil
+		}
+		if err := m.removeSnapshot(op.Version); err != nil {
+			return "", err
+		}
+		if err := m.database.UnreserveCheckpoint(op.ID, op.Version); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("rolled back interrupted checkpoint v%d", op.Version), nil
+
+	case db.OpRestore:
+		if _, err := os.Stat(versionPath); os.IsNotExist(err) {
+			// Nothing to roll forward to: just make the store consistent again
+			if err := m.s.Backend.RecoverRestore(m.s); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("abandoned interrupted restore to v%d (checkpoint missing)", op.Version), nil
+		}
+		if op.Step != stepRestored {
+			if m.store.IsMounted(m.s) {
+				if err := m.store.Unmount(m.s); err != nil {
+					return "", err
+				}
+			}
+			if err := m.s.Backend.RecoverRestore(m.s); err != nil {
+				return "", err
+			}
+			if err := m.s.Backend.RestoreSnapshot(m.s, versionPath); err != nil {
+				return "", err
+			}
+		}
+		if op.Step != stepRestoringUnmounted && !m.store.IsMounted(m.s) {
+			if err := m.store.Mount(m.s); err != nil {
+				return "", err
+			}
+		}
+		return fmt.Sprintf("completed interrupted restore to v%d", op.Version), nil
+
+	case db.OpDeleteCheckpoint:
+		if err := m.removeSnapshot(op.Version); err != nil {
+			return "", err
+		}
+		m.database.DeleteCheckpoint(op.Version) // May already be gone
+		m.updateLatest()
+		return fmt.Sprintf("completed interrupted delete of v%d", op.Version), nil
+
+	case db.OpSquash:
+		// The folded checkpoints' deletes are journaled separately
+		children, err := m.database.ListChildren(op.Version)
+		if err != nil {
+			return "", err
+		}
+		m.syncSidecar(op.Version)
+		for _, child := range children {
+			m.syncSidecar(child)
+		}
+		return fmt.Sprintf("completed interrupted squash into v%d", op.Version), nil
+	}
+
+	return fmt.Sprintf("discarded unknown operation %q on v%d", op.Kind, op.Version), nil
+}
@@ -0,0 +1,109 @@
+package checkpoint
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sleexyz/agentfs/internal/db"
+)
+
+// sessionKey is the metadata key --from-hook records the agent session under
+const sessionKey = "session_id"
+
+// ErrSessionNotFound is returned when no checkpoint belongs to a session
+var ErrSessionNotFound = errors.New("no checkpoints from session")
+
+// Session is the checkpoints one agent session created, identified by their
+// session_id metadata
+type Session struct {
+	ID          string
+	Checkpoints []*db.Checkpoint // Oldest first
+}
+
+// First returns the session's first checkpoint
+func (s *Session) First() *db.Checkpoint {
+	return s.Checkpoints[0]
+}
+
+// Last returns the session's last checkpoint
+func (s *Session) Last() *db.Checkpoint {
+	return s.Checkpoints[len(s.Checkpoints)-1]
+}
+
+// Duration returns the time between the session's first and last checkpoints
+func (s *Session) Duration() time.Duration {
+	return s.Last().CreatedAt.Sub(s.First().CreatedAt)
+}
+
+// Base returns the version the session started from: the parent of its first
+// checkpoint, or nil if that was the store's first checkpoint
+func (s *Session) Base() *int {
+	return s.First().ParentVersion
+}
+
+// ListSessions returns the sessions that created checkpoints, most recently
+// active first
+func (m *Manager) ListSessions() ([]*Session, error) {
+	meta, err := m.database.ListMeta()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	checkpoints, err := m.database.ListCheckpoints(0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list checkpoints: %w", err)
+	}
+
+	byID := make(map[string]*Session)
+	var sessions []*Session
+	for i := len(checkpoints) - 1; i >= 0; i-- {
+		cp := checkpoints[i]
+		id := meta[cp.Version][sessionKey]
+		if id == "" {
+			continue
+		}
+		s := byID[id]
+		if s == nil {
+			s = &Session{ID: id}
+			byID[id] = s
+			sessions = append(sessions, s)
+		}
+		s.Checkpoints = append(s.Checkpoints, cp)
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].Last().Version > sessions[j].Last().Version
+	})
+	return sessions, nil
+}
+
+// GetSession returns the session with the given ID or unique ID prefix
+func (m *Manager) GetSession(id string) (*Session, error) {
+	sessions, err := m.ListSessions()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*Session
+	for _, s := range sessions {
+		if s.ID == id {
+			return s, nil
+		}
+		if strings.HasPrefix(s.ID, id) {
+			matches = append(matches, s)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("%w %s", ErrSessionNotFound, id)
+	case 1:
+		return matches[0], nil
+	}
+	var ids []string
+	for _, s := range matches {
+		ids = append(ids, s.ID)
+	}
+	return nil, fmt.Errorf("session %s is ambiguous: %s", id, strings.Join(ids, ", "))
+}
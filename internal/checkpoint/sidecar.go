@@ -0,0 +1,182 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sleexyz/agentfs/internal/db"
+)
+
+// sidecar is the metadata kept next to each snapshot (checkpoints/vN.json),
+// so metadata.db can be rebuilt from the checkpoints directory alone. It
+// lives beside vN/ rather than in it because backends treat everything in
+// vN/ as snapshot data (sparse bundle bands are counted and cloned as a set).
+type sidecar struct {
+	Version       int               `json:"version"`
+	Message       string            `json:"message,omitempty"`
+	CreatedAt     time.Time         `json:"created_at"`
+	DurationMs    int64             `json:"duration_ms,omitempty"`
+	ParentVersion *int              `json:"parent_version,omitempty"`
+	MergeParent   *int              `json:"merge_parent,omitempty"`
+	Branch        string            `json:"branch,omitempty"`
+	Tags          []string          `json:"tags,omitempty"`
+	Squashed      []squashedEntry   `json:"squashed,omitempty"`
+	Meta          map[string]string `json:"meta,omitempty"`
+	ToolCalls     []toolCallEntry   `json:"tool_calls,omitempty"`
+}
+
+// squashedEntry is a checkpoint folded into this one by squash
+type squashedEntry struct {
+	Version   int       `json:"version"`
+	Message   string    `json:"message,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// toolCallEntry is a tool call that ended at this checkpoint
+type toolCallEntry struct {
+	ID        string    `json:"id"`
+	SessionID string    `json:"session_id,omitempty"`
+	ToolName  string    `json:"tool_name,omitempty"`
+	Input     string    `json:"input,omitempty"`
+	Before    int       `json:"before"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// sidecarPath returns the sidecar file for a checkpoint version
+func (m *Manager) sidecarPath(version int) string {
+	return filepath.Join(m.store.GetCheckpointsPath(m.s), fmt.Sprintf("v%d.json", version))
+}
+
+// removeSnapshot deletes a checkpoint's snapshot directory and its sidecar
+func (m *Manager) removeSnapshot(version int) error {
+	if err := os.RemoveAll(m.versionPath(version)); err != nil {
+		return err
+	}
+	if err := os.Remove(m.sidecarPath(version)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// writeSidecar records cp's metadata and tags next to its snapshot, replacing
+// the file atomically
+func (m *Manager) writeSidecar(cp *db.Checkpoint) error {
+	tags, err := m.database.GetTagsForVersion(cp.Version)
+	if err != nil {
+		return err
+	}
+	squashed, err := m.database.ListSquashed(cp.Version)
+	if err != nil {
+		return err
+	}
+	meta, err := m.database.GetMeta(cp.Version)
+	if err != nil {
+		return err
+	}
+	calls, err := m.database.ToolCallsEndingAt(cp.Version)
+	if err != nil {
+		return err
+	}
+	var entries []squashedEntry
+	for _, sq := range squashed {
+		entries = append(entries, squashedEntry{Version: sq.Version, Message: sq.Message, CreatedAt: sq.CreatedAt})
+	}
+	var callEntries []toolCallEntry
+	for _, tc := range calls {
+		callEntries = append(callEntries, toolCallEntry{
+			ID:        tc.ID,
+			SessionID: tc.SessionID,
+			ToolName:  tc.ToolName,
+			Input:     tc.Input,
+			Before:    tc.Before,
+			StartedAt: tc.StartedAt,
+		})
+	}
+	data, err := json.MarshalIndent(sidecar{
+		Version:       cp.Version,
+		Message:       cp.Message,
+		CreatedAt:     cp.CreatedAt,
+		DurationMs:    cp.DurationMs,
+		ParentVersion: cp.ParentVersion,
+		MergeParent:   cp.MergeParent,
+		Branch:        cp.Branch,
+		Tags:          tags,
+		Squashed:      entries,
+		Meta:          meta,
+		ToolCalls:     callEntries,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := m.sidecarPath(cp.Version)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readSidecar reads the metadata of a checkpoint version. It returns nil
+// without error if the version has no sidecar.
+func (m *Manager) readSidecar(version int) (*sidecar, error) {
+	data, err := os.ReadFile(m.sidecarPath(version))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sc sidecar
+	if err := json.Unmarshal(data, &sc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filepath.Base(m.sidecarPath(version)), err)
+	}
+	if sc.Version != version {
+		return nil, fmt.Errorf("%s is for v%d", filepath.Base(m.sidecarPath(version)), sc.Version)
+	}
+	return &sc, nil
+}
+
+// squashed returns the squashed checkpoints recorded in the sidecar
+func (sc *sidecar) squashed() []*db.Squashed {
+	var squashed []*db.Squashed
+	for _, e := range sc.Squashed {
+		squashed = append(squashed, &db.Squashed{Version: e.Version, Message: e.Message, CreatedAt: e.CreatedAt})
+	}
+	return squashed
+}
+
+// toolCalls returns the tool calls recorded in the sidecar
+func (sc *sidecar) toolCalls() []*db.ToolCall {
+	var calls []*db.ToolCall
+	for _, e := range sc.ToolCalls {
+		after := sc.Version
+		calls = append(calls, &db.ToolCall{
+			ID:        e.ID,
+			SessionID: e.SessionID,
+			ToolName:  e.ToolName,
+			Input:     e.Input,
+			Before:    e.Before,
+			After:     &after,
+			StartedAt: e.StartedAt,
+		})
+	}
+	return calls
+}
+
+// checkpoint returns the checkpoint record described by the sidecar
+func (sc *sidecar) checkpoint() *db.Checkpoint {
+	return &db.Checkpoint{
+		Version:       sc.Version,
+		Message:       sc.Message,
+		CreatedAt:     sc.CreatedAt,
+		DurationMs:    sc.DurationMs,
+		ParentVersion: sc.ParentVersion,
+		MergeParent:   sc.MergeParent,
+		Branch:        sc.Branch,
+	}
+}
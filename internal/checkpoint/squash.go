@@ -0,0 +1,126 @@
+package checkpoint
+
+import (
+	"fmt"
+
+	"github.com/sleexyz/agentfs/internal/db"
+)
+
+// SquashResult describes what Squash did
+type SquashResult struct {
+	Checkpoint *db.Checkpoint   // The surviving checkpoint, holding the final state
+	Deleted    []*db.Checkpoint // Checkpoints folded into it, newest first
+	Reparented []int            // Checkpoints that had forked from a deleted one
+}
+
+// Squash collapses the line of checkpoints from..to (from an ancestor of to)
+// into to, which keeps its snapshot, takes the message and from's parent,
+// and records the folded checkpoints' messages. The checkpoints before to are
+// deleted; checkpoints forked from them continue from to instead.
+func (m *Manager) Squash(from, to int, message string) (*SquashResult, error) {
+	if from == to {
+		return nil, fmt.Errorf("nothing to squash: v%d..v%d is a single checkpoint", from, to)
+	}
+
+	last, err := m.database.GetCheckpoint(to)
+	if err != nil {
+		return nil, err
+	}
+	if last == nil {
+		return nil, fmt.Errorf("checkpoint v%d not found", to)
+	}
+
+	// Walk back from to until reaching from
+	var folded []*db.Checkpoint
+	cp := last
+	for cp.Version != from {
+		if cp.ParentVersion == nil {
+			return nil, fmt.Errorf("v%d is not an ancestor of v%d", from, to)
+		}
+		parent, err := m.database.GetCheckpoint(*cp.ParentVersion)
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil {
+			return nil, fmt.Errorf("v%d is not an ancestor of v%d (v%d's parent v%d doesn't exist)", from, to, cp.Version, *cp.ParentVersion)
+		}
+		cp = parent
+		folded = append(folded, cp)
+	}
+	first := cp
+
+	// Names pointing into the range would silently move to a different state
+	versions := make([]int, len(folded))
+	isFolded := make(map[int]bool, len(folded))
+	for i, f := range folded {
+		versions[i] = f.Version
+		isFolded[f.Version] = true
+	}
+	tags, err := m.database.ListTags()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tags {
+		if isFolded[t.Version] {
+			return nil, fmt.Errorf("v%d is tagged %s; delete the tag or squash a range ending at it", t.Version, t.Name)
+		}
+	}
+	branches, err := m.database.ListBranches()
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range branches {
+		if b.HeadVersion != nil && isFolded[*b.HeadVersion] {
+			return nil, fmt.Errorf("v%d is the head of branch %s; squash a range ending at it", *b.HeadVersion, b.Name)
+		}
+	}
+
+	// Checkpoints forked from the range, whose sidecars need their new parent
+	var forks []int
+	isFork := make(map[int]bool)
+	for _, v := range versions {
+		children, err := m.database.ListChildren(v)
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			if child != to && !isFolded[child] && !isFork[child] {
+				isFork[child] = true
+				forks = append(forks, child)
+			}
+		}
+	}
+
+	// The rest is journaled with the squash, so a crash midway is finished
+	// by recovery
+	opID, deleteOps, err := m.database.Squash(to, versions, message, first.ParentVersion, stepSquashed, stepDeleting)
+	if err != nil {
+		return nil, fmt.Errorf("failed to squash: %w", err)
+	}
+	m.syncSidecar(to)
+	for _, v := range forks {
+		m.syncSidecar(v)
+	}
+	m.database.EndOperation(opID)
+
+	// Folded checkpoints no longer have children, so deleting them changes
+	// nothing else
+	result := &SquashResult{Reparented: forks}
+	for _, f := range folded {
+		if err := m.finishDelete(deleteOps[f.Version], f.Version); err != nil {
+			return nil, fmt.Errorf("failed to delete v%d: %w", f.Version, err)
+		}
+		result.Deleted = append(result.Deleted, f)
+	}
+
+	result.Checkpoint, err = m.database.GetCheckpoint(to)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ListSquashed returns the checkpoints folded into a checkpoint by squash
+func (m *Manager) ListSquashed(version int) ([]*db.Squashed, error) {
+	return m.database.ListSquashed(version)
+}
@@ -0,0 +1,24 @@
+//go:build linux
+
+package checkpoint
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// ctimeNs returns the inode change time in nanoseconds
+func ctimeNs(info fs.FileInfo) int64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return st.Ctim.Nano()
+	}
+	return info.ModTime().UnixNano()
+}
+
+// allocatedBytes returns the disk space allocated to a file
+func allocatedBytes(info fs.FileInfo) int64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return st.Blocks * 512
+	}
+	return info.Size()
+}
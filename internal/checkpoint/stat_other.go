@@ -0,0 +1,15 @@
+//go:build !darwin && !linux
+
+package checkpoint
+
+import "io/fs"
+
+// ctimeNs falls back to the modification time where ctime isn't available
+func ctimeNs(info fs.FileInfo) int64 {
+	return info.ModTime().UnixNano()
+}
+
+// allocatedBytes falls back to the file size where block counts aren't available
+func allocatedBytes(info fs.FileInfo) int64 {
+	return info.Size()
+}
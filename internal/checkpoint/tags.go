@@ -0,0 +1,93 @@
+package checkpoint
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/sleexyz/agentfs/internal/db"
+)
+
+var (
+	refNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+	versionPattern = regexp.MustCompile(`^v?[0-9]+$`)
+)
+
+// ValidateTagName checks that a tag name can't be mistaken for a version or
+// another kind of revision
+func ValidateTagName(name string) error {
+	return validateRefName("tag", name)
+}
+
+// validateRefName checks a tag or branch name, which revisions refer to
+func validateRefName(kind, name string) error {
+	switch {
+	case versionPattern.MatchString(name):
+		return fmt.Errorf("%s name %q looks like a version", kind, name)
+	case name == "latest":
+		return fmt.Errorf("%s name %q is reserved", kind, name)
+	case !refNamePattern.MatchString(name):
+		return fmt.Errorf("%s name %q must start with a letter or digit and contain only letters, digits, '.', '_', '/' and '-'", kind, name)
+	}
+	return nil
+}
+
+// Tag points the tag name at a checkpoint. An existing tag is moved if
+// replace is set, otherwise db.ErrTagExists is returned.
+func (m *Manager) Tag(name string, version int, replace bool) error {
+	if err := ValidateTagName(name); err != nil {
+		return err
+	}
+
+	old, err := m.database.GetTag(name)
+	if err != nil {
+		return err
+	}
+	if err := m.database.SetTag(name, version, replace); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("checkpoint v%d not found", version)
+		}
+		return err
+	}
+
+	// Sidecars of both the old and the new checkpoint list their tags
+	m.syncSidecar(version)
+	if old != nil && old.Version != version {
+		m.syncSidecar(old.Version)
+	}
+	return nil
+}
+
+// Untag deletes a tag and returns the version it pointed at
+func (m *Manager) Untag(name string) (int, error) {
+	tag, err := m.database.GetTag(name)
+	if err != nil {
+		return 0, err
+	}
+	if tag == nil {
+		return 0, fmt.Errorf("tag %q not found", name)
+	}
+	if err := m.database.DeleteTag(name); err != nil {
+		return 0, err
+	}
+	m.syncSidecar(tag.Version)
+	return tag.Version, nil
+}
+
+// ListTags returns all tags ordered by name
+func (m *Manager) ListTags() ([]*db.Tag, error) {
+	return m.database.ListTags()
+}
+
+// syncSidecar rewrites a checkpoint's sidecar from the database
+func (m *Manager) syncSidecar(version int) {
+	cp, err := m.database.GetCheckpoint(version)
+	if err == nil && cp != nil {
+		err = m.writeSidecar(cp)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to update metadata of v%d: %v\n", version, err)
+	}
+}
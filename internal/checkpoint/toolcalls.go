@@ -0,0 +1,122 @@
+package checkpoint
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/sleexyz/agentfs/internal/db"
+	"github.com/sleexyz/agentfs/internal/diff"
+)
+
+// Attribution is a tool call that changed files under a path
+type Attribution struct {
+	Call    *db.ToolCall
+	Changes []diff.Change
+}
+
+// BeginToolCall records a tool call that started at checkpoint tc.Before
+func (m *Manager) BeginToolCall(tc *db.ToolCall) error {
+	if err := m.database.BeginToolCall(tc); err != nil {
+		return fmt.Errorf("failed to record tool call: %w", err)
+	}
+	return nil
+}
+
+// FinishToolCall records the checkpoint a started tool call ended at,
+// reporting whether the call had been started
+func (m *Manager) FinishToolCall(id string, after int) (bool, error) {
+	ok, err := m.database.FinishToolCall(id, after)
+	if err != nil {
+		return false, fmt.Errorf("failed to record tool call: %w", err)
+	}
+	if ok {
+		m.syncSidecar(after)
+	}
+	return ok, nil
+}
+
+// ListToolCalls returns the recorded tool calls that changed something,
+// newest first
+func (m *Manager) ListToolCalls() ([]*db.ToolCall, error) {
+	return m.database.ListToolCalls()
+}
+
+// Why returns the tool calls that changed path (a file, or any file under a
+// directory; relative to the store root), newest first. Each call's changes
+// are found by comparing the manifests of its before and after checkpoints
+// the first time they are needed, and recorded so later queries don't read
+// the checkpoints again.
+func (m *Manager) Why(path string) ([]*Attribution, error) {
+	calls, err := m.database.ListToolCalls()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tool calls: %w", err)
+	}
+	recorded, err := m.database.ListToolCallChanges()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tool call changes: %w", err)
+	}
+
+	// Consecutive calls share checkpoints, so each manifest is read once
+	differ := diff.NewDiffer(m.store, m.s)
+	manifests := make(map[int]map[string]*diff.FileInfo)
+	manifest := func(version int) (map[string]*diff.FileInfo, error) {
+		if files, ok := manifests[version]; ok {
+			return files, nil
+		}
+		files, err := differ.Manifest(version)
+		if err != nil {
+			return nil, err
+		}
+		manifests[version] = files
+		return files, nil
+	}
+
+	path = filepath.Clean(path)
+	var result []*Attribution
+	for _, call := range calls {
+		changes, ok := recorded[call.ID]
+		if !ok {
+			before, err := manifest(call.Before)
+			if err != nil {
+				return nil, err
+			}
+			after, err := manifest(*call.After)
+			if err != nil {
+				return nil, err
+			}
+			changes = []db.ToolCallChange{}
+			for _, c := range diff.CompareManifests(before, after) {
+				if n := len(changes); n > 0 && changes[n-1].Path == c.Path {
+					continue // A symlink whose target and mtime both changed
+				}
+				changes = append(changes, db.ToolCallChange{Path: c.Path, Change: strings.ToLower(c.Type.String())})
+			}
+			if err := m.database.RecordToolCallChanges(call.ID, changes); err != nil {
+				return nil, fmt.Errorf("failed to record tool call changes: %w", err)
+			}
+		}
+
+		var matched []diff.Change
+		for _, c := range changes {
+			if path == "." || c.Path == path || strings.HasPrefix(c.Path, path+"/") {
+				matched = append(matched, diff.Change{Path: c.Path, Type: changeType(c.Change)})
+			}
+		}
+		if len(matched) > 0 {
+			result = append(result, &Attribution{Call: call, Changes: matched})
+		}
+	}
+	return result, nil
+}
+
+// changeType parses a change type recorded by Why
+func changeType(s string) diff.ChangeType {
+	switch s {
+	case "added":
+		return diff.Added
+	case "deleted":
+		return diff.Deleted
+	}
+	return diff.Modified
+}
@@ -0,0 +1,209 @@
+// Package clone copies files and directory trees with copy-on-write reflinks
+// (clonefile on darwin, FICLONE on Linux), falling back to a sparse-aware copy
+// on filesystems without reflink support.
+package clone
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// ErrUnsupported indicates the filesystem can't reflink between src and dst
+var ErrUnsupported = errors.New("reflinks not supported")
+
+// Error records a failed clone operation and the path it failed on
+type Error struct {
+	Op   string // "open", "create", "clone", "copy", "mkdir", "symlink" or "walk"
+	Path string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("clone: %s %s: %v", e.Op, e.Path, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Progress describes one file finished by Tree
+type Progress struct {
+	Path      string // Path relative to the source root
+	Bytes     int64  // File size
+	Reflinked bool   // False if the file had to be copied
+	Done      int    // Files finished so far, including this one
+	Total     int    // Files in the tree
+}
+
+// Options configures Tree
+type Options struct {
+	Progress func(Progress) // Called after each file (optional)
+}
+
+// File clones src to dst, replacing dst if it exists. It reports whether the
+// file was reflinked (false means it was copied).
+func File(src, dst string) (bool, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return false, &Error{Op: "open", Path: src, Err: err}
+	}
+
+	err = reflink(src, dst, info.Mode().Perm())
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, ErrUnsupported) {
+		return false, &Error{Op: "clone", Path: src, Err: err}
+	}
+
+	if err := copyFile(src, dst, info); err != nil {
+		os.Remove(dst)
+		return false, err
+	}
+	return false, nil
+}
+
+// Tree clones the contents of the directory src into dst, creating dst and
+// any subdirectories. Symlinks are recreated, not followed.
+func Tree(src, dst string, opts Options) error {
+	type entry struct {
+		rel  string
+		info fs.FileInfo
+	}
+
+	var entries []entry
+	total := 0
+	err := filepath.Walk(src, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return &Error{Op: "walk", Path: path, Err: err}
+		}
+		rel, _ := filepath.Rel(src, path)
+		entries = append(entries, entry{rel: rel, info: info})
+		if info.Mode().IsRegular() {
+			total++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	done := 0
+	for _, e := range entries {
+		srcPath := filepath.Join(src, e.rel)
+		dstPath := filepath.Join(dst, e.rel)
+
+		switch {
+		case e.info.IsDir():
+			if err := os.MkdirAll(dstPath, e.info.Mode().Perm()); err != nil {
+				return &Error{Op: "mkdir", Path: dstPath, Err: err}
+			}
+
+		case e.info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(srcPath)
+			if err != nil {
+				return &Error{Op: "symlink", Path: srcPath, Err: err}
+			}
+			os.Remove(dstPath)
+			if err := os.Symlink(target, dstPath); err != nil {
+				return &Error{Op: "symlink", Path: dstPath, Err: err}
+			}
+
+		case e.info.Mode().IsRegular():
+			reflinked, err := File(srcPath, dstPath)
+			if err != nil {
+				return err
+			}
+			done++
+			if opts.Progress != nil {
+				opts.Progress(Progress{
+					Path:      e.rel,
+					Bytes:     e.info.Size(),
+					Reflinked: reflinked,
+					Done:      done,
+					Total:     total,
+				})
+			}
+		}
+	}
+
+	return nil
+}
+
+// copyFile copies src to dst, skipping holes so sparse files stay sparse
+func copyFile(src, dst string, info fs.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return &Error{Op: "open", Path: src, Err: err}
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return &Error{Op: "create", Path: dst, Err: err}
+	}
+
+	if err := sparseCopy(in, out, info.Size()); err != nil {
+		out.Close()
+		return &Error{Op: "copy", Path: src, Err: err}
+	}
+	if err := out.Close(); err != nil {
+		return &Error{Op: "copy", Path: dst, Err: err}
+	}
+	return nil
+}
+
+// sparseCopy copies the data regions of in to out, leaving holes unallocated
+func sparseCopy(in, out *os.File, size int64) error {
+	err := DataRegions(in, size, func(start, end int64) error {
+		if _, err := out.Seek(start, io.SeekStart); err != nil {
+			return err
+		}
+		_, err := io.CopyN(out, in, end-start)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// Extend to full size (trailing hole)
+	return out.Truncate(size)
+}
+
+// DataRegions calls fn for each region of f holding data, in order, with f
+// positioned at the region's start. Holes in sparse files are skipped;
+// filesystems without SEEK_DATA report the whole file as one region.
+func DataRegions(f *os.File, size int64, fn func(start, end int64) error) error {
+	var off int64
+	for off < size {
+		start, err := f.Seek(off, seekData)
+		if err != nil {
+			if errors.Is(err, syscall.ENXIO) {
+				break // No more data after off
+			}
+			if off != 0 {
+				return err
+			}
+			// No hole detection: one region for the whole file
+			start = 0
+		}
+		end, err := f.Seek(start, seekHole)
+		if err != nil {
+			end = size
+		}
+
+		if _, err := f.Seek(start, io.SeekStart); err != nil {
+			return err
+		}
+		if err := fn(start, end); err != nil {
+			return err
+		}
+		off = end
+	}
+	return nil
+}
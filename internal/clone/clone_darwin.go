@@ -0,0 +1,31 @@
+//go:build darwin
+
+package clone
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Whence values for lseek(2) hole detection
+const (
+	seekData = unix.SEEK_DATA
+	seekHole = unix.SEEK_HOLE
+)
+
+// reflink clones src to dst with clonefile(2). clonefile copies the source
+// permissions itself and requires that dst doesn't exist.
+func reflink(src, dst string, perm fs.FileMode) error {
+	os.Remove(dst)
+	err := unix.Clonefile(src, dst, 0)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, unix.ENOTSUP), errors.Is(err, unix.EXDEV), errors.Is(err, unix.ENOSYS):
+		return ErrUnsupported
+	}
+	return err
+}
@@ -0,0 +1,43 @@
+//go:build linux
+
+package clone
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Whence values for lseek(2) hole detection
+const (
+	seekData = unix.SEEK_DATA
+	seekHole = unix.SEEK_HOLE
+)
+
+// reflink clones src to dst with the FICLONE ioctl
+func reflink(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if err := unix.IoctlFileClone(int(out.Fd()), int(in.Fd())); err != nil {
+		out.Close()
+		for _, unsupported := range []error{unix.EOPNOTSUPP, unix.EXDEV, unix.EINVAL, unix.ENOTTY, unix.EBADF} {
+			if errors.Is(err, unsupported) {
+				return ErrUnsupported
+			}
+		}
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
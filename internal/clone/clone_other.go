@@ -0,0 +1,16 @@
+//go:build !darwin && !linux
+
+package clone
+
+import "io/fs"
+
+// No hole detection: the invalid whence makes DataRegions report the whole file
+const (
+	seekData = -1
+	seekHole = -1
+)
+
+// reflink is not available on this platform
+func reflink(src, dst string, perm fs.FileMode) error {
+	return ErrUnsupported
+}
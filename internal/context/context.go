@@ -5,7 +5,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"syscall"
+
+	"github.com/sleexyz/agentfs/internal/store"
 )
 
 const ContextFileName = ".agentfs"
@@ -60,46 +61,22 @@ func WriteContext(mountDir, storePath string) error {
 	return os.WriteFile(contextFile, []byte(storePath+"\n"), 0644)
 }
 
-// FindStoreFromMount walks up from startDir looking for mount points.
-// If a mount point is found (device ID differs from parent), it checks
-// for a sibling <basename>.fs/data.sparsebundle store.
-// Returns the store path if found, empty string otherwise.
+// FindStoreFromMount walks up from startDir looking for a working copy.
+// At each level it checks for a sibling <basename>.fs/ store whose volume is
+// attached at that directory (a mount point, or a plain directory for
+// mountless backends). Returns the store path if found, empty string otherwise.
 func FindStoreFromMount(startDir string) (string, error) {
 	dir := startDir
 	for {
-		// Get stat info for current directory
-		dirInfo, err := os.Stat(dir)
-		if err != nil {
-			return "", nil // Can't stat, stop walking
-		}
-
-		// Get parent directory
 		parent := filepath.Dir(dir)
 		if parent == dir {
 			// Reached root
 			return "", nil
 		}
 
-		// Get stat info for parent
-		parentInfo, err := os.Stat(parent)
-		if err != nil {
-			return "", nil // Can't stat parent, stop walking
-		}
-
-		// Compare device IDs to detect mount point
-		dirSys, ok1 := dirInfo.Sys().(*syscall.Stat_t)
-		parentSys, ok2 := parentInfo.Sys().(*syscall.Stat_t)
-
-		if ok1 && ok2 && dirSys.Dev != parentSys.Dev {
-			// This directory is a mount point - check for sibling store
-			mountName := filepath.Base(dir)
-			storePath := filepath.Join(parent, mountName+".fs")
-			bundlePath := filepath.Join(storePath, "data.sparsebundle")
-
-			if _, err := os.Stat(bundlePath); err == nil {
-				// Found valid store
-				return storePath, nil
-			}
+		storePath := filepath.Join(parent, filepath.Base(dir)+".fs")
+		if store.IsAttachedAt(storePath, dir) {
+			return storePath, nil
 		}
 
 		// Continue walking up
@@ -168,10 +145,9 @@ func ResolveStore(storeFlag, startDir string) (string, error) {
 	var fsStores []string
 	for _, entry := range entries {
 		if entry.IsDir() && strings.HasSuffix(entry.Name(), ".fs") {
-			// Verify it's a valid store (has data.sparsebundle)
+			// Verify it's a valid store (has backend data, e.g. data.sparsebundle)
 			storePath := filepath.Join(startDir, entry.Name())
-			bundlePath := filepath.Join(storePath, "data.sparsebundle")
-			if _, err := os.Stat(bundlePath); err == nil {
+			if store.IsStore(storePath) {
 				fsStores = append(fsStores, storePath)
 			}
 		}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// BandState records a live data file (sparse bundle band, loop image) as it was
+// when a checkpoint was taken. If the live file still has the same size, mtime
+// and ctime it is unchanged; otherwise its content is compared against Hash,
+// the lazily computed hash of the checkpoint's copy.
+type BandState struct {
+	Name    string
+	Size    int64
+	MtimeNs int64
+	CtimeNs int64
+	Hash    string // Empty until computed
+}
+
+// GetBandStates returns the recorded band states for a checkpoint, keyed by name
+func (d *DB) GetBandStates(checkpointID int64) (map[string]*BandState, error) {
+	rows, err := d.db.Query(`
+		SELECT name, size, mtime_ns, ctime_ns, hash
+		FROM band_state WHERE checkpoint_id = ?
+	`, checkpointID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	states := make(map[string]*BandState)
+	for rows.Next() {
+		var st BandState
+		var hash sql.NullString
+		if err := rows.Scan(&st.Name, &st.Size, &st.MtimeNs, &st.CtimeNs, &hash); err != nil {
+			return nil, err
+		}
+		st.Hash = hash.String
+		states[st.Name] = &st
+	}
+	return states, rows.Err()
+}
+
+// SaveBandStates inserts or replaces band states for a checkpoint
+func (d *DB) SaveBandStates(checkpointID int64, states []*BandState) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT OR REPLACE INTO band_state (checkpoint_id, name, size, mtime_ns, ctime_ns, hash)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return fmt.Errorf("prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, st := range states {
+		if _, err := stmt.Exec(checkpointID, st.Name, st.Size, st.MtimeNs, st.CtimeNs, nullString(st.Hash)); err != nil {
+			return fmt.Errorf("insert band state: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
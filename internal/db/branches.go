@@ -0,0 +1,154 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// DefaultBranch is the branch every store starts on
+const DefaultBranch = "main"
+
+// currentBranchKey is the setting holding the name of the current branch
+const currentBranchKey = "current_branch"
+
+// ErrBranchExists is returned when creating a branch whose name is taken
+var ErrBranchExists = errors.New("branch already exists")
+
+// Branch is a named line of development. New checkpoints on the current
+// branch take its head as their parent and become its head.
+type Branch struct {
+	Name        string
+	HeadVersion *int // Newest checkpoint on the branch (nil until its first checkpoint)
+	CreatedAt   time.Time
+}
+
+// CreateBranch creates a branch whose head is the given version (nil for an
+// empty branch), returning ErrBranchExists if the name is taken
+func (d *DB) CreateBranch(name string, head *int) error {
+	_, err := d.db.Exec(`
+		INSERT INTO branches (name, head_version, created_at) VALUES (?, ?, ?)
+	`, name, nullInt(head), time.Now().Unix())
+	if isUniqueError(err) {
+		return ErrBranchExists
+	}
+	return err
+}
+
+// DeleteBranch removes a branch (not its checkpoints), returning
+// sql.ErrNoRows if it doesn't exist
+func (d *DB) DeleteBranch(name string) error {
+	result, err := d.db.Exec(`DELETE FROM branches WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetBranch returns a branch by name, or nil if it doesn't exist
+func (d *DB) GetBranch(name string) (*Branch, error) {
+	branches, err := d.queryBranches(`WHERE name = ?`, name)
+	if err != nil || len(branches) == 0 {
+		return nil, err
+	}
+	return branches[0], nil
+}
+
+// ListBranches returns all branches ordered by name
+func (d *DB) ListBranches() ([]*Branch, error) {
+	return d.queryBranches(``)
+}
+
+// SetBranchHead points a branch at a checkpoint version, returning
+// sql.ErrNoRows if the branch doesn't exist
+func (d *DB) SetBranchHead(name string, version int) error {
+	result, err := d.db.Exec(`UPDATE branches SET head_version = ? WHERE name = ?`, version, name)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CurrentBranch returns the name of the branch new checkpoints are added to
+func (d *DB) CurrentBranch() (string, error) {
+	name, err := d.GetSetting(currentBranchKey)
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		return DefaultBranch, nil
+	}
+	return name, nil
+}
+
+// SetCurrentBranch makes the named branch current
+func (d *DB) SetCurrentBranch(name string) error {
+	return d.SetSetting(currentBranchKey, name)
+}
+
+// RecomputeBranches derives branches from the checkpoints that recorded them,
+// for a rebuilt database: each branch's head becomes its newest checkpoint,
+// and the branch of the newest checkpoint becomes current
+func (d *DB) RecomputeBranches() error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT OR IGNORE INTO branches (name, created_at)
+		SELECT DISTINCT branch, ? FROM checkpoints WHERE branch IS NOT NULL
+	`, time.Now().Unix()); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		UPDATE branches SET head_version = (
+			SELECT MAX(version) FROM checkpoints WHERE branch = branches.name
+		)
+	`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT OR REPLACE INTO settings (key, value)
+		SELECT ?, branch FROM checkpoints WHERE branch IS NOT NULL ORDER BY version DESC LIMIT 1
+	`, currentBranchKey); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *DB) queryBranches(where string, args ...any) ([]*Branch, error) {
+	rows, err := d.db.Query(`
+		SELECT name, head_version, created_at FROM branches
+		`+where+`
+		ORDER BY name
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var branches []*Branch
+	for rows.Next() {
+		var b Branch
+		var head sql.NullInt64
+		var createdAt int64
+		if err := rows.Scan(&b.Name, &head, &createdAt); err != nil {
+			return nil, err
+		}
+		if head.Valid {
+			v := int(head.Int64)
+			b.HeadVersion = &v
+		}
+		b.CreatedAt = time.Unix(createdAt, 0)
+		branches = append(branches, &b)
+	}
+	return branches, rows.Err()
+}
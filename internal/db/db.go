@@ -24,8 +24,10 @@ type Checkpoint struct {
 	Version       int
 	Message       string
 	CreatedAt     time.Time
-	DurationMs    int64 // Duration of checkpoint creation in milliseconds
-	ParentVersion *int  // Version this checkpoint was created from (null for v1 or imports)
+	DurationMs    int64  // Duration of checkpoint creation in milliseconds
+	ParentVersion *int   // Version this checkpoint was created from (null for v1 or imports)
+	MergeParent   *int   // Version merged in, for a merge of two checkpoints of this store
+	Branch        string // Branch the checkpoint was created on
 }
 
 // DB wraps the per-store SQLite database (foo.fs/metadata.db)
@@ -42,7 +44,9 @@ func Open(path string) (*DB, error) {
 		return nil, fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	db, err := sql.Open("sqlite3", path+"?_foreign_keys=on")
+	// Writers take the lock when a transaction begins and wait on each other
+	// instead of failing with SQLITE_BUSY
+	db, err := sql.Open("sqlite3", path+"?_foreign_keys=on&_txlock=immediate&_busy_timeout=10000")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -62,67 +66,195 @@ func OpenFromStorePath(storePath string) (*DB, error) {
 	return Open(dbPath)
 }
 
-// Close closes the database
-func (d *DB) Close() error {
-	return d.db.Close()
-}
-
-func (d *DB) migrate() error {
-	schema := `
-	-- Store info (singleton row with id=1)
-	CREATE TABLE IF NOT EXISTS store (
-		id INTEGER PRIMARY KEY CHECK (id = 1),
-		name TEXT NOT NULL,
-		created_at INTEGER NOT NULL,
-		size_bytes INTEGER NOT NULL
-	);
-
-	-- Checkpoints
-	CREATE TABLE IF NOT EXISTS checkpoints (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		version INTEGER NOT NULL UNIQUE,
-		message TEXT,
-		created_at INTEGER NOT NULL
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_checkpoints_version ON checkpoints(version DESC);
-
-	-- Settings (key-value store for future use)
-	CREATE TABLE IF NOT EXISTS settings (
-		key TEXT PRIMARY KEY,
-		value TEXT
-	);
-	`
-
-	if _, err := d.db.Exec(schema); err != nil {
-		return err
-	}
-
-	// Migration: Add duration_ms and parent_version columns if they don't exist
-	// SQLite ALTER TABLE ADD COLUMN with NULL default works on existing rows
-	migrations := []string{
-		"ALTER TABLE checkpoints ADD COLUMN duration_ms INTEGER",
-		"ALTER TABLE checkpoints ADD COLUMN parent_version INTEGER",
+// MoveAside renames a store's metadata.db to metadata.db.bak (with its
+// rollback journal, if any) so a fresh database can be created in its place.
+// Earlier backups are kept: if metadata.db.bak exists, the first free
+// metadata.db.bak.N is used. It returns the backup path, or "" if the store
+// has no database.
+func MoveAside(storePath string) (string, error) {
+	dbPath := filepath.Join(storePath, "metadata.db")
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		return "", nil
 	}
 
-	for _, migration := range migrations {
-		// Ignore "duplicate column" errors - column already exists
-		_, err := d.db.Exec(migration)
-		if err != nil && !isDuplicateColumnError(err) {
-			return err
+	backupPath := dbPath + ".bak"
+	for n := 1; ; n++ {
+		if _, err := os.Lstat(backupPath); os.IsNotExist(err) {
+			break
 		}
+		backupPath = fmt.Sprintf("%s.bak.%d", dbPath, n)
+	}
+	os.Remove(backupPath + "-journal")
+	if err := os.Rename(dbPath, backupPath); err != nil {
+		return "", fmt.Errorf("failed to move database aside: %w", err)
+	}
+	// SQLite pairs a hot journal with its database by name
+	if err := os.Rename(dbPath+"-journal", backupPath+"-journal"); err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to move database journal aside: %w", err)
 	}
+	return backupPath, nil
+}
 
-	return nil
+// Close closes the database
+func (d *DB) Close() error {
+	return d.db.Close()
 }
 
-// isDuplicateColumnError checks if the error is a duplicate column error
-func isDuplicateColumnError(err error) bool {
-	if err == nil {
-		return false
-	}
-	// SQLite returns "duplicate column name" error
-	return strings.Contains(err.Error(), "duplicate column")
+// SQL returns the underlying database handle for packages that manage their own tables
+func (d *DB) SQL() *sql.DB {
+	return d.db
+}
+
+// Schema of the tables owned by this package. Stores created before schema
+// versioning already have some of these, so each step tolerates its tables
+// and columns existing.
+func init() {
+	RegisterMigrations(coreComponent,
+		Migration{Version: 1, Name: "store, checkpoints and settings", Up: Exec(`
+			-- Store info (singleton row with id=1)
+			CREATE TABLE IF NOT EXISTS store (
+				id INTEGER PRIMARY KEY CHECK (id = 1),
+				name TEXT NOT NULL,
+				created_at INTEGER NOT NULL,
+				size_bytes INTEGER NOT NULL
+			);
+
+			-- Checkpoints
+			CREATE TABLE IF NOT EXISTS checkpoints (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				version INTEGER NOT NULL UNIQUE,
+				message TEXT,
+				created_at INTEGER NOT NULL
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_checkpoints_version ON checkpoints(version DESC);
+
+			-- Settings (key-value store for future use)
+			CREATE TABLE IF NOT EXISTS settings (
+				key TEXT PRIMARY KEY,
+				value TEXT
+			);
+		`)},
+		Migration{Version: 2, Name: "checkpoint duration and parent", Up: func(tx *sql.Tx) error {
+			if err := addColumn(tx, "checkpoints", "duration_ms", "INTEGER"); err != nil {
+				return err
+			}
+			return addColumn(tx, "checkpoints", "parent_version", "INTEGER")
+		}},
+		Migration{Version: 3, Name: "band state", Up: Exec(`
+			-- Band state per checkpoint, for change detection (see BandState)
+			CREATE TABLE IF NOT EXISTS band_state (
+				checkpoint_id INTEGER NOT NULL REFERENCES checkpoints(id) ON DELETE CASCADE,
+				name TEXT NOT NULL,
+				size INTEGER NOT NULL,
+				mtime_ns INTEGER NOT NULL,
+				ctime_ns INTEGER NOT NULL,
+				hash TEXT,
+				PRIMARY KEY (checkpoint_id, name)
+			);
+		`)},
+		Migration{Version: 4, Name: "operation journal", Up: Exec(`
+			-- Journal of in-progress multi-step operations (see Operation)
+			CREATE TABLE IF NOT EXISTS operations (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				kind TEXT NOT NULL,
+				version INTEGER NOT NULL,
+				step TEXT NOT NULL,
+				started_at INTEGER NOT NULL
+			);
+		`)},
+		Migration{Version: 5, Name: "tags", Up: Exec(`
+			-- Named checkpoints (see Tag)
+			CREATE TABLE tags (
+				name TEXT PRIMARY KEY,
+				checkpoint_id INTEGER NOT NULL REFERENCES checkpoints(id) ON DELETE CASCADE,
+				created_at INTEGER NOT NULL
+			);
+		`)},
+		Migration{Version: 6, Name: "branches", Up: Exec(`
+			-- Named lines of development (see Branch); existing history is on main
+			CREATE TABLE branches (
+				name TEXT PRIMARY KEY,
+				head_version INTEGER,
+				created_at INTEGER NOT NULL
+			);
+
+			ALTER TABLE checkpoints ADD COLUMN branch TEXT;
+			UPDATE checkpoints SET branch = 'main';
+
+			INSERT INTO branches (name, head_version, created_at)
+			SELECT 'main', MAX(version), strftime('%s', 'now') FROM checkpoints;
+			INSERT OR REPLACE INTO settings (key, value) VALUES ('current_branch', 'main');
+		`)},
+		Migration{Version: 7, Name: "squashed checkpoints", Up: Exec(`
+			-- Checkpoints folded into a later one by squash (see Squashed)
+			CREATE TABLE squashed (
+				checkpoint_id INTEGER NOT NULL REFERENCES checkpoints(id) ON DELETE CASCADE,
+				version INTEGER NOT NULL,
+				message TEXT,
+				created_at INTEGER NOT NULL,
+				PRIMARY KEY (checkpoint_id, version)
+			);
+		`)},
+		Migration{Version: 8, Name: "checkpoint metadata", Up: Exec(`
+			-- Key/value metadata per checkpoint (see SetMeta)
+			CREATE TABLE checkpoint_meta (
+				checkpoint_id INTEGER NOT NULL REFERENCES checkpoints(id) ON DELETE CASCADE,
+				key TEXT NOT NULL,
+				value TEXT NOT NULL,
+				PRIMARY KEY (checkpoint_id, key)
+			);
+
+			CREATE INDEX idx_checkpoint_meta_key ON checkpoint_meta(key, value);
+		`)},
+		Migration{Version: 9, Name: "tool calls", Up: Exec(`
+			-- Agent tool calls bracketed by checkpoints (see ToolCall)
+			CREATE TABLE tool_calls (
+				tool_use_id TEXT PRIMARY KEY,
+				session_id TEXT,
+				tool_name TEXT,
+				input TEXT,
+				before_id INTEGER NOT NULL REFERENCES checkpoints(id) ON DELETE CASCADE,
+				after_id INTEGER REFERENCES checkpoints(id) ON DELETE CASCADE,
+				started_at INTEGER NOT NULL
+			);
+
+			CREATE INDEX idx_tool_calls_after ON tool_calls(after_id);
+		`)},
+		Migration{Version: 10, Name: "checkpoint mounts", Up: Exec(`
+			-- Read-only views of checkpoints (see Mount). Not tied to the
+			-- checkpoint row: a view is a clone and outlives its checkpoint.
+			CREATE TABLE mounts (
+				path TEXT PRIMARY KEY,
+				version INTEGER NOT NULL,
+				work_dir TEXT NOT NULL,
+				created_at INTEGER NOT NULL
+			);
+		`)},
+		Migration{Version: 11, Name: "merge parent", Up: func(tx *sql.Tx) error {
+			return addColumn(tx, "checkpoints", "merge_parent_version", "INTEGER")
+		}},
+		Migration{Version: 12, Name: "tool call changes", Up: func(tx *sql.Tx) error {
+			// Files each tool call changed, recorded the first time they are
+			// computed (see RecordToolCallChanges)
+			if err := addColumn(tx, "tool_calls", "changes_recorded", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`
+				CREATE TABLE tool_call_changes (
+					tool_use_id TEXT NOT NULL REFERENCES tool_calls(tool_use_id) ON DELETE CASCADE,
+					path TEXT NOT NULL,
+					change TEXT NOT NULL,
+					PRIMARY KEY (tool_use_id, path)
+				);
+			`)
+			return err
+		}},
+		Migration{Version: 13, Name: "operation previous head", Up: func(tx *sql.Tx) error {
+			// The branch head a journaled checkpoint replaced (see UnreserveCheckpoint)
+			return addColumn(tx, "operations", "prev_head", "INTEGER")
+		}},
+	)
 }
 
 // InitStore initializes store info in the database
@@ -157,9 +289,9 @@ func (d *DB) GetStoreInfo() (*StoreInfo, error) {
 // CreateCheckpoint creates a new checkpoint record
 func (d *DB) CreateCheckpoint(cp *Checkpoint) error {
 	result, err := d.db.Exec(`
-		INSERT INTO checkpoints (version, message, created_at, duration_ms, parent_version)
-		VALUES (?, ?, ?, ?, ?)
-	`, cp.Version, nullString(cp.Message), cp.CreatedAt.Unix(), cp.DurationMs, nullInt(cp.ParentVersion))
+		INSERT INTO checkpoints (version, message, created_at, duration_ms, parent_version, merge_parent_version, branch)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, cp.Version, nullString(cp.Message), cp.CreatedAt.Unix(), cp.DurationMs, nullInt(cp.ParentVersion), nullInt(cp.MergeParent), nullString(cp.Branch))
 	if err != nil {
 		return err
 	}
@@ -168,17 +300,65 @@ func (d *DB) CreateCheckpoint(cp *Checkpoint) error {
 	return nil
 }
 
-// GetNextVersion returns the next version number
-func (d *DB) GetNextVersion() (int, error) {
-	var maxVersion sql.NullInt64
-	err := d.db.QueryRow(`SELECT MAX(version) FROM checkpoints`).Scan(&maxVersion)
+// ReserveCheckpoint allocates the next version and records cp under it in a
+// single transaction, so concurrent writers never get the same version. The
+// same transaction moves cp.Branch's head to the new version and opens an
+// OpCheckpoint journal entry at step, whose ID is returned. cp.ID and
+// cp.Version are set on success.
+func (d *DB) ReserveCheckpoint(cp *Checkpoint, step string) (int64, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var version int
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(version), 0) + 1 FROM checkpoints`).Scan(&version); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO checkpoints (version, message, created_at, duration_ms, parent_version, merge_parent_version, branch)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, version, nullString(cp.Message), cp.CreatedAt.Unix(), cp.DurationMs, nullInt(cp.ParentVersion), nullInt(cp.MergeParent), nullString(cp.Branch))
+	if err != nil {
+		return 0, err
+	}
+	id, _ := result.LastInsertId()
+
+	// The new checkpoint is the head of the branch it was created on; the
+	// journal keeps the head it replaces for UnreserveCheckpoint
+	var prevHead sql.NullInt64
+	if cp.Branch != "" {
+		err := tx.QueryRow(`SELECT head_version FROM branches WHERE name = ?`, cp.Branch).Scan(&prevHead)
+		if err != nil && err != sql.ErrNoRows {
+			return 0, err
+		}
+		if _, err := tx.Exec(`UPDATE branches SET head_version = ? WHERE name = ?`, version, cp.Branch); err != nil {
+			return 0, err
+		}
+	}
+
+	result, err = tx.Exec(`
+		INSERT INTO operations (kind, version, step, started_at, prev_head) VALUES (?, ?, ?, ?, ?)
+	`, OpCheckpoint, version, step, time.Now().Unix(), prevHead)
 	if err != nil {
 		return 0, err
 	}
-	if !maxVersion.Valid {
-		return 1, nil
+	opID, _ := result.LastInsertId()
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
 	}
-	return int(maxVersion.Int64) + 1, nil
+	cp.ID = id
+	cp.Version = version
+	return opID, nil
+}
+
+// SetCheckpointDuration records how long creating a checkpoint took
+func (d *DB) SetCheckpointDuration(version int, durationMs int64) error {
+	_, err := d.db.Exec(`UPDATE checkpoints SET duration_ms = ? WHERE version = ?`, durationMs, version)
+	return err
 }
 
 // GetCheckpoint retrieves a checkpoint by version
@@ -188,11 +368,13 @@ func (d *DB) GetCheckpoint(version int) (*Checkpoint, error) {
 	var message sql.NullString
 	var durationMs sql.NullInt64
 	var parentVersion sql.NullInt64
+	var mergeParent sql.NullInt64
+	var branch sql.NullString
 
 	err := d.db.QueryRow(`
-		SELECT id, version, message, created_at, duration_ms, parent_version
+		SELECT id, version, message, created_at, duration_ms, parent_version, merge_parent_version, branch
 		FROM checkpoints WHERE version = ?
-	`, version).Scan(&cp.ID, &cp.Version, &message, &createdAt, &durationMs, &parentVersion)
+	`, version).Scan(&cp.ID, &cp.Version, &message, &createdAt, &durationMs, &parentVersion, &mergeParent, &branch)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -202,6 +384,7 @@ func (d *DB) GetCheckpoint(version int) (*Checkpoint, error) {
 	}
 
 	cp.Message = message.String
+	cp.Branch = branch.String
 	cp.CreatedAt = time.Unix(createdAt, 0)
 	if durationMs.Valid {
 		cp.DurationMs = durationMs.Int64
@@ -210,6 +393,10 @@ func (d *DB) GetCheckpoint(version int) (*Checkpoint, error) {
 		pv := int(parentVersion.Int64)
 		cp.ParentVersion = &pv
 	}
+	if mergeParent.Valid {
+		mp := int(mergeParent.Int64)
+		cp.MergeParent = &mp
+	}
 
 	return &cp, nil
 }
@@ -217,7 +404,7 @@ func (d *DB) GetCheckpoint(version int) (*Checkpoint, error) {
 // ListCheckpoints returns all checkpoints
 func (d *DB) ListCheckpoints(limit int) ([]*Checkpoint, error) {
 	query := `
-		SELECT id, version, message, created_at, duration_ms, parent_version
+		SELECT id, version, message, created_at, duration_ms, parent_version, merge_parent_version, branch
 		FROM checkpoints
 		ORDER BY version DESC
 	`
@@ -238,12 +425,15 @@ func (d *DB) ListCheckpoints(limit int) ([]*Checkpoint, error) {
 		var message sql.NullString
 		var durationMs sql.NullInt64
 		var parentVersion sql.NullInt64
+		var mergeParent sql.NullInt64
+		var branch sql.NullString
 
-		if err := rows.Scan(&cp.ID, &cp.Version, &message, &createdAt, &durationMs, &parentVersion); err != nil {
+		if err := rows.Scan(&cp.ID, &cp.Version, &message, &createdAt, &durationMs, &parentVersion, &mergeParent, &branch); err != nil {
 			return nil, err
 		}
 
 		cp.Message = message.String
+		cp.Branch = branch.String
 		cp.CreatedAt = time.Unix(createdAt, 0)
 		if durationMs.Valid {
 			cp.DurationMs = durationMs.Int64
@@ -252,6 +442,10 @@ func (d *DB) ListCheckpoints(limit int) ([]*Checkpoint, error) {
 			pv := int(parentVersion.Int64)
 			cp.ParentVersion = &pv
 		}
+		if mergeParent.Valid {
+			mp := int(mergeParent.Int64)
+			cp.MergeParent = &mp
+		}
 
 		checkpoints = append(checkpoints, &cp)
 	}
@@ -266,9 +460,77 @@ func (d *DB) CountCheckpoints() (int, error) {
 	return count, err
 }
 
-// DeleteCheckpoint deletes a checkpoint by version
+// DeleteCheckpoint deletes a checkpoint by version. Branches headed by it
+// and checkpoints descending from it fall back to its parent.
 func (d *DB) DeleteCheckpoint(version int) error {
-	result, err := d.db.Exec("DELETE FROM checkpoints WHERE version = ?", version)
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := deleteCheckpoint(tx, version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UnreserveCheckpoint removes a checkpoint reserved by ReserveCheckpoint that
+// couldn't be created, journaled as operation opID. Unlike DeleteCheckpoint,
+// the branch head goes back to the one it replaced rather than its parent,
+// which differs for checkpoints created with an explicit parent. A missing
+// checkpoint is not an error.
+func (d *DB) UnreserveCheckpoint(opID int64, version int) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var prevHead sql.NullInt64
+	err = tx.QueryRow(`SELECT prev_head FROM operations WHERE id = ?`, opID).Scan(&prevHead)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	// Journals from before prev_head was recorded fall back to the parent
+	if prevHead.Valid {
+		if _, err := tx.Exec(`UPDATE branches SET head_version = ? WHERE head_version = ?`, prevHead.Int64, version); err != nil {
+			return err
+		}
+	}
+	if err := deleteCheckpoint(tx, version); err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deleteCheckpoint deletes a checkpoint record within tx (see DeleteCheckpoint)
+func deleteCheckpoint(tx *sql.Tx, version int) error {
+	if _, err := tx.Exec(`
+		UPDATE branches SET head_version = (SELECT parent_version FROM checkpoints WHERE version = ?)
+		WHERE head_version = ?
+	`, version, version); err != nil {
+		return err
+	}
+	// Children continue from the deleted checkpoint's parent
+	if _, err := tx.Exec(`
+		UPDATE checkpoints SET parent_version = (SELECT parent_version FROM checkpoints WHERE version = ?)
+		WHERE parent_version = ?
+	`, version, version); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		UPDATE checkpoints SET merge_parent_version = (SELECT parent_version FROM checkpoints WHERE version = ?)
+		WHERE merge_parent_version = ?
+	`, version, version); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		UPDATE checkpoints SET merge_parent_version = NULL WHERE merge_parent_version = parent_version
+	`); err != nil {
+		return err
+	}
+	result, err := tx.Exec("DELETE FROM checkpoints WHERE version = ?", version)
 	if err != nil {
 		return err
 	}
@@ -279,6 +541,28 @@ func (d *DB) DeleteCheckpoint(version int) error {
 	return nil
 }
 
+// ListChildren returns the versions of the checkpoints whose parent (or merge
+// parent) is version
+func (d *DB) ListChildren(version int) ([]int, error) {
+	rows, err := d.db.Query(`
+		SELECT version FROM checkpoints WHERE parent_version = ? OR merge_parent_version = ? ORDER BY version
+	`, version, version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []int
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
 // GetLatestCheckpoint returns the most recent checkpoint
 func (d *DB) GetLatestCheckpoint() (*Checkpoint, error) {
 	var cp Checkpoint
@@ -286,12 +570,14 @@ func (d *DB) GetLatestCheckpoint() (*Checkpoint, error) {
 	var message sql.NullString
 	var durationMs sql.NullInt64
 	var parentVersion sql.NullInt64
+	var mergeParent sql.NullInt64
+	var branch sql.NullString
 
 	err := d.db.QueryRow(`
-		SELECT id, version, message, created_at, duration_ms, parent_version
+		SELECT id, version, message, created_at, duration_ms, parent_version, merge_parent_version, branch
 		FROM checkpoints
 		ORDER BY version DESC LIMIT 1
-	`).Scan(&cp.ID, &cp.Version, &message, &createdAt, &durationMs, &parentVersion)
+	`).Scan(&cp.ID, &cp.Version, &message, &createdAt, &durationMs, &parentVersion, &mergeParent, &branch)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -301,6 +587,7 @@ func (d *DB) GetLatestCheckpoint() (*Checkpoint, error) {
 	}
 
 	cp.Message = message.String
+	cp.Branch = branch.String
 	cp.CreatedAt = time.Unix(createdAt, 0)
 	if durationMs.Valid {
 		cp.DurationMs = durationMs.Int64
@@ -309,6 +596,10 @@ func (d *DB) GetLatestCheckpoint() (*Checkpoint, error) {
 		pv := int(parentVersion.Int64)
 		cp.ParentVersion = &pv
 	}
+	if mergeParent.Valid {
+		mp := int(mergeParent.Int64)
+		cp.MergeParent = &mp
+	}
 
 	return &cp, nil
 }
@@ -331,6 +622,11 @@ func (d *DB) SetSetting(key, value string) error {
 	return err
 }
 
+// isUniqueError checks if the error is a UNIQUE or PRIMARY KEY constraint violation
+func isUniqueError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
 func nullString(s string) any {
 	if s == "" {
 		return nil
@@ -0,0 +1,68 @@
+package db
+
+import "time"
+
+// Operation kinds recorded in the journal
+const (
+	OpCheckpoint       = "checkpoint"        // Creating checkpoint Version
+	OpRestore          = "restore"           // Restoring to checkpoint Version
+	OpDeleteCheckpoint = "delete-checkpoint" // Deleting checkpoint Version
+	OpSquash           = "squash"            // Squashing checkpoints into Version
+)
+
+// Operation is a journal entry for a multi-step operation. Entries exist only
+// while the operation is in progress; one left behind by a crashed process is
+// recovered by the next command that takes the store lock.
+type Operation struct {
+	ID        int64
+	Kind      string
+	Version   int
+	Step      string // Last step reached
+	StartedAt time.Time
+}
+
+// BeginOperation records the start of an operation and returns its ID
+func (d *DB) BeginOperation(kind string, version int, step string) (int64, error) {
+	result, err := d.db.Exec(`
+		INSERT INTO operations (kind, version, step, started_at) VALUES (?, ?, ?, ?)
+	`, kind, version, step, time.Now().Unix())
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// SetOperationStep records the progress of an operation
+func (d *DB) SetOperationStep(id int64, step string) error {
+	_, err := d.db.Exec(`UPDATE operations SET step = ? WHERE id = ?`, step, id)
+	return err
+}
+
+// EndOperation removes a finished (or abandoned) operation from the journal
+func (d *DB) EndOperation(id int64) error {
+	_, err := d.db.Exec(`DELETE FROM operations WHERE id = ?`, id)
+	return err
+}
+
+// ListOperations returns the operations in the journal, oldest first
+func (d *DB) ListOperations() ([]*Operation, error) {
+	rows, err := d.db.Query(`
+		SELECT id, kind, version, step, started_at FROM operations ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ops []*Operation
+	for rows.Next() {
+		var op Operation
+		var startedAt int64
+		if err := rows.Scan(&op.ID, &op.Kind, &op.Version, &op.Step, &startedAt); err != nil {
+			return nil, err
+		}
+		op.StartedAt = time.Unix(startedAt, 0)
+		ops = append(ops, &op)
+	}
+	return ops, rows.Err()
+}
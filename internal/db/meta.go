@@ -0,0 +1,111 @@
+package db
+
+import (
+	"sort"
+	"strings"
+)
+
+// SetMeta records key/value metadata on a checkpoint, replacing the values
+// of keys it already has. Metadata is removed with its checkpoint.
+func (d *DB) SetMeta(version int, meta map[string]string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	if err := tx.QueryRow(`SELECT id FROM checkpoints WHERE version = ?`, version).Scan(&id); err != nil {
+		return err
+	}
+	for key, value := range meta {
+		if _, err := tx.Exec(`
+			INSERT OR REPLACE INTO checkpoint_meta (checkpoint_id, key, value) VALUES (?, ?, ?)
+		`, id, key, value); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetMeta returns a checkpoint's metadata (empty if it has none)
+func (d *DB) GetMeta(version int) (map[string]string, error) {
+	all, err := d.queryMeta(`WHERE c.version = ?`, version)
+	if err != nil {
+		return nil, err
+	}
+	if meta := all[version]; meta != nil {
+		return meta, nil
+	}
+	return map[string]string{}, nil
+}
+
+// ListMeta returns the metadata of every checkpoint that has any, by version
+func (d *DB) ListMeta() (map[int]map[string]string, error) {
+	return d.queryMeta(``)
+}
+
+// FindByMeta returns the versions of the checkpoints whose metadata matches
+// every filter. Filter values are GLOB patterns ("f55a4d56*").
+func (d *DB) FindByMeta(filters map[string]string) (map[int]bool, error) {
+	keys := make([]string, 0, len(filters))
+	for key := range filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var conditions []string
+	var args []any
+	for _, key := range keys {
+		conditions = append(conditions, `EXISTS (
+			SELECT 1 FROM checkpoint_meta m
+			WHERE m.checkpoint_id = c.id AND m.key = ? AND m.value GLOB ?
+		)`)
+		args = append(args, key, filters[key])
+	}
+	query := `SELECT c.version FROM checkpoints c`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make(map[int]bool)
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		versions[v] = true
+	}
+	return versions, rows.Err()
+}
+
+func (d *DB) queryMeta(where string, args ...any) (map[int]map[string]string, error) {
+	rows, err := d.db.Query(`
+		SELECT c.version, m.key, m.value
+		FROM checkpoint_meta m JOIN checkpoints c ON c.id = m.checkpoint_id
+		`+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	all := make(map[int]map[string]string)
+	for rows.Next() {
+		var version int
+		var key, value string
+		if err := rows.Scan(&version, &key, &value); err != nil {
+			return nil, err
+		}
+		if all[version] == nil {
+			all[version] = make(map[string]string)
+		}
+		all[version][key] = value
+	}
+	return all, rows.Err()
+}
@@ -0,0 +1,187 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Migration is one ordered, transactional step of a component's schema.
+// Up runs in the same transaction that records the new version, so a
+// migration is applied entirely or not at all.
+type Migration struct {
+	Version int // 1, 2, 3... within the component
+	Name    string
+	Up      func(tx *sql.Tx) error
+}
+
+// coreComponent owns the tables defined in this package; it migrates first
+// because other components' tables reference checkpoints
+const coreComponent = "db"
+
+// ErrSchemaTooNew is returned when a store's database was migrated by a newer
+// agentfs than this binary
+var ErrSchemaTooNew = errors.New("database schema is newer than this agentfs")
+
+// migrations holds registered migrations by component
+var migrations = map[string][]Migration{}
+
+// RegisterMigrations adds migrations for a component (the package owning the
+// tables, e.g. "filehash"). Call it from init; versions must be 1, 2, 3...
+// and released migrations must never change.
+func RegisterMigrations(component string, ms ...Migration) {
+	all := append(migrations[component], ms...)
+	sort.Slice(all, func(i, j int) bool { return all[i].Version < all[j].Version })
+	for i, m := range all {
+		if m.Version != i+1 {
+			panic(fmt.Sprintf("db: %s migrations must be numbered 1..n, got %d at position %d", component, m.Version, i+1))
+		}
+	}
+	migrations[component] = all
+}
+
+// Exec returns a migration step that runs the given SQL statements
+func Exec(statements string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(statements)
+		return err
+	}
+}
+
+// migrate brings every registered component up to date. It refuses databases
+// with a component version, or a component, this binary doesn't know.
+func (d *DB) migrate() error {
+	if _, err := d.db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_version (
+			component TEXT PRIMARY KEY,
+			version INTEGER NOT NULL,
+			migrated_at INTEGER NOT NULL
+		)
+	`); err != nil {
+		return err
+	}
+
+	current, err := d.SchemaVersions()
+	if err != nil {
+		return err
+	}
+	for component, version := range current {
+		known, ok := migrations[component]
+		if !ok {
+			return fmt.Errorf("%w: unknown component %q (v%d); upgrade agentfs", ErrSchemaTooNew, component, version)
+		}
+		if version > len(known) {
+			return fmt.Errorf("%w: %s is at v%d, this agentfs supports up to v%d; upgrade agentfs", ErrSchemaTooNew, component, version, len(known))
+		}
+	}
+
+	for _, component := range componentOrder() {
+		if current[component] == len(migrations[component]) {
+			continue
+		}
+		if err := d.migrateComponent(component); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateComponent applies a component's pending migrations, one transaction each
+func (d *DB) migrateComponent(component string) error {
+	for _, m := range migrations[component] {
+		tx, err := d.db.Begin()
+		if err != nil {
+			return err
+		}
+
+		// Re-read inside the transaction: another process may have migrated
+		var version int
+		err = tx.QueryRow(`SELECT version FROM schema_version WHERE component = ?`, component).Scan(&version)
+		if err != nil && err != sql.ErrNoRows {
+			tx.Rollback()
+			return err
+		}
+		if m.Version <= version {
+			tx.Rollback()
+			continue
+		}
+
+		if err := m.Up(tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("%s migration %d (%s): %w", component, m.Version, m.Name, err)
+		}
+		if _, err := tx.Exec(`
+			INSERT OR REPLACE INTO schema_version (component, version, migrated_at) VALUES (?, ?, ?)
+		`, component, m.Version, time.Now().Unix()); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SchemaVersions returns the migrated version of each component
+func (d *DB) SchemaVersions() (map[string]int, error) {
+	rows, err := d.db.Query(`SELECT component, version FROM schema_version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make(map[string]int)
+	for rows.Next() {
+		var component string
+		var version int
+		if err := rows.Scan(&component, &version); err != nil {
+			return nil, err
+		}
+		versions[component] = version
+	}
+	return versions, rows.Err()
+}
+
+// componentOrder returns the core component followed by the others by name
+func componentOrder() []string {
+	var others []string
+	for component := range migrations {
+		if component != coreComponent {
+			others = append(others, component)
+		}
+	}
+	sort.Strings(others)
+	return append([]string{coreComponent}, others...)
+}
+
+// addColumn adds a column unless the table already has it (stores created
+// before schema versioning may or may not)
+func addColumn(tx *sql.Tx, table, column, definition string) error {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Mount is a checkpoint attached read-only at Path for browsing. WorkDir is
+// the backend's scratch space for it, inside the store.
+type Mount struct {
+	Path      string
+	Version   int
+	WorkDir   string
+	CreatedAt time.Time
+}
+
+// AddMount records a checkpoint mount
+func (d *DB) AddMount(m *Mount) error {
+	_, err := d.db.Exec(`
+		INSERT INTO mounts (path, version, work_dir, created_at)
+		VALUES (?, ?, ?, ?)
+	`, m.Path, m.Version, m.WorkDir, m.CreatedAt.Unix())
+	return err
+}
+
+// GetMount returns the mount at path, or nil if there is none
+func (d *DB) GetMount(path string) (*Mount, error) {
+	var m Mount
+	var createdAt int64
+	err := d.db.QueryRow(`
+		SELECT path, version, work_dir, created_at FROM mounts WHERE path = ?
+	`, path).Scan(&m.Path, &m.Version, &m.WorkDir, &createdAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	m.CreatedAt = time.Unix(createdAt, 0)
+	return &m, nil
+}
+
+// ListMounts returns all checkpoint mounts, oldest first
+func (d *DB) ListMounts() ([]*Mount, error) {
+	rows, err := d.db.Query(`
+		SELECT path, version, work_dir, created_at FROM mounts ORDER BY created_at, rowid
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mounts []*Mount
+	for rows.Next() {
+		var m Mount
+		var createdAt int64
+		if err := rows.Scan(&m.Path, &m.Version, &m.WorkDir, &createdAt); err != nil {
+			return nil, err
+		}
+		m.CreatedAt = time.Unix(createdAt, 0)
+		mounts = append(mounts, &m)
+	}
+	return mounts, rows.Err()
+}
+
+// DeleteMount removes the record of the mount at path
+func (d *DB) DeleteMount(path string) error {
+	_, err := d.db.Exec(`DELETE FROM mounts WHERE path = ?`, path)
+	return err
+}
@@ -0,0 +1,145 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Squashed is a checkpoint folded into a later one by squash, kept for its
+// message. Squashed records are removed with the checkpoint they belong to.
+type Squashed struct {
+	Version   int
+	Message   string
+	CreatedAt time.Time
+}
+
+// Squash folds the checkpoints in versions into the checkpoint into, in one
+// transaction: into takes the message and parent, checkpoints descending
+// from the folded ones take into as their parent, and into records the folded
+// checkpoints (its own old message included, and anything they had folded).
+// The folded checkpoints themselves are left for the caller to delete.
+//
+// The transaction also journals what is left: an OpSquash of into at step,
+// and an OpDeleteCheckpoint of each folded checkpoint at deleteStep. It
+// returns their IDs, the deletes keyed by version.
+func (d *DB) Squash(into int, versions []int, message string, parent *int, step, deleteStep string) (int64, map[int]int64, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	folded := append([]int{into}, versions...)
+	in := "(" + strings.TrimSuffix(strings.Repeat("?,", len(folded)), ",") + ")"
+	args := make([]any, len(folded))
+	for i, v := range folded {
+		args[i] = v
+	}
+
+	// Records carried over from earlier squashes, then the checkpoints themselves
+	if _, err := tx.Exec(`
+		INSERT OR IGNORE INTO squashed (checkpoint_id, version, message, created_at)
+		SELECT (SELECT id FROM checkpoints WHERE version = ?), s.version, s.message, s.created_at
+		FROM squashed s JOIN checkpoints c ON c.id = s.checkpoint_id
+		WHERE c.version IN `+in+` AND c.version != ?
+	`, append(append([]any{into}, args...), into)...); err != nil {
+		return 0, nil, err
+	}
+	if _, err := tx.Exec(`
+		INSERT OR IGNORE INTO squashed (checkpoint_id, version, message, created_at)
+		SELECT (SELECT id FROM checkpoints WHERE version = ?), version, message, created_at
+		FROM checkpoints WHERE version IN `+in+`
+	`, append([]any{into}, args...)...); err != nil {
+		return 0, nil, err
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE checkpoints SET message = ?, parent_version = ? WHERE version = ?
+	`, nullString(message), nullInt(parent), into); err != nil {
+		return 0, nil, err
+	}
+	if _, err := tx.Exec(`
+		UPDATE checkpoints SET parent_version = ?
+		WHERE parent_version IN `+in+` AND version NOT IN `+in+`
+	`, append(append([]any{into}, args...), args...)...); err != nil {
+		return 0, nil, err
+	}
+	if _, err := tx.Exec(`
+		UPDATE checkpoints SET merge_parent_version = ?
+		WHERE merge_parent_version IN `+in+` AND version NOT IN `+in+`
+	`, append(append([]any{into}, args...), args...)...); err != nil {
+		return 0, nil, err
+	}
+	// A checkpoint whose parents both became into is no longer a merge
+	if _, err := tx.Exec(`
+		UPDATE checkpoints SET merge_parent_version = NULL WHERE merge_parent_version = parent_version
+	`); err != nil {
+		return 0, nil, err
+	}
+
+	now := time.Now().Unix()
+	result, err := tx.Exec(`
+		INSERT INTO operations (kind, version, step, started_at) VALUES (?, ?, ?, ?)
+	`, OpSquash, into, step, now)
+	if err != nil {
+		return 0, nil, err
+	}
+	opID, _ := result.LastInsertId()
+	deleteOps := make(map[int]int64, len(versions))
+	for _, v := range versions {
+		result, err := tx.Exec(`
+			INSERT INTO operations (kind, version, step, started_at) VALUES (?, ?, ?, ?)
+		`, OpDeleteCheckpoint, v, deleteStep, now)
+		if err != nil {
+			return 0, nil, err
+		}
+		deleteOps[v], _ = result.LastInsertId()
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, nil, err
+	}
+	return opID, deleteOps, nil
+}
+
+// AddSquashed records checkpoints folded into version, for a rebuilt database
+func (d *DB) AddSquashed(version int, squashed []*Squashed) error {
+	for _, sq := range squashed {
+		if _, err := d.db.Exec(`
+			INSERT OR IGNORE INTO squashed (checkpoint_id, version, message, created_at)
+			SELECT id, ?, ?, ? FROM checkpoints WHERE version = ?
+		`, sq.Version, nullString(sq.Message), sq.CreatedAt.Unix(), version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListSquashed returns the checkpoints folded into version, oldest first
+func (d *DB) ListSquashed(version int) ([]*Squashed, error) {
+	rows, err := d.db.Query(`
+		SELECT s.version, s.message, s.created_at
+		FROM squashed s JOIN checkpoints c ON c.id = s.checkpoint_id
+		WHERE c.version = ?
+		ORDER BY s.version
+	`, version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var squashed []*Squashed
+	for rows.Next() {
+		var sq Squashed
+		var message sql.NullString
+		var createdAt int64
+		if err := rows.Scan(&sq.Version, &message, &createdAt); err != nil {
+			return nil, err
+		}
+		sq.Message = message.String
+		sq.CreatedAt = time.Unix(createdAt, 0)
+		squashed = append(squashed, &sq)
+	}
+	return squashed, rows.Err()
+}
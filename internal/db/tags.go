@@ -0,0 +1,103 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrTagExists is returned when creating a tag whose name is taken
+var ErrTagExists = errors.New("tag already exists")
+
+// Tag is a name pointing at a checkpoint. Tags are removed with their checkpoint.
+type Tag struct {
+	Name      string
+	Version   int
+	CreatedAt time.Time
+}
+
+// SetTag points the tag name at a checkpoint version. An existing tag is
+// moved if replace is set, otherwise ErrTagExists is returned.
+func (d *DB) SetTag(name string, version int, replace bool) error {
+	verb := "INSERT"
+	if replace {
+		verb = "INSERT OR REPLACE"
+	}
+	result, err := d.db.Exec(verb+` INTO tags (name, checkpoint_id, created_at)
+		SELECT ?, id, ? FROM checkpoints WHERE version = ?
+	`, name, time.Now().Unix(), version)
+	if err != nil {
+		if !replace && isUniqueError(err) {
+			return ErrTagExists
+		}
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteTag removes a tag, returning sql.ErrNoRows if it doesn't exist
+func (d *DB) DeleteTag(name string) error {
+	result, err := d.db.Exec(`DELETE FROM tags WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetTag returns a tag by name, or nil if it doesn't exist
+func (d *DB) GetTag(name string) (*Tag, error) {
+	tags, err := d.queryTags(`WHERE t.name = ?`, name)
+	if err != nil || len(tags) == 0 {
+		return nil, err
+	}
+	return tags[0], nil
+}
+
+// ListTags returns all tags ordered by name
+func (d *DB) ListTags() ([]*Tag, error) {
+	return d.queryTags(``)
+}
+
+// GetTagsForVersion returns the names of the tags on a checkpoint
+func (d *DB) GetTagsForVersion(version int) ([]string, error) {
+	tags, err := d.queryTags(`WHERE c.version = ?`, version)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, t := range tags {
+		names = append(names, t.Name)
+	}
+	return names, nil
+}
+
+func (d *DB) queryTags(where string, args ...any) ([]*Tag, error) {
+	rows, err := d.db.Query(`
+		SELECT t.name, c.version, t.created_at
+		FROM tags t JOIN checkpoints c ON c.id = t.checkpoint_id
+		`+where+`
+		ORDER BY t.name
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []*Tag
+	for rows.Next() {
+		var t Tag
+		var createdAt int64
+		if err := rows.Scan(&t.Name, &t.Version, &createdAt); err != nil {
+			return nil, err
+		}
+		t.CreatedAt = time.Unix(createdAt, 0)
+		tags = append(tags, &t)
+	}
+	return tags, rows.Err()
+}
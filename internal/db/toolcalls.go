@@ -0,0 +1,166 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ToolCall is an agent tool call bracketed by checkpoints: Before is the state
+// when its PreToolUse hook ran, After the state when its PostToolUse hook ran
+// (nil until then). The call is removed when either checkpoint is deleted.
+type ToolCall struct {
+	ID        string // The hook's tool_use_id
+	SessionID string
+	ToolName  string
+	Input     string // The tool's command or file_path
+	Before    int
+	After     *int
+	StartedAt time.Time
+}
+
+// BeginToolCall records a tool call that started at tc.Before. Starting a
+// call again replaces it.
+func (d *DB) BeginToolCall(tc *ToolCall) error {
+	_, err := d.db.Exec(`
+		INSERT OR REPLACE INTO tool_calls (tool_use_id, session_id, tool_name, input, before_id, started_at)
+		SELECT ?, ?, ?, ?, id, ? FROM checkpoints WHERE version = ?
+	`, tc.ID, tc.SessionID, tc.ToolName, tc.Input, tc.StartedAt.Unix(), tc.Before)
+	return err
+}
+
+// FinishToolCall records the checkpoint a started tool call ended at,
+// reporting whether there was such a call
+func (d *DB) FinishToolCall(id string, after int) (bool, error) {
+	result, err := d.db.Exec(`
+		UPDATE tool_calls SET after_id = (SELECT id FROM checkpoints WHERE version = ?)
+		WHERE tool_use_id = ? AND after_id IS NULL
+	`, after, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// AddToolCall records a finished tool call, unless one of its checkpoints
+// no longer exists. Used when rebuilding the database from sidecars.
+func (d *DB) AddToolCall(tc *ToolCall) error {
+	_, err := d.db.Exec(`
+		INSERT OR IGNORE INTO tool_calls (tool_use_id, session_id, tool_name, input, before_id, after_id, started_at)
+		SELECT ?, ?, ?, ?, b.id, a.id, ?
+		FROM checkpoints b, checkpoints a
+		WHERE b.version = ? AND a.version = ?
+	`, tc.ID, tc.SessionID, tc.ToolName, tc.Input, tc.StartedAt.Unix(), tc.Before, *tc.After)
+	return err
+}
+
+// ListToolCalls returns the finished tool calls that changed something (whose
+// checkpoints differ), newest first
+func (d *DB) ListToolCalls() ([]*ToolCall, error) {
+	return d.queryToolCalls(``)
+}
+
+// ToolCallsEndingAt returns the finished tool calls whose after checkpoint is
+// version, excluding ones that changed nothing
+func (d *DB) ToolCallsEndingAt(version int) ([]*ToolCall, error) {
+	return d.queryToolCalls(`AND a.version = ?`, version)
+}
+
+// queryToolCalls returns the finished, changing tool calls matching the
+// condition on b (before) and a (after)
+func (d *DB) queryToolCalls(cond string, args ...any) ([]*ToolCall, error) {
+	rows, err := d.db.Query(`
+		SELECT t.tool_use_id, t.session_id, t.tool_name, t.input, b.version, a.version, t.started_at
+		FROM tool_calls t
+		JOIN checkpoints b ON b.id = t.before_id
+		JOIN checkpoints a ON a.id = t.after_id
+		WHERE t.before_id != t.after_id `+cond+`
+		ORDER BY a.version DESC, t.started_at DESC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var calls []*ToolCall
+	for rows.Next() {
+		var tc ToolCall
+		var session, tool, input sql.NullString
+		var after int
+		var startedAt int64
+		if err := rows.Scan(&tc.ID, &session, &tool, &input, &tc.Before, &after, &startedAt); err != nil {
+			return nil, err
+		}
+		tc.SessionID = session.String
+		tc.ToolName = tool.String
+		tc.Input = input.String
+		tc.After = &after
+		tc.StartedAt = time.Unix(startedAt, 0)
+		calls = append(calls, &tc)
+	}
+	return calls, rows.Err()
+}
+
+// ToolCallChange is a file a tool call changed
+type ToolCallChange struct {
+	Path   string
+	Change string // "added", "modified" or "deleted"
+}
+
+// ListToolCallChanges returns the changes recorded for each tool call, by
+// tool_use_id. Calls whose changes haven't been recorded are absent; calls
+// recorded as changing nothing map to an empty list.
+func (d *DB) ListToolCallChanges() (map[string][]ToolCallChange, error) {
+	rows, err := d.db.Query(`
+		SELECT t.tool_use_id, c.path, c.change
+		FROM tool_calls t
+		LEFT JOIN tool_call_changes c ON c.tool_use_id = t.tool_use_id
+		WHERE t.changes_recorded = 1
+		ORDER BY t.tool_use_id, c.path
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := make(map[string][]ToolCallChange)
+	for rows.Next() {
+		var id string
+		var path, change sql.NullString
+		if err := rows.Scan(&id, &path, &change); err != nil {
+			return nil, err
+		}
+		if !path.Valid {
+			changes[id] = []ToolCallChange{}
+			continue
+		}
+		changes[id] = append(changes[id], ToolCallChange{Path: path.String, Change: change.String})
+	}
+	return changes, rows.Err()
+}
+
+// RecordToolCallChanges stores the files a finished tool call changed,
+// replacing any recorded before. The record is dropped with the call.
+func (d *DB) RecordToolCallChanges(id string, changes []ToolCallChange) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM tool_call_changes WHERE tool_use_id = ?`, id); err != nil {
+		return err
+	}
+	for _, c := range changes {
+		if _, err := tx.Exec(`
+			INSERT INTO tool_call_changes (tool_use_id, path, change) VALUES (?, ?, ?)
+		`, id, c.Path, c.Change); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`UPDATE tool_calls SET changes_recorded = 1 WHERE tool_use_id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
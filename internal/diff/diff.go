@@ -98,11 +98,12 @@ var defaultIgnore = []string{
 	".Trashes",
 	".fseventsd",
 	".TemporaryItems",
+	"lost+found",
 	"._*",
 }
 
-// shouldIgnore checks if a path should be ignored
-func shouldIgnore(path string) bool {
+// ShouldIgnore reports whether a path is a system file skipped by diffs
+func ShouldIgnore(path string) bool {
 	base := filepath.Base(path)
 	for _, pattern := range defaultIgnore {
 		if strings.HasPrefix(pattern, "*") {
@@ -128,7 +129,7 @@ func (d *Differ) Diff(fromVersion, toVersion int) (*Result, error) {
 
 	// Mount fromVersion checkpoint
 	var err error
-	fromPath, fromCleanup, err = d.mountCheckpoint(fromVersion)
+	fromPath, fromCleanup, err = d.MountCheckpoint(fromVersion)
 	if err != nil {
 		return nil, fmt.Errorf("failed to mount v%d: %w", fromVersion, err)
 	}
@@ -140,13 +141,13 @@ func (d *Differ) Diff(fromVersion, toVersion int) (*Result, error) {
 	// Get toPath (either mount checkpoint or use live CWD)
 	if toVersion == 0 {
 		// Compare against current (live mount)
-		if !d.store.IsMounted(d.storeObj.MountPath) {
+		if !d.store.IsMounted(d.storeObj) {
 			return nil, fmt.Errorf("store must be mounted to diff against current state")
 		}
 		toPath = d.storeObj.MountPath
 		result.Target = "current"
 	} else {
-		toPath, toCleanup, err = d.mountCheckpoint(toVersion)
+		toPath, toCleanup, err = d.MountCheckpoint(toVersion)
 		if err != nil {
 			return nil, fmt.Errorf("failed to mount v%d: %w", toVersion, err)
 		}
@@ -157,7 +158,7 @@ func (d *Differ) Diff(fromVersion, toVersion int) (*Result, error) {
 	}
 
 	// Compare directories
-	result.Changes, err = d.compareDirectories(fromPath, toPath)
+	result.Changes, err = d.CompareDirectories(fromPath, toPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to compare directories: %w", err)
 	}
@@ -165,9 +166,9 @@ func (d *Differ) Diff(fromVersion, toVersion int) (*Result, error) {
 	return result, nil
 }
 
-// mountCheckpoint creates a temp bundle from checkpoint bands and mounts it
+// MountCheckpoint attaches a checkpoint at a temp location via the store's backend
 // Returns the mount path and a cleanup function
-func (d *Differ) mountCheckpoint(version int) (string, func() error, error) {
+func (d *Differ) MountCheckpoint(version int) (string, func() error, error) {
 	checkpointsPath := d.store.GetCheckpointsPath(d.storeObj)
 	checkpointPath := filepath.Join(checkpointsPath, fmt.Sprintf("v%d", version))
 
@@ -176,108 +177,100 @@ func (d *Differ) mountCheckpoint(version int) (string, func() error, error) {
 		return "", nil, fmt.Errorf("checkpoint v%d not found", version)
 	}
 
-	// Create temp bundle directory
-	timestamp := time.Now().UnixNano()
-	tmpBundle := filepath.Join(os.TempDir(), fmt.Sprintf("agentfs-diff-v%d-%d.sparsebundle", version, timestamp))
-	mountPoint := filepath.Join(os.TempDir(), fmt.Sprintf("agentfs-diff-v%d-%d-mount", version, timestamp))
-
-	// Create bundle structure
-	if err := os.MkdirAll(tmpBundle, 0755); err != nil {
-		return "", nil, fmt.Errorf("failed to create temp bundle directory: %w", err)
-	}
-
-	// Copy metadata from original bundle (Info.plist and token)
-	if err := d.createTempBundle(tmpBundle, checkpointPath); err != nil {
-		os.RemoveAll(tmpBundle)
-		return "", nil, fmt.Errorf("failed to create temp bundle: %w", err)
+	// Create temp work directory (holds the backend's scratch data and mount point)
+	workDir, err := os.MkdirTemp("", fmt.Sprintf("agentfs-diff-v%d-", version))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temp directory: %w", err)
 	}
+	mountPoint := filepath.Join(workDir, "mount")
 
-	// Create mount point
-	if err := os.MkdirAll(mountPoint, 0755); err != nil {
-		os.RemoveAll(tmpBundle)
-		return "", nil, fmt.Errorf("failed to create mount point: %w", err)
-	}
-
-	// Mount the temp bundle
-	cmd := exec.Command("hdiutil", "attach", tmpBundle,
-		"-mountpoint", mountPoint,
-		"-nobrowse",
-		"-quiet")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		os.RemoveAll(tmpBundle)
-		os.RemoveAll(mountPoint)
-		return "", nil, fmt.Errorf("failed to mount temp bundle: %w\n%s", err, output)
+	backend := d.storeObj.Backend
+	if err := backend.AttachSnapshot(d.storeObj, checkpointPath, workDir, mountPoint); err != nil {
+		os.RemoveAll(workDir)
+		return "", nil, err
 	}
 
 	// Return cleanup function
 	cleanup := func() error {
-		return d.unmountCheckpoint(mountPoint, tmpBundle)
+		err := backend.DetachSnapshot(d.storeObj, workDir, mountPoint)
+		os.RemoveAll(workDir)
+		return err
 	}
 
 	return mountPoint, cleanup, nil
 }
 
-// createTempBundle creates a temp sparse bundle structure from checkpoint bands
-func (d *Differ) createTempBundle(tmpBundle, checkpointPath string) error {
-	// Copy Info.plist from original bundle
-	origBundle := d.storeObj.BundlePath
-	infoPlist := filepath.Join(origBundle, "Info.plist")
-	if err := copyFile(infoPlist, filepath.Join(tmpBundle, "Info.plist")); err != nil {
-		return fmt.Errorf("failed to copy Info.plist: %w", err)
-	}
-
-	// Copy token file if it exists
-	tokenFile := filepath.Join(origBundle, "token")
-	if _, err := os.Stat(tokenFile); err == nil {
-		if err := copyFile(tokenFile, filepath.Join(tmpBundle, "token")); err != nil {
-			return fmt.Errorf("failed to copy token: %w", err)
-		}
+// CompareDirectories walks both directories and compares files
+func (d *Differ) CompareDirectories(dir1, dir2 string) ([]Change, error) {
+	files1, err := d.walkDirectory(dir1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %w", dir1, err)
 	}
 
-	// Clone bands from checkpoint using APFS reflink (cp -Rc)
-	// This is instant and uses no extra disk space on APFS
-	bandsDir := filepath.Join(tmpBundle, "bands")
-	cmd := exec.Command("/bin/cp", "-Rc", checkpointPath+"/", bandsDir+"/")
-	output, err := cmd.CombinedOutput()
+	files2, err := d.walkDirectory(dir2)
 	if err != nil {
-		return fmt.Errorf("failed to clone bands: %w\n%s", err, output)
+		return nil, fmt.Errorf("failed to walk %s: %w", dir2, err)
 	}
 
-	return nil
+	return CompareManifests(files1, files2), nil
 }
 
-// unmountCheckpoint unmounts and cleans up a temp bundle
-func (d *Differ) unmountCheckpoint(mountPoint, tmpBundle string) error {
-	// Unmount
-	cmd := exec.Command("hdiutil", "detach", mountPoint, "-quiet")
-	if err := cmd.Run(); err != nil {
-		// Try force detach
-		cmd = exec.Command("hdiutil", "detach", mountPoint, "-force", "-quiet")
-		cmd.Run()
+// Manifest returns the files in a checkpoint, keyed by path. Snapshots that
+// are manifests already are read without mounting them.
+func (d *Differ) Manifest(version int) (map[string]*FileInfo, error) {
+	if mb, ok := d.storeObj.Backend.(store.ManifestBackend); ok {
+		snapshotPath := filepath.Join(d.store.GetCheckpointsPath(d.storeObj), fmt.Sprintf("v%d", version))
+		entries, err := mb.ReadManifest(snapshotPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifest of v%d: %w", version, err)
+		}
+		return manifestFiles(entries), nil
 	}
 
-	// Remove mount point directory
-	os.RemoveAll(mountPoint)
-
-	// Remove temp bundle
-	os.RemoveAll(tmpBundle)
-
-	return nil
-}
-
-// compareDirectories walks both directories and compares files
-func (d *Differ) compareDirectories(dir1, dir2 string) ([]Change, error) {
-	files1, err := d.walkDirectory(dir1)
+	path, cleanup, err := d.MountCheckpoint(version)
 	if err != nil {
-		return nil, fmt.Errorf("failed to walk %s: %w", dir1, err)
+		return nil, fmt.Errorf("failed to mount v%d: %w", version, err)
+	}
+	if cleanup != nil {
+		defer cleanup()
 	}
 
-	files2, err := d.walkDirectory(dir2)
+	files, err := d.walkDirectory(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to walk %s: %w", dir2, err)
+		return nil, fmt.Errorf("failed to walk v%d: %w", version, err)
 	}
+	return files, nil
+}
 
+// manifestFiles converts a snapshot manifest to the file map walkDirectory
+// returns for the same snapshot mounted
+func manifestFiles(entries []store.ManifestEntry) map[string]*FileInfo {
+	files := make(map[string]*FileInfo)
+	for _, e := range entries {
+		ignored := false
+		for p := e.Path; p != "." && p != string(filepath.Separator); p = filepath.Dir(p) {
+			if ShouldIgnore(p) {
+				ignored = true
+				break
+			}
+		}
+		if ignored || e.Mode.IsDir() {
+			continue
+		}
+		files[e.Path] = &FileInfo{
+			Path:   e.Path,
+			Size:   e.Size,
+			Mtime:  e.Mtime,
+			Mode:   e.Mode,
+			IsLink: e.Target != "",
+			Target: e.Target,
+		}
+	}
+	return files
+}
+
+// CompareManifests returns the changes from files1 to files2, sorted by path
+func CompareManifests(files1, files2 map[string]*FileInfo) []Change {
 	var changes []Change
 
 	// Find modified and deleted files (in files1 but different or missing in files2)
@@ -327,7 +320,7 @@ func (d *Differ) compareDirectories(dir1, dir2 string) ([]Change, error) {
 		return changes[i].Path < changes[j].Path
 	})
 
-	return changes, nil
+	return changes
 }
 
 // walkDirectory walks a directory and returns file info map
@@ -352,7 +345,7 @@ func (d *Differ) walkDirectory(root string) (map[string]*FileInfo, error) {
 		}
 
 		// Skip ignored files
-		if shouldIgnore(relPath) {
+		if ShouldIgnore(relPath) {
 			if entry.IsDir() {
 				return filepath.SkipDir
 			}
@@ -453,7 +446,7 @@ func (d *Differ) ShowFileDiff(path1, path2, relPath string) error {
 // DiffFile performs a diff of a specific file between versions
 func (d *Differ) DiffFile(fromVersion, toVersion int, relPath string) error {
 	// Mount fromVersion
-	fromPath, fromCleanup, err := d.mountCheckpoint(fromVersion)
+	fromPath, fromCleanup, err := d.MountCheckpoint(fromVersion)
 	if err != nil {
 		return fmt.Errorf("failed to mount v%d: %w", fromVersion, err)
 	}
@@ -464,13 +457,13 @@ func (d *Differ) DiffFile(fromVersion, toVersion int, relPath string) error {
 	// Get toPath
 	var toPath string
 	if toVersion == 0 {
-		if !d.store.IsMounted(d.storeObj.MountPath) {
+		if !d.store.IsMounted(d.storeObj) {
 			return fmt.Errorf("store must be mounted to diff against current state")
 		}
 		toPath = d.storeObj.MountPath
 	} else {
 		var toCleanup func() error
-		toPath, toCleanup, err = d.mountCheckpoint(toVersion)
+		toPath, toCleanup, err = d.MountCheckpoint(toVersion)
 		if err != nil {
 			return fmt.Errorf("failed to mount v%d: %w", toVersion, err)
 		}
@@ -506,15 +499,6 @@ func isBinaryFile(path string) bool {
 	return false
 }
 
-// copyFile copies a file from src to dst
-func copyFile(src, dst string) error {
-	data, err := os.ReadFile(src)
-	if err != nil {
-		return err
-	}
-	return os.WriteFile(dst, data, 0644)
-}
-
 // humanizeBytes formats bytes in human-readable form
 func humanizeBytes(b int64) string {
 	const unit = 1024
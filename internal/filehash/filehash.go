@@ -13,8 +13,30 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/sleexyz/agentfs/internal/db"
 )
 
+// Schema of the file_versions table, applied when a store's database is opened
+func init() {
+	db.RegisterMigrations("filehash",
+		db.Migration{Version: 1, Name: "file versions", Up: db.Exec(`
+			CREATE TABLE IF NOT EXISTS file_versions (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				checkpoint_id INTEGER NOT NULL REFERENCES checkpoints(id) ON DELETE CASCADE,
+				path TEXT NOT NULL,
+				content_hash TEXT NOT NULL,
+				size INTEGER NOT NULL,
+				mtime INTEGER NOT NULL,
+				UNIQUE(checkpoint_id, path)
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_file_versions_hash ON file_versions(content_hash);
+			CREATE INDEX IF NOT EXISTS idx_file_versions_path ON file_versions(path, checkpoint_id);
+		`)},
+	)
+}
+
 // FileVersion represents a file's content hash at a specific checkpoint
 type FileVersion struct {
 	ID           int64
@@ -64,26 +86,6 @@ func NewManager(db *sql.DB) *Manager {
 	return &Manager{db: db}
 }
 
-// MigrateSchema creates the file_versions table if it doesn't exist
-func (m *Manager) MigrateSchema() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS file_versions (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		checkpoint_id INTEGER NOT NULL REFERENCES checkpoints(id) ON DELETE CASCADE,
-		path TEXT NOT NULL,
-		content_hash TEXT NOT NULL,
-		size INTEGER NOT NULL,
-		mtime INTEGER NOT NULL,
-		UNIQUE(checkpoint_id, path)
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_file_versions_hash ON file_versions(content_hash);
-	CREATE INDEX IF NOT EXISTS idx_file_versions_path ON file_versions(path, checkpoint_id);
-	`
-	_, err := m.db.Exec(schema)
-	return err
-}
-
 // HashDirectory hashes all files in a directory
 func (m *Manager) HashDirectory(dir string, opts HashOptions) ([]HashResult, time.Duration, error) {
 	start := time.Now()
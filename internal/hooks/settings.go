@@ -0,0 +1,315 @@
+// Package hooks installs agentfs's auto-checkpoint hooks into Claude Code
+// settings files, leaving everything else in them untouched.
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Command is the hook command agentfs installs. Hook entries running exactly
+// this command are agentfs's; others are never changed.
+const Command = "agentfs checkpoint create --auto --from-hook 2>/dev/null || true"
+
+// toolMatcher selects the tools that can change files, for tool hooks
+const toolMatcher = "Edit|MultiEdit|Write|NotebookEdit|Bash"
+
+// Events are the hook events agentfs can be installed for
+var Events = []string{"Stop", "SubagentStop", "PreToolUse", "PostToolUse"}
+
+// IsEvent reports whether agentfs can be installed for event
+func IsEvent(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// hookGroup is an entry of an event's list in the settings' hooks object
+type hookGroup struct {
+	Matcher string      `json:"matcher,omitempty"`
+	Hooks   []hookEntry `json:"hooks"`
+}
+
+// hookEntry is a hook of a hookGroup
+type hookEntry struct {
+	Type    string `json:"type"`
+	Command string `json:"command"`
+	Async   bool   `json:"async,omitempty"`
+	Timeout int    `json:"timeout,omitempty"`
+}
+
+// groupFor returns the hook group agentfs installs for event. Stop hooks run
+// in the background; tool hooks must finish before the tool runs (or the
+// next one does), so the checkpoint brackets it.
+func groupFor(event string) hookGroup {
+	entry := hookEntry{Type: "command", Command: Command, Timeout: 30}
+	switch event {
+	case "PreToolUse", "PostToolUse":
+		return hookGroup{Matcher: toolMatcher, Hooks: []hookEntry{entry}}
+	default:
+		entry.Async = true
+		return hookGroup{Hooks: []hookEntry{entry}}
+	}
+}
+
+// Settings is a Claude Code settings file
+type Settings struct {
+	Path string
+	root *object
+}
+
+// UserPath returns the user's settings file (~/.claude/settings.json)
+func UserPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".claude", "settings.json"), nil
+}
+
+// ProjectPath returns the settings file of the project at dir
+func ProjectPath(dir string) string {
+	return filepath.Join(dir, ".claude", "settings.json")
+}
+
+// Load reads the settings file at path; a missing file is empty settings
+func Load(path string) (*Settings, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Settings{Path: path, root: newObject()}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return &Settings{Path: path, root: newObject()}, nil
+	}
+
+	root, err := parseObject(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &Settings{Path: path, root: root}, nil
+}
+
+// Installed returns the events that have an agentfs hook, in settings order
+func (s *Settings) Installed() ([]string, error) {
+	hooks, err := s.hooks()
+	if err != nil {
+		return nil, err
+	}
+
+	var events []string
+	for _, event := range hooks.keys {
+		groups, err := s.groups(hooks, event)
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range groups {
+			if n, err := countOurs(g); err != nil {
+				return nil, err
+			} else if n > 0 {
+				events = append(events, event)
+				break
+			}
+		}
+	}
+	return events, nil
+}
+
+// Install adds the agentfs hook for event, reporting false if it's already
+// there
+func (s *Settings) Install(event string) (bool, error) {
+	installed, err := s.Installed()
+	if err != nil {
+		return false, err
+	}
+	for _, e := range installed {
+		if e == event {
+			return false, nil
+		}
+	}
+
+	hooks, err := s.hooks()
+	if err != nil {
+		return false, err
+	}
+	groups, err := s.groups(hooks, event)
+	if err != nil {
+		return false, err
+	}
+	group, err := marshal(groupFor(event))
+	if err != nil {
+		return false, err
+	}
+	if err := hooks.setJSON(event, append(groups, group)); err != nil {
+		return false, err
+	}
+	return true, s.root.setJSON("hooks", hooks)
+}
+
+// Uninstall removes every agentfs hook, dropping groups, events and the
+// hooks object if nothing else is left in them. It returns the events
+// hooks were removed from.
+func (s *Settings) Uninstall() ([]string, error) {
+	hooks, err := s.hooks()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for _, event := range append([]string(nil), hooks.keys...) {
+		groups, err := s.groups(hooks, event)
+		if err != nil {
+			return nil, err
+		}
+
+		var kept []json.RawMessage
+		changed := false
+		for _, g := range groups {
+			rest, n, err := withoutOurs(g)
+			if err != nil {
+				return nil, err
+			}
+			if n > 0 {
+				changed = true
+			}
+			if rest != nil {
+				kept = append(kept, rest)
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		removed = append(removed, event)
+		if len(kept) == 0 {
+			hooks.delete(event)
+		} else if err := hooks.setJSON(event, kept); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	if len(hooks.keys) == 0 {
+		s.root.delete("hooks")
+		return removed, nil
+	}
+	return removed, s.root.setJSON("hooks", hooks)
+}
+
+// Save writes the settings back, replacing the file atomically
+func (s *Settings) Save() error {
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(s.Path), err)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(s.root); err != nil {
+		return err
+	}
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(s.Path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp := s.Path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), mode); err != nil {
+		return fmt.Errorf("failed to write %s: %w", s.Path, err)
+	}
+	return os.Rename(tmp, s.Path)
+}
+
+// hooks returns the settings' hooks object (empty if there is none)
+func (s *Settings) hooks() (*object, error) {
+	raw, ok := s.root.values["hooks"]
+	if !ok {
+		return newObject(), nil
+	}
+	hooks, err := parseObject(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hooks in %s: %w", s.Path, err)
+	}
+	return hooks, nil
+}
+
+// groups returns the hook groups of an event
+func (s *Settings) groups(hooks *object, event string) ([]json.RawMessage, error) {
+	raw, ok := hooks.values[event]
+	if !ok {
+		return nil, nil
+	}
+	var groups []json.RawMessage
+	if err := json.Unmarshal(raw, &groups); err != nil {
+		return nil, fmt.Errorf("invalid %s hooks in %s: %w", event, s.Path, err)
+	}
+	return groups, nil
+}
+
+// countOurs returns the number of agentfs hooks in a group
+func countOurs(group json.RawMessage) (int, error) {
+	var g struct {
+		Hooks []struct {
+			Command string `json:"command"`
+		} `json:"hooks"`
+	}
+	if err := json.Unmarshal(group, &g); err != nil {
+		return 0, fmt.Errorf("invalid hook group: %w", err)
+	}
+	n := 0
+	for _, h := range g.Hooks {
+		if h.Command == Command {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// withoutOurs returns group without its agentfs hooks (nil if none are left)
+// and how many it had. A group without any is returned unchanged.
+func withoutOurs(group json.RawMessage) (json.RawMessage, int, error) {
+	n, err := countOurs(group)
+	if err != nil || n == 0 {
+		return group, n, err
+	}
+
+	obj, err := parseObject(group)
+	if err != nil {
+		return nil, 0, err
+	}
+	var entries []json.RawMessage
+	if err := json.Unmarshal(obj.values["hooks"], &entries); err != nil {
+		return nil, 0, err
+	}
+	var rest []json.RawMessage
+	for _, e := range entries {
+		var h struct {
+			Command string `json:"command"`
+		}
+		if err := json.Unmarshal(e, &h); err != nil {
+			return nil, 0, err
+		}
+		if h.Command != Command {
+			rest = append(rest, e)
+		}
+	}
+	if len(rest) == 0 {
+		return nil, n, nil
+	}
+	if err := obj.setJSON("hooks", rest); err != nil {
+		return nil, 0, err
+	}
+	data, err := marshal(obj)
+	return data, n, err
+}
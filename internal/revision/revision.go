@@ -0,0 +1,210 @@
+// Package revision resolves revision expressions, the arguments commands
+// accept wherever a checkpoint version is expected.
+//
+// A revision is a base followed by any number of ancestry suffixes:
+//
+//	v12, 12          checkpoint version
+//	latest           the newest checkpoint
+//	green-tests      a tag
+//	approach-b       the head of a branch (tags take precedence)
+//	@{10 min ago}    the newest checkpoint created at or before a time
+//	:/refactor       the newest checkpoint whose message matches a regexp
+//
+//	<rev>^           the parent of <rev>
+//	<rev>~3          the third ancestor of <rev> (~ alone means ~1)
+//
+// A :/ expression takes the rest of the argument as its pattern, so it
+// can't have suffixes.
+package revision
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sleexyz/agentfs/internal/db"
+)
+
+// ErrNotFound is returned when a well-formed revision names no checkpoint
+var ErrNotFound = errors.New("no matching checkpoint")
+
+var versionPattern = regexp.MustCompile(`^v?[0-9]+$`)
+
+// Resolve returns the checkpoint version a revision expression names.
+// Plain versions are returned as-is, whether or not the checkpoint exists;
+// anything that has to be looked up or walked must exist.
+func Resolve(database *db.DB, expr string) (int, error) {
+	if expr == "" {
+		return 0, fmt.Errorf("empty revision")
+	}
+
+	if strings.HasPrefix(expr, ":/") {
+		return resolveMessage(database, expr[2:])
+	}
+
+	base, suffixes, err := split(expr)
+	if err != nil {
+		return 0, err
+	}
+	version, err := resolveBase(database, base)
+	if err != nil {
+		return 0, err
+	}
+	return walk(database, version, suffixes, expr)
+}
+
+// split separates the base of an expression from its ancestry suffixes
+func split(expr string) (string, string, error) {
+	if strings.HasPrefix(expr, "@{") {
+		end := strings.Index(expr, "}")
+		if end < 0 {
+			return "", "", fmt.Errorf("missing '}' in %q", expr)
+		}
+		return expr[:end+1], expr[end+1:], nil
+	}
+	if i := strings.IndexAny(expr, "~^"); i >= 0 {
+		return expr[:i], expr[i:], nil
+	}
+	return expr, "", nil
+}
+
+// resolveBase resolves a revision without suffixes
+func resolveBase(database *db.DB, base string) (int, error) {
+	switch {
+	case base == "":
+		return 0, fmt.Errorf("missing revision before '~' or '^'")
+
+	case versionPattern.MatchString(base):
+		v, err := strconv.Atoi(strings.TrimPrefix(base, "v"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid version %q", base)
+		}
+		if v < 1 {
+			return 0, fmt.Errorf("version must be positive")
+		}
+		return v, nil
+
+	case base == "latest":
+		cp, err := database.GetLatestCheckpoint()
+		if err != nil {
+			return 0, err
+		}
+		if cp == nil {
+			return 0, fmt.Errorf("%w: no checkpoints yet", ErrNotFound)
+		}
+		return cp.Version, nil
+
+	case strings.HasPrefix(base, "@{"):
+		return resolveTime(database, strings.TrimSuffix(base[2:], "}"))
+	}
+
+	tag, err := database.GetTag(base)
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up tag: %w", err)
+	}
+	if tag != nil {
+		return tag.Version, nil
+	}
+
+	branch, err := database.GetBranch(base)
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up branch: %w", err)
+	}
+	if branch == nil {
+		return 0, fmt.Errorf("%w: %q is not a version, tag, branch, or revision (e.g., v3, latest~1, @{1 hour ago}, :/message)", ErrNotFound, base)
+	}
+	if branch.HeadVersion == nil {
+		return 0, fmt.Errorf("%w: branch %q has no checkpoints", ErrNotFound, base)
+	}
+	return *branch.HeadVersion, nil
+}
+
+// walk applies ancestry suffixes (^, ~, ~N) to a version
+func walk(database *db.DB, version int, suffixes, expr string) (int, error) {
+	for suffixes != "" {
+		steps := 1
+		switch suffixes[0] {
+		case '^':
+			suffixes = suffixes[1:]
+		case '~':
+			digits := len(suffixes[1:]) - len(strings.TrimLeft(suffixes[1:], "0123456789"))
+			if digits > 0 {
+				n, err := strconv.Atoi(suffixes[1 : 1+digits])
+				if err != nil {
+					return 0, fmt.Errorf("bad ancestor count in %q", expr)
+				}
+				steps = n
+			}
+			suffixes = suffixes[1+digits:]
+		default:
+			return 0, fmt.Errorf("unexpected %q in %q", suffixes, expr)
+		}
+
+		for i := 0; i < steps; i++ {
+			cp, err := database.GetCheckpoint(version)
+			if err != nil {
+				return 0, err
+			}
+			if cp == nil {
+				return 0, fmt.Errorf("%w: v%d doesn't exist", ErrNotFound, version)
+			}
+			if cp.ParentVersion == nil {
+				return 0, fmt.Errorf("%w: v%d has no parent", ErrNotFound, version)
+			}
+			version = *cp.ParentVersion
+		}
+	}
+	return version, nil
+}
+
+// resolveTime finds the newest checkpoint created at or before a time
+func resolveTime(database *db.DB, spec string) (int, error) {
+	t, err := ParseTime(spec, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	checkpoints, err := database.ListCheckpoints(0)
+	if err != nil {
+		return 0, err
+	}
+	var found *db.Checkpoint
+	for _, cp := range checkpoints {
+		if cp.CreatedAt.After(t) {
+			continue
+		}
+		// Listed newest version first, so ties keep the higher version
+		if found == nil || cp.CreatedAt.After(found.CreatedAt) {
+			found = cp
+		}
+	}
+	if found == nil {
+		return 0, fmt.Errorf("%w: no checkpoint at or before %s", ErrNotFound, t.Format("2006-01-02 15:04:05"))
+	}
+	return found.Version, nil
+}
+
+// resolveMessage finds the newest checkpoint whose message matches a regexp
+func resolveMessage(database *db.DB, pattern string) (int, error) {
+	if pattern == "" {
+		return 0, fmt.Errorf("missing pattern after ':/'")
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return 0, fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	checkpoints, err := database.ListCheckpoints(0)
+	if err != nil {
+		return 0, err
+	}
+	for _, cp := range checkpoints {
+		if re.MatchString(cp.Message) {
+			return cp.Version, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: no checkpoint message matches %q", ErrNotFound, pattern)
+}
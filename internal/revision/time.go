@@ -0,0 +1,73 @@
+package revision
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var agoPattern = regexp.MustCompile(`^([0-9]+)\s*([a-z]+)\s+ago$`)
+
+// units maps the unit words accepted in "<n> <unit> ago" to durations
+var units = map[string]time.Duration{
+	"s":      time.Second,
+	"sec":    time.Second,
+	"second": time.Second,
+	"m":      time.Minute,
+	"min":    time.Minute,
+	"minute": time.Minute,
+	"h":      time.Hour,
+	"hr":     time.Hour,
+	"hour":   time.Hour,
+	"d":      24 * time.Hour,
+	"day":    24 * time.Hour,
+	"w":      7 * 24 * time.Hour,
+	"week":   7 * 24 * time.Hour,
+}
+
+// absoluteLayouts are the absolute time formats ParseTime accepts, in local time
+var absoluteLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// ParseTime parses a point in time relative to now: "now", "yesterday",
+// "<n> <unit> ago" (seconds through weeks, e.g. "10 minutes ago" or "2h ago"),
+// or an absolute date such as "2024-03-01 14:30".
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	switch s {
+	case "now":
+		return now, nil
+	case "yesterday":
+		return now.AddDate(0, 0, -1), nil
+	}
+
+	if m := agoPattern.FindStringSubmatch(s); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time %q", s)
+		}
+		unit, ok := units[m[2]]
+		if !ok && len(m[2]) > 1 {
+			unit, ok = units[strings.TrimSuffix(m[2], "s")]
+		}
+		if !ok {
+			return time.Time{}, fmt.Errorf("invalid time %q: unknown unit %q", s, m[2])
+		}
+		return now.Add(-time.Duration(n) * unit), nil
+	}
+
+	for _, layout := range absoluteLayouts {
+		if t, err := time.ParseInLocation(layout, strings.ToUpper(s), time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (e.g., \"10 minutes ago\", \"yesterday\", \"2024-03-01 14:30\")", s)
+}
@@ -0,0 +1,259 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Backend is a storage implementation behind a store. It owns the store's
+// data volume (how it is created, attached and detached) and its snapshots
+// (how checkpoints are cloned, restored and browsed).
+//
+// Every backend keeps the same layout: foo.fs/ holds the backend's data plus
+// a checkpoints/ directory with one vN entry per checkpoint, and foo/ is the
+// working copy.
+type Backend interface {
+	// Name returns the backend identifier (e.g., "sparsebundle")
+	Name() string
+
+	// DataPath returns the path to the backend's data inside the store directory.
+	// A store is recognised as belonging to a backend if this path exists.
+	DataPath(storePath string) string
+
+	// CreateVolume creates the backing volume for a new store
+	CreateVolume(s *Store, opts CreateOpts) error
+
+	// Attach makes the store's volume available at mountPath
+	Attach(s *Store, mountPath string) error
+
+	// Detach releases the volume attached at mountPath
+	Detach(s *Store, mountPath string) error
+
+	// IsAttached reports whether the store's volume is attached at mountPath
+	IsAttached(s *Store, mountPath string) bool
+
+	// CloneSnapshot clones the store's current data into dst (checkpoints/vN)
+	CloneSnapshot(s *Store, dst string) error
+
+	// RestoreSnapshot replaces the store's current data with the snapshot at src.
+	// The volume must be detached.
+	RestoreSnapshot(s *Store, src string) error
+
+	// RecoverRestore cleans up after a RestoreSnapshot that was interrupted
+	// midway, leaving the store's data consistent (as before or after the restore)
+	RecoverRestore(s *Store) error
+
+	// ListSnapshots returns the versions of all snapshots on disk, ascending
+	ListSnapshots(s *Store) ([]int, error)
+
+	// AttachSnapshot exposes the snapshot at snapshotPath at mountPoint without
+	// touching the working copy or the snapshot. Volume backends mount it
+	// read-only. workDir is scratch space owned by the caller.
+	AttachSnapshot(s *Store, snapshotPath, workDir, mountPoint string) error
+
+	// DetachSnapshot tears down a view created by AttachSnapshot
+	DetachSnapshot(s *Store, workDir, mountPoint string) error
+
+	// ForkSnapshot creates the data of a new store dst (whose directory
+	// exists) from src's snapshot at snapshotPath. dst shares nothing with
+	// src afterwards.
+	ForkSnapshot(src *Store, snapshotPath string, dst *Store) error
+}
+
+// VolumeBackend is implemented by backends whose snapshots are clones of a set
+// of data files: each live data file is cloned to checkpoints/vN/<name>
+type VolumeBackend interface {
+	// DataFiles returns the paths of the live data files, keyed by name
+	DataFiles(s *Store) (map[string]string, error)
+}
+
+// ChangeDetector is implemented by backends that compare the working copy
+// with a snapshot themselves
+type ChangeDetector interface {
+	// HasChanges reports whether the working copy differs from the snapshot at snapshotPath
+	HasChanges(s *Store, snapshotPath string) (bool, error)
+}
+
+// Checker is implemented by backends that can verify their own files
+type Checker interface {
+	// CheckData returns problems with the store's live data. With repair,
+	// problems the backend can fix are fixed and marked Repaired.
+	CheckData(s *Store, repair bool) []Problem
+
+	// CheckSnapshot returns problems with the snapshot at snapshotPath. With
+	// verify, stored content is also checked against its recorded hashes.
+	CheckSnapshot(s *Store, snapshotPath string, verify bool) []Problem
+}
+
+// Pruner is implemented by backends whose snapshots share stored data, which
+// has to be removed separately once no snapshot references it
+type Pruner interface {
+	// PruneData removes stored data referenced by no snapshot, treating the
+	// snapshots in skip as already deleted. It returns the number of items
+	// and bytes freed; with dryRun nothing is removed.
+	PruneData(s *Store, skip map[int]bool, dryRun bool) (int, int64, error)
+}
+
+// ViewProtector is implemented by backends whose snapshot views are plain
+// copies rather than read-only mounts
+type ViewProtector interface {
+	// ProtectView makes the view AttachSnapshot created at mountPoint
+	// read-only. DetachSnapshot still removes it.
+	ProtectView(mountPoint string) error
+}
+
+// Problem is an inconsistency found by a Checker
+type Problem struct {
+	Path     string
+	Message  string
+	Repaired bool
+}
+
+// backends holds registered backends in detection order
+var backends []Backend
+
+// RegisterBackend makes a backend available for new and existing stores
+func RegisterBackend(b Backend) {
+	backends = append(backends, b)
+}
+
+// LookupBackend returns the registered backend with the given name
+func LookupBackend(name string) (Backend, error) {
+	for _, b := range backends {
+		if b.Name() == name {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown backend %q (available: %s)", name, strings.Join(BackendNames(), ", "))
+}
+
+// BackendNames returns the names of all registered backends
+func BackendNames() []string {
+	var names []string
+	for _, b := range backends {
+		names = append(names, b.Name())
+	}
+	return names
+}
+
+// DetectBackend returns the backend that owns the store at storePath,
+// or nil if the directory is not a valid store
+func DetectBackend(storePath string) Backend {
+	for _, b := range backends {
+		if _, err := os.Stat(b.DataPath(storePath)); err == nil {
+			return b
+		}
+		// A restore interrupted mid-swap leaves only the backup (see RecoverRestore)
+		if _, err := os.Stat(b.DataPath(storePath) + ".pre-restore"); err == nil {
+			return b
+		}
+	}
+	return nil
+}
+
+// IsStore reports whether storePath is a store directory of any backend
+func IsStore(storePath string) bool {
+	return DetectBackend(storePath) != nil
+}
+
+// IsAttachedAt reports whether the store at storePath has its working copy at dir
+func IsAttachedAt(storePath, dir string) bool {
+	b := DetectBackend(storePath)
+	if b == nil {
+		return false
+	}
+	s := &Store{
+		Name:       strings.TrimSuffix(filepath.Base(storePath), ".fs"),
+		StorePath:  storePath,
+		BundlePath: b.DataPath(storePath),
+		MountPath:  dir,
+		Backend:    b,
+	}
+	return b.IsAttached(s, dir)
+}
+
+// DefaultBackend returns the name of the backend used when none is specified.
+// AGENTFS_BACKEND overrides the platform default. Loop mounts need root, so
+// unprivileged Linux users (and other platforms) get the mountless dir backend.
+func DefaultBackend() string {
+	if name := os.Getenv("AGENTFS_BACKEND"); name != "" {
+		return name
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return "sparsebundle"
+	case "linux":
+		if os.Geteuid() == 0 {
+			return "loop"
+		}
+	}
+	return "dir"
+}
+
+// listSnapshotVersions returns the versions of vN directories in checkpointsPath
+func listSnapshotVersions(checkpointsPath string) ([]int, error) {
+	entries, err := os.ReadDir(checkpointsPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []int
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), "v") {
+			continue
+		}
+		v, err := strconv.Atoi(strings.TrimPrefix(entry.Name(), "v"))
+		if err != nil {
+			continue
+		}
+		versions = append(versions, v)
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
+
+// isMountPoint checks if a path is a mount point
+func isMountPoint(path string) bool {
+	// Check if the path exists
+	pathInfo, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	if !pathInfo.IsDir() {
+		return false
+	}
+
+	// Fast check: compare device IDs between path and its parent
+	// If different, it's a mount point
+	parentPath := filepath.Dir(path)
+	parentInfo, err := os.Stat(parentPath)
+	if err != nil {
+		return false
+	}
+
+	// Get system-specific stat info to compare device IDs
+	pathSys, ok1 := pathInfo.Sys().(*syscall.Stat_t)
+	parentSys, ok2 := parentInfo.Sys().(*syscall.Stat_t)
+
+	if ok1 && ok2 {
+		return pathSys.Dev != parentSys.Dev
+	}
+
+	// Fallback: check if path is in mount list (slower but reliable)
+	cmd := exec.Command("mount")
+	output, err := cmd.Output()
+	if err != nil {
+		return false
+	}
+	return strings.Contains(string(output), " on "+path+" ")
+}
@@ -0,0 +1,676 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/sleexyz/agentfs/internal/clone"
+	"github.com/sleexyz/agentfs/internal/filehash"
+)
+
+// dirBackend keeps the working copy as a plain directory and snapshots it into a
+// content-addressed object store (foo.fs/objects/). Each checkpoint is a manifest
+// of paths to object hashes, so it needs no mount and no root privileges.
+//
+// While unmounted, the working copy is parked inside the store at foo.fs/worktree/.
+type dirBackend struct{}
+
+func init() {
+	RegisterBackend(dirBackend{})
+}
+
+// ManifestFile is the name of the manifest written into each checkpoint directory
+const ManifestFile = "manifest.json"
+
+// ManifestEntry describes one file in a directory snapshot
+type ManifestEntry struct {
+	Path   string      `json:"path"`
+	Hash   string      `json:"hash,omitempty"` // Object hash (regular files only)
+	Size   int64       `json:"size"`
+	Mtime  time.Time   `json:"mtime"`
+	Mode   fs.FileMode `json:"mode"`
+	Target string      `json:"target,omitempty"` // Symlink target
+}
+
+// ManifestBackend is implemented by backends whose snapshots are file manifests
+// rather than opaque volume clones
+type ManifestBackend interface {
+	ReadManifest(snapshotPath string) ([]ManifestEntry, error)
+}
+
+func (dirBackend) Name() string {
+	return "dir"
+}
+
+func (dirBackend) DataPath(storePath string) string {
+	return filepath.Join(storePath, "objects")
+}
+
+func (b dirBackend) CreateVolume(s *Store, opts CreateOpts) error {
+	if err := os.MkdirAll(s.BundlePath, 0755); err != nil {
+		return fmt.Errorf("failed to create object directory: %w", err)
+	}
+	if err := os.MkdirAll(b.worktreePath(s), 0755); err != nil {
+		return fmt.Errorf("failed to create working copy: %w", err)
+	}
+	return nil
+}
+
+// Attach moves the parked working copy to mountPath
+func (b dirBackend) Attach(s *Store, mountPath string) error {
+	parked := b.worktreePath(s)
+	if _, err := os.Stat(parked); os.IsNotExist(err) {
+		return fmt.Errorf("working copy is already attached")
+	}
+
+	// mountPath may exist as an empty mount point directory
+	os.Remove(mountPath)
+	if err := os.Rename(parked, mountPath); err != nil {
+		return fmt.Errorf("failed to attach working copy: %w", err)
+	}
+	return nil
+}
+
+// Detach parks the working copy at mountPath inside the store
+func (b dirBackend) Detach(s *Store, mountPath string) error {
+	parked := b.worktreePath(s)
+	if _, err := os.Stat(parked); err == nil {
+		return fmt.Errorf("working copy is not attached")
+	}
+	if err := os.Rename(mountPath, parked); err != nil {
+		return fmt.Errorf("failed to detach working copy: %w", err)
+	}
+	return nil
+}
+
+func (b dirBackend) IsAttached(s *Store, mountPath string) bool {
+	if _, err := os.Stat(b.worktreePath(s)); err == nil {
+		return false
+	}
+	info, err := os.Stat(mountPath)
+	return err == nil && info.IsDir()
+}
+
+// CloneSnapshot hashes the working copy, stores new contents as objects and
+// writes the manifest to dst. Files unchanged since the latest checkpoint
+// (same size and mtime) reuse their previous hash without being read.
+func (b dirBackend) CloneSnapshot(s *Store, dst string) error {
+	root := b.treePath(s)
+
+	prev, _ := b.ReadManifest(filepath.Join(s.StorePath, "checkpoints", "latest"))
+	entries, err := scanTree(root, prev)
+	if err != nil {
+		return err
+	}
+
+	for i := range entries {
+		e := &entries[i]
+		if e.Target != "" {
+			continue
+		}
+		hash, err := b.storeObject(s, filepath.Join(root, e.Path), e.Hash)
+		if err != nil {
+			return fmt.Errorf("failed to store %s: %w", e.Path, err)
+		}
+		e.Hash = hash
+	}
+
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return fmt.Errorf("failed to create checkpoint directory: %w", err)
+	}
+	return writeManifest(filepath.Join(dst, ManifestFile), entries)
+}
+
+// HasChanges reports whether the working copy differs from the snapshot in
+// content, file mode or symlink targets
+func (b dirBackend) HasChanges(s *Store, snapshotPath string) (bool, error) {
+	prev, err := b.ReadManifest(snapshotPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	current, err := scanTree(b.treePath(s), prev)
+	if err != nil {
+		return false, err
+	}
+
+	if len(current) != len(prev) {
+		return true, nil
+	}
+	for i := range current {
+		c, p := current[i], prev[i]
+		if c.Path != p.Path || c.Hash != p.Hash || c.Target != p.Target || c.Mode != p.Mode {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// RestoreSnapshot rebuilds the (detached) working copy from the snapshot's manifest,
+// rewriting only files whose contents differ
+func (b dirBackend) RestoreSnapshot(s *Store, src string) error {
+	entries, err := b.ReadManifest(src)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	root := b.treePath(s)
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return fmt.Errorf("failed to create working copy: %w", err)
+	}
+
+	want := make(map[string]*ManifestEntry, len(entries))
+	prevHashes := make(map[string]*filehash.FileVersion)
+	for i := range entries {
+		e := &entries[i]
+		want[e.Path] = e
+		if e.Hash != "" {
+			prevHashes[e.Path] = &filehash.FileVersion{Path: e.Path, ContentHash: e.Hash, Size: e.Size, Mtime: e.Mtime}
+		}
+	}
+
+	// Remove files that aren't part of the snapshot
+	var extra []string
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		relPath, _ := filepath.Rel(root, path)
+		if e, ok := want[relPath]; !ok || (e.Target != "") != (d.Type()&fs.ModeSymlink != 0) {
+			extra = append(extra, path)
+		}
+		return nil
+	})
+	for _, path := range extra {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+	pruneEmptyDirs(root)
+
+	// Hash what's left (cheap for files whose size and mtime still match)
+	results, _, err := filehash.NewManager(nil).HashDirectory(root, filehash.HashOptions{
+		SkipDirs:   map[string]bool{},
+		PrevHashes: prevHashes,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to hash working copy: %w", err)
+	}
+	current := make(map[string]string, len(results))
+	for _, r := range results {
+		if r.Error == nil {
+			current[r.Path] = r.ContentHash
+		}
+	}
+
+	for _, e := range entries {
+		absPath := filepath.Join(root, e.Path)
+		if e.Target != "" {
+			if target, err := os.Readlink(absPath); err == nil && target == e.Target {
+				continue
+			}
+			os.Remove(absPath)
+			if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+				return err
+			}
+			if err := os.Symlink(e.Target, absPath); err != nil {
+				return fmt.Errorf("failed to restore %s: %w", e.Path, err)
+			}
+			continue
+		}
+
+		if current[e.Path] == e.Hash {
+			os.Chmod(absPath, e.Mode.Perm())
+			continue
+		}
+		if err := b.materialize(s, e, absPath); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", e.Path, err)
+		}
+	}
+
+	return nil
+}
+
+// RecoverRestore has nothing to undo: RestoreSnapshot rewrites the working
+// copy in place and is safe to run again
+func (dirBackend) RecoverRestore(s *Store) error {
+	return nil
+}
+
+func (dirBackend) ListSnapshots(s *Store) ([]int, error) {
+	return listSnapshotVersions(filepath.Join(s.StorePath, "checkpoints"))
+}
+
+// AttachSnapshot materializes the snapshot's files at mountPoint. The copy is
+// writable (see ProtectView), but changes to it never reach the snapshot.
+func (b dirBackend) AttachSnapshot(s *Store, snapshotPath, workDir, mountPoint string) error {
+	entries, err := b.ReadManifest(snapshotPath)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	if err := os.MkdirAll(mountPoint, 0755); err != nil {
+		return fmt.Errorf("failed to create mount point: %w", err)
+	}
+
+	for _, e := range entries {
+		absPath := filepath.Join(mountPoint, e.Path)
+		if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+			os.RemoveAll(mountPoint)
+			return err
+		}
+		if e.Target != "" {
+			err = os.Symlink(e.Target, absPath)
+		} else {
+			err = b.materialize(s, e, absPath)
+		}
+		if err != nil {
+			os.RemoveAll(mountPoint)
+			return fmt.Errorf("failed to materialize %s: %w", e.Path, err)
+		}
+	}
+
+	return nil
+}
+
+// ProtectView removes the write bits from the view's files and directories
+func (dirBackend) ProtectView(mountPoint string) error {
+	return filepath.Walk(mountPoint, func(path string, info fs.FileInfo, err error) error {
+		if err != nil || info.Mode()&fs.ModeSymlink != 0 {
+			return err
+		}
+		return os.Chmod(path, info.Mode().Perm()&^0222)
+	})
+}
+
+// DetachSnapshot removes the view, giving back write permission on its
+// directories (see ProtectView) so their entries can be removed
+func (dirBackend) DetachSnapshot(s *Store, workDir, mountPoint string) error {
+	filepath.Walk(mountPoint, func(path string, info fs.FileInfo, err error) error {
+		if err == nil && info.IsDir() {
+			os.Chmod(path, info.Mode().Perm()|0700)
+		}
+		return nil
+	})
+	return os.RemoveAll(mountPoint)
+}
+
+// ForkSnapshot materializes the snapshot's files from src's objects as dst's
+// parked working copy. dst's object store starts empty and fills up with
+// its first checkpoint.
+func (b dirBackend) ForkSnapshot(src *Store, snapshotPath string, dst *Store) error {
+	if err := os.MkdirAll(dst.BundlePath, 0755); err != nil {
+		return fmt.Errorf("failed to create object directory: %w", err)
+	}
+	return b.AttachSnapshot(src, snapshotPath, "", b.worktreePath(dst))
+}
+
+// CheckData verifies the object store and the working copy. Temp files left
+// by an interrupted checkpoint are removed on repair.
+func (b dirBackend) CheckData(s *Store, repair bool) []Problem {
+	var problems []Problem
+
+	if !dirExists(s.BundlePath) {
+		p := Problem{Path: s.BundlePath, Message: "object store is missing"}
+		if repair {
+			p.Repaired = os.MkdirAll(s.BundlePath, 0755) == nil
+		}
+		problems = append(problems, p)
+	}
+
+	temps, _ := filepath.Glob(filepath.Join(s.BundlePath, "tmp-*"))
+	for _, tmp := range temps {
+		p := Problem{Path: tmp, Message: fmt.Sprintf("leftover temp file %s", filepath.Base(tmp))}
+		if repair {
+			p.Repaired = os.Remove(tmp) == nil
+		}
+		problems = append(problems, p)
+	}
+
+	if !dirExists(b.treePath(s)) {
+		problems = append(problems, Problem{Path: b.worktreePath(s), Message: "working copy is missing (not parked or mounted)"})
+	}
+	return problems
+}
+
+// CheckSnapshot verifies that every file in the snapshot's manifest has its
+// object, and with verify that each object still hashes to its name
+func (b dirBackend) CheckSnapshot(s *Store, snapshotPath string, verify bool) []Problem {
+	entries, err := b.ReadManifest(snapshotPath)
+	if err != nil {
+		return []Problem{{Path: filepath.Join(snapshotPath, ManifestFile), Message: fmt.Sprintf("unreadable manifest: %v", err)}}
+	}
+
+	var problems []Problem
+	for _, e := range entries {
+		if e.Hash == "" {
+			continue // Symlink
+		}
+		objPath := b.objectPath(s, e.Hash)
+		info, err := os.Stat(objPath)
+		if err != nil {
+			problems = append(problems, Problem{Path: objPath, Message: fmt.Sprintf("object for %s is missing", e.Path)})
+			continue
+		}
+		if info.Size() != e.Size {
+			problems = append(problems, Problem{Path: objPath, Message: fmt.Sprintf("object for %s has size %d, expected %d", e.Path, info.Size(), e.Size)})
+			continue
+		}
+		if verify {
+			if hash, err := hashObject(objPath); err != nil || hash != e.Hash {
+				problems = append(problems, Problem{Path: objPath, Message: fmt.Sprintf("object for %s does not match its hash", e.Path)})
+			}
+		}
+	}
+	return problems
+}
+
+// PruneData removes objects that no remaining manifest references. Nothing is
+// removed if any manifest can't be read, since its objects would be lost.
+func (b dirBackend) PruneData(s *Store, skip map[int]bool, dryRun bool) (int, int64, error) {
+	versions, err := b.ListSnapshots(s)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	referenced := make(map[string]bool)
+	checkpointsPath := filepath.Join(s.StorePath, "checkpoints")
+	for _, v := range versions {
+		if skip[v] {
+			continue
+		}
+		entries, err := b.ReadManifest(filepath.Join(checkpointsPath, fmt.Sprintf("v%d", v)))
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to read manifest of v%d: %w", v, err)
+		}
+		for _, e := range entries {
+			if e.Hash != "" {
+				referenced[e.Hash] = true
+			}
+		}
+	}
+
+	var count int
+	var freed int64
+	fanouts, err := os.ReadDir(s.BundlePath)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read object store: %w", err)
+	}
+	for _, fanout := range fanouts {
+		if !fanout.IsDir() || len(fanout.Name()) != 2 {
+			continue // Temp files of a checkpoint in progress
+		}
+		dir := filepath.Join(s.BundlePath, fanout.Name())
+		objects, err := os.ReadDir(dir)
+		if err != nil {
+			return count, freed, err
+		}
+		for _, obj := range objects {
+			if referenced[fanout.Name()+obj.Name()] {
+				continue
+			}
+			info, err := obj.Info()
+			if err != nil {
+				continue
+			}
+			if !dryRun {
+				if err := os.Remove(filepath.Join(dir, obj.Name())); err != nil {
+					return count, freed, err
+				}
+			}
+			count++
+			freed += info.Size()
+		}
+		if !dryRun {
+			os.Remove(dir) // Only succeeds once empty
+		}
+	}
+	return count, freed, nil
+}
+
+// ReadManifest reads the manifest of the snapshot at snapshotPath
+func (dirBackend) ReadManifest(snapshotPath string) ([]ManifestEntry, error) {
+	data, err := os.ReadFile(filepath.Join(snapshotPath, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	var entries []ManifestEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return entries, nil
+}
+
+// worktreePath returns where the working copy is parked while unmounted
+func (dirBackend) worktreePath(s *Store) string {
+	return filepath.Join(s.StorePath, "worktree")
+}
+
+// treePath returns the current location of the working copy
+func (b dirBackend) treePath(s *Store) string {
+	if parked := b.worktreePath(s); dirExists(parked) {
+		return parked
+	}
+	return s.MountPath
+}
+
+// objectPath returns the path of an object in the store
+func (dirBackend) objectPath(s *Store, hash string) string {
+	return filepath.Join(s.BundlePath, hash[:2], hash[2:])
+}
+
+// storeObject ensures the contents of path exist as an object and returns its hash.
+// If the object for expectedHash already exists the file isn't read again; otherwise
+// the file is cloned first and the clone hashed, so the object always matches its name.
+func (b dirBackend) storeObject(s *Store, path, expectedHash string) (string, error) {
+	if expectedHash != "" {
+		if _, err := os.Stat(b.objectPath(s, expectedHash)); err == nil {
+			return expectedHash, nil
+		}
+	}
+
+	tmp, err := tempPath(s.BundlePath, "tmp-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp)
+
+	if _, err := clone.File(path, tmp); err != nil {
+		return "", err
+	}
+	hash, err := hashObject(tmp)
+	if err != nil {
+		return "", err
+	}
+
+	objPath := b.objectPath(s, hash)
+	if _, err := os.Stat(objPath); err == nil {
+		return hash, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(objPath), 0755); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp, 0444); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, objPath); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// materialize clones the object for e to dst, replacing it atomically
+func (b dirBackend) materialize(s *Store, e ManifestEntry, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := tempPath(filepath.Dir(dst), ".agentfs-restore-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	if _, err := clone.File(b.objectPath(s, e.Hash), tmp); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, e.Mode.Perm()); err != nil {
+		return err
+	}
+	// Keep the recorded mtime so incremental hashing and diffs see the file as unchanged
+	if err := os.Chtimes(tmp, e.Mtime, e.Mtime); err != nil {
+		return err
+	}
+
+	// A directory may be in the way of a file
+	if info, err := os.Lstat(dst); err == nil && info.IsDir() {
+		if err := os.RemoveAll(dst); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp, dst)
+}
+
+// tempPath reserves a unique file name in dir
+func tempPath(dir, pattern string) (string, error) {
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	return f.Name(), nil
+}
+
+// hashObject returns the SHA-256 of a file's contents
+func hashObject(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// scanTree lists the files and symlinks under root as manifest entries sorted by
+// path. Files whose size and mtime match an entry in prev reuse its hash.
+func scanTree(root string, prev []ManifestEntry) ([]ManifestEntry, error) {
+	prevHashes := make(map[string]*filehash.FileVersion)
+	for _, e := range prev {
+		if e.Hash != "" {
+			prevHashes[e.Path] = &filehash.FileVersion{
+				Path:        e.Path,
+				ContentHash: e.Hash,
+				Size:        e.Size,
+				Mtime:       e.Mtime,
+			}
+		}
+	}
+
+	results, _, err := filehash.NewManager(nil).HashDirectory(root, filehash.HashOptions{
+		SkipDirs:   map[string]bool{}, // Snapshot everything, including .git and node_modules
+		PrevHashes: prevHashes,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash working copy: %w", err)
+	}
+
+	var entries []ManifestEntry
+	for _, r := range results {
+		if r.Error != nil {
+			if os.IsNotExist(r.Error) {
+				continue // Removed while scanning
+			}
+			return nil, fmt.Errorf("failed to hash %s: %w", r.Path, r.Error)
+		}
+
+		info, err := os.Lstat(filepath.Join(root, r.Path))
+		if err != nil {
+			continue
+		}
+		entries = append(entries, ManifestEntry{
+			Path:  r.Path,
+			Hash:  r.ContentHash,
+			Size:  r.Size,
+			Mtime: r.Mtime,
+			Mode:  info.Mode(),
+		})
+	}
+
+	// Symlinks are recorded by target (HashDirectory only covers regular files)
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil
+		}
+		info, err := os.Lstat(path)
+		if err != nil {
+			return nil
+		}
+		relPath, _ := filepath.Rel(root, path)
+		entries = append(entries, ManifestEntry{
+			Path:   relPath,
+			Size:   info.Size(),
+			Mtime:  info.ModTime(),
+			Mode:   info.Mode(),
+			Target: target,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk working copy: %w", err)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries, nil
+}
+
+// writeManifest writes manifest entries as JSON
+func writeManifest(path string, entries []ManifestEntry) error {
+	if entries == nil {
+		entries = []ManifestEntry{}
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// pruneEmptyDirs removes empty directories below root, deepest first
+func pruneEmptyDirs(root string) {
+	var dirs []string
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() && path != root {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Remove(dirs[i]) // Fails (and is skipped) if not empty
+	}
+}
+
+// dirExists reports whether path exists and is a directory
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
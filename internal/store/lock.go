@@ -0,0 +1,78 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// ErrLocked is returned by TryLock when another process holds the store lock
+var ErrLocked = errors.New("store is locked by another agentfs process")
+
+// Lock is an advisory flock(2) on a store's lock file (foo.fs/lock). It is
+// released by Unlock or when the process exits.
+type Lock struct {
+	f *os.File
+}
+
+// TryLock takes the store lock without waiting. If another process holds it,
+// the returned error wraps ErrLocked and names the holder's PID.
+func TryLock(storePath string) (*Lock, error) {
+	return lockStore(storePath, syscall.LOCK_EX|syscall.LOCK_NB)
+}
+
+// WaitLock takes the store lock, blocking until it is free
+func WaitLock(storePath string) (*Lock, error) {
+	return lockStore(storePath, syscall.LOCK_EX)
+}
+
+func lockStore(storePath string, how int) (*Lock, error) {
+	lockPath := filepath.Join(storePath, "lock")
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			if pid := readLockPID(lockPath); pid > 0 {
+				return nil, fmt.Errorf("%w (pid %d)", ErrLocked, pid)
+			}
+			return nil, ErrLocked
+		}
+		return nil, fmt.Errorf("failed to lock store: %w", err)
+	}
+
+	// Record the holder for error messages (best-effort)
+	f.Truncate(0)
+	f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+
+	return &Lock{f: f}, nil
+}
+
+// Unlock releases the store lock
+func (l *Lock) Unlock() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	l.f.Truncate(0)
+	err := syscall.Flock(int(l.f.Fd()), syscall.LOCK_UN)
+	l.f.Close()
+	l.f = nil
+	return err
+}
+
+// readLockPID returns the PID recorded in a lock file, or 0
+func readLockPID(lockPath string) int {
+	data, err := os.ReadFile(lockPath)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid
+}
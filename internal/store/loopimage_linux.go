@@ -0,0 +1,224 @@
+//go:build linux
+
+package store
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/sleexyz/agentfs/internal/clone"
+)
+
+// loopImage stores data in a sparse filesystem image (foo.fs/data.img) that is
+// loop-mounted at foo/. Checkpoints are FICLONE reflinks of the image, which are
+// instant when the host filesystem supports reflinks (btrfs, XFS).
+type loopImage struct{}
+
+func init() {
+	RegisterBackend(loopImage{})
+}
+
+// imageName is the name of the filesystem image, both in foo.fs/ and in checkpoints/vN/
+const imageName = "data.img"
+
+func (loopImage) Name() string {
+	return "loop"
+}
+
+func (loopImage) DataPath(storePath string) string {
+	return filepath.Join(storePath, imageName)
+}
+
+func (loopImage) CreateVolume(s *Store, opts CreateOpts) error {
+	// Create a sparse image file of the requested size
+	f, err := os.OpenFile(s.BundlePath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create image: %w", err)
+	}
+	if err := f.Truncate(parseSize(opts.Size)); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to size image: %w", err)
+	}
+	f.Close()
+
+	cmd := exec.Command("mkfs.ext4", "-q", "-F", "-L", s.Name, s.BundlePath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to create filesystem: %w\n%s", err, output)
+	}
+	return nil
+}
+
+func (loopImage) Attach(s *Store, mountPath string) error {
+	return mountImage(s.BundlePath, mountPath)
+}
+
+func (loopImage) Detach(s *Store, mountPath string) error {
+	return unmountImage(mountPath)
+}
+
+func (loopImage) IsAttached(s *Store, mountPath string) bool {
+	return isMountPoint(mountPath)
+}
+
+func (loopImage) CloneSnapshot(s *Store, dst string) error {
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return fmt.Errorf("failed to create checkpoint directory: %w", err)
+	}
+	if _, err := clone.File(s.BundlePath, filepath.Join(dst, imageName)); err != nil {
+		return fmt.Errorf("failed to clone image: %w", err)
+	}
+	return nil
+}
+
+// RestoreSnapshot clones the snapshot's image next to the live image and swaps
+// it in, so the live image is never left partially restored
+func (loopImage) RestoreSnapshot(s *Store, src string) error {
+	stagingPath := s.BundlePath + ".restoring"
+	backupPath := s.BundlePath + ".pre-restore"
+
+	// Clone target checkpoint to a staging image
+	if _, err := clone.File(filepath.Join(src, imageName), stagingPath); err != nil {
+		os.Remove(stagingPath)
+		return fmt.Errorf("failed to restore checkpoint: %w", err)
+	}
+
+	// Swap staging in for the current image
+	if err := os.Rename(s.BundlePath, backupPath); err != nil {
+		os.Remove(stagingPath)
+		return fmt.Errorf("failed to backup current image: %w", err)
+	}
+	if err := os.Rename(stagingPath, s.BundlePath); err != nil {
+		// Restore backup
+		os.Rename(backupPath, s.BundlePath)
+		os.Remove(stagingPath)
+		return fmt.Errorf("failed to restore checkpoint: %w", err)
+	}
+
+	// Clean up backup
+	os.Remove(backupPath)
+	return nil
+}
+
+// RecoverRestore finishes or undoes an interrupted swap and removes leftovers
+func (loopImage) RecoverRestore(s *Store) error {
+	backupPath := s.BundlePath + ".pre-restore"
+
+	// Interrupted between the two renames: put the backup back
+	if _, err := os.Stat(s.BundlePath); os.IsNotExist(err) {
+		if err := os.Rename(backupPath, s.BundlePath); err != nil {
+			return fmt.Errorf("failed to restore image backup: %w", err)
+		}
+	}
+
+	os.Remove(s.BundlePath + ".restoring")
+	os.Remove(backupPath)
+	return nil
+}
+
+func (loopImage) ListSnapshots(s *Store) ([]int, error) {
+	return listSnapshotVersions(filepath.Join(s.StorePath, "checkpoints"))
+}
+
+// DataFiles returns the filesystem image
+func (loopImage) DataFiles(s *Store) (map[string]string, error) {
+	return map[string]string{imageName: s.BundlePath}, nil
+}
+
+// CheckData verifies that the filesystem image is present
+func (loopImage) CheckData(s *Store, repair bool) []Problem {
+	return checkImage(s.BundlePath)
+}
+
+// CheckSnapshot verifies that the snapshot holds a filesystem image. Its hash
+// is recorded in the database, so verify is left to the caller.
+func (loopImage) CheckSnapshot(s *Store, snapshotPath string, verify bool) []Problem {
+	return checkImage(filepath.Join(snapshotPath, imageName))
+}
+
+// AttachSnapshot clones the snapshot's image into workDir and loop-mounts the clone
+// read-only, so the checkpoint itself is never modified
+func (loopImage) AttachSnapshot(s *Store, snapshotPath, workDir, mountPoint string) error {
+	tmpImage := filepath.Join(workDir, imageName)
+	if _, err := clone.File(filepath.Join(snapshotPath, imageName), tmpImage); err != nil {
+		return fmt.Errorf("failed to clone image: %w", err)
+	}
+
+	if err := os.MkdirAll(mountPoint, 0755); err != nil {
+		os.Remove(tmpImage)
+		return fmt.Errorf("failed to create mount point: %w", err)
+	}
+
+	if err := mountImage(tmpImage, mountPoint); err != nil {
+		os.Remove(tmpImage)
+		os.RemoveAll(mountPoint)
+		return err
+	}
+
+	// Mount read-write first so the journal is replayed, then remount read-only
+	cmd := exec.Command("mount", "-o", "remount,ro", mountPoint)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		unmountImage(mountPoint)
+		os.Remove(tmpImage)
+		os.RemoveAll(mountPoint)
+		return fmt.Errorf("failed to remount read-only: %w\n%s", err, output)
+	}
+	return nil
+}
+
+func (loopImage) DetachSnapshot(s *Store, workDir, mountPoint string) error {
+	if err := unmountImage(mountPoint); err != nil {
+		// Lazy unmount so the image is released once no longer busy
+		exec.Command("umount", "-l", mountPoint).Run()
+	}
+	os.RemoveAll(mountPoint)
+	os.Remove(filepath.Join(workDir, imageName))
+	return nil
+}
+
+// ForkSnapshot clones the snapshot's image as dst's image
+func (loopImage) ForkSnapshot(src *Store, snapshotPath string, dst *Store) error {
+	if _, err := clone.File(filepath.Join(snapshotPath, imageName), dst.BundlePath); err != nil {
+		os.Remove(dst.BundlePath)
+		return fmt.Errorf("failed to clone image: %w", err)
+	}
+	return nil
+}
+
+// checkImage reports a missing, irregular or empty image file
+func checkImage(path string) []Problem {
+	info, err := os.Stat(path)
+	switch {
+	case os.IsNotExist(err):
+		return []Problem{{Path: path, Message: "image is missing"}}
+	case err != nil:
+		return []Problem{{Path: path, Message: fmt.Sprintf("image is unreadable: %v", err)}}
+	case !info.Mode().IsRegular():
+		return []Problem{{Path: path, Message: "image is not a regular file"}}
+	case info.Size() == 0:
+		return []Problem{{Path: path, Message: "image is empty"}}
+	}
+	return nil
+}
+
+// mountImage loop-mounts a filesystem image at mountPath
+func mountImage(imagePath, mountPath string) error {
+	cmd := exec.Command("mount", "-o", "loop", imagePath, mountPath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to mount image: %w\n%s", err, output)
+	}
+	return nil
+}
+
+// unmountImage unmounts a loop-mounted image (the loop device is released automatically)
+func unmountImage(mountPath string) error {
+	cmd := exec.Command("umount", mountPath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to unmount: %w\n%s", err, output)
+	}
+	return nil
+}
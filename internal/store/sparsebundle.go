@@ -0,0 +1,294 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/sleexyz/agentfs/internal/clone"
+)
+
+// sparseBundle stores data in an APFS sparse bundle (foo.fs/data.sparsebundle/)
+// and snapshots it by cloning the bundle's bands directory with APFS reflinks
+type sparseBundle struct{}
+
+func init() {
+	RegisterBackend(sparseBundle{})
+}
+
+func (sparseBundle) Name() string {
+	return "sparsebundle"
+}
+
+func (sparseBundle) DataPath(storePath string) string {
+	return filepath.Join(storePath, "data.sparsebundle")
+}
+
+func (sparseBundle) CreateVolume(s *Store, opts CreateOpts) error {
+	cmd := exec.Command("hdiutil", "create",
+		"-size", opts.Size,
+		"-type", "SPARSEBUNDLE",
+		"-fs", "APFS",
+		"-volname", s.Name,
+		s.BundlePath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to create sparse bundle: %w\n%s", err, output)
+	}
+	return nil
+}
+
+func (sparseBundle) Attach(s *Store, mountPath string) error {
+	cmd := exec.Command("hdiutil", "attach", s.BundlePath, "-mountpoint", mountPath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to mount sparse bundle: %w\n%s", err, output)
+	}
+	return nil
+}
+
+func (sparseBundle) Detach(s *Store, mountPath string) error {
+	cmd := exec.Command("hdiutil", "detach", mountPath)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to unmount: %w\n%s", err, output)
+	}
+	return nil
+}
+
+func (sparseBundle) IsAttached(s *Store, mountPath string) bool {
+	return isMountPoint(mountPath)
+}
+
+func (b sparseBundle) CloneSnapshot(s *Store, dst string) error {
+	// Clone bands directory using APFS reflinks
+	if err := clone.Tree(b.bandsPath(s), dst, clone.Options{Progress: s.Progress}); err != nil {
+		return fmt.Errorf("failed to clone bands: %w", err)
+	}
+	return nil
+}
+
+// RestoreSnapshot clones the snapshot next to the live bands and swaps it in,
+// so the live bands are never left partially restored
+func (b sparseBundle) RestoreSnapshot(s *Store, src string) error {
+	bandsPath := b.bandsPath(s)
+	stagingPath := bandsPath + ".restoring"
+	backupPath := bandsPath + ".pre-restore"
+
+	// Clone target checkpoint to a staging directory
+	os.RemoveAll(stagingPath)
+	if err := clone.Tree(src, stagingPath, clone.Options{Progress: s.Progress}); err != nil {
+		os.RemoveAll(stagingPath)
+		return fmt.Errorf("failed to restore checkpoint: %w", err)
+	}
+
+	// Swap staging in for the current bands
+	if err := os.Rename(bandsPath, backupPath); err != nil {
+		os.RemoveAll(stagingPath)
+		return fmt.Errorf("failed to backup current bands: %w", err)
+	}
+	if err := os.Rename(stagingPath, bandsPath); err != nil {
+		// Restore backup
+		os.Rename(backupPath, bandsPath)
+		os.RemoveAll(stagingPath)
+		return fmt.Errorf("failed to restore checkpoint: %w", err)
+	}
+
+	// Clean up backup
+	os.RemoveAll(backupPath)
+	return nil
+}
+
+// RecoverRestore finishes or undoes an interrupted swap and removes leftovers
+func (b sparseBundle) RecoverRestore(s *Store) error {
+	bandsPath := b.bandsPath(s)
+	backupPath := bandsPath + ".pre-restore"
+
+	// Interrupted between the two renames: put the backup back
+	if _, err := os.Stat(bandsPath); os.IsNotExist(err) {
+		if err := os.Rename(backupPath, bandsPath); err != nil {
+			return fmt.Errorf("failed to restore bands backup: %w", err)
+		}
+	}
+
+	if err := os.RemoveAll(bandsPath + ".restoring"); err != nil {
+		return err
+	}
+	return os.RemoveAll(backupPath)
+}
+
+func (sparseBundle) ListSnapshots(s *Store) ([]int, error) {
+	return listSnapshotVersions(filepath.Join(s.StorePath, "checkpoints"))
+}
+
+// DataFiles returns the bundle's band files
+func (b sparseBundle) DataFiles(s *Store) (map[string]string, error) {
+	bandsPath := b.bandsPath(s)
+	entries, err := os.ReadDir(bandsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		files[entry.Name()] = filepath.Join(bandsPath, entry.Name())
+	}
+	return files, nil
+}
+
+// CheckData verifies the bundle's Info.plist and bands directory. A missing
+// Info.plist is restored from hdiutil's Info.bckup copy.
+func (b sparseBundle) CheckData(s *Store, repair bool) []Problem {
+	var problems []Problem
+
+	plistPath := filepath.Join(s.BundlePath, "Info.plist")
+	data, err := os.ReadFile(plistPath)
+	switch {
+	case os.IsNotExist(err):
+		p := Problem{Path: plistPath, Message: "Info.plist is missing"}
+		backupPath := filepath.Join(s.BundlePath, "Info.bckup")
+		if _, err := os.Stat(backupPath); err != nil {
+			p.Message += " (no Info.bckup to restore it from)"
+		} else if repair {
+			p.Repaired = copyFile(backupPath, plistPath) == nil
+		}
+		problems = append(problems, p)
+	case err != nil:
+		problems = append(problems, Problem{Path: plistPath, Message: fmt.Sprintf("Info.plist is unreadable: %v", err)})
+	case !strings.Contains(string(data), "band-size"):
+		problems = append(problems, Problem{Path: plistPath, Message: "Info.plist has no band-size"})
+	}
+
+	if !dirExists(b.bandsPath(s)) {
+		problems = append(problems, Problem{Path: b.bandsPath(s), Message: "bands directory is missing"})
+	}
+	return problems
+}
+
+// CheckSnapshot verifies that the snapshot holds band files. Band hashes are
+// recorded in the database, so verify is left to the caller.
+func (sparseBundle) CheckSnapshot(s *Store, snapshotPath string, verify bool) []Problem {
+	entries, err := os.ReadDir(snapshotPath)
+	if err != nil {
+		return []Problem{{Path: snapshotPath, Message: fmt.Sprintf("unreadable: %v", err)}}
+	}
+
+	var problems []Problem
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			problems = append(problems, Problem{Path: filepath.Join(snapshotPath, entry.Name()), Message: "not a band file"})
+		}
+	}
+	if len(entries) == 0 {
+		problems = append(problems, Problem{Path: snapshotPath, Message: "snapshot has no bands"})
+	}
+	return problems
+}
+
+// AttachSnapshot creates a temp bundle in workDir from the snapshot's bands
+// and mounts it read-only at mountPoint
+func (b sparseBundle) AttachSnapshot(s *Store, snapshotPath, workDir, mountPoint string) error {
+	tmpBundle := filepath.Join(workDir, "snapshot.sparsebundle")
+	if err := os.MkdirAll(tmpBundle, 0755); err != nil {
+		return fmt.Errorf("failed to create temp bundle directory: %w", err)
+	}
+
+	if err := b.createTempBundle(s, tmpBundle, snapshotPath); err != nil {
+		os.RemoveAll(tmpBundle)
+		return fmt.Errorf("failed to create temp bundle: %w", err)
+	}
+
+	// Create mount point
+	if err := os.MkdirAll(mountPoint, 0755); err != nil {
+		os.RemoveAll(tmpBundle)
+		return fmt.Errorf("failed to create mount point: %w", err)
+	}
+
+	// Mount the temp bundle
+	cmd := exec.Command("hdiutil", "attach", tmpBundle,
+		"-mountpoint", mountPoint,
+		"-readonly",
+		"-nobrowse",
+		"-quiet")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		os.RemoveAll(tmpBundle)
+		os.RemoveAll(mountPoint)
+		return fmt.Errorf("failed to mount temp bundle: %w\n%s", err, output)
+	}
+
+	return nil
+}
+
+func (sparseBundle) DetachSnapshot(s *Store, workDir, mountPoint string) error {
+	// Unmount
+	cmd := exec.Command("hdiutil", "detach", mountPoint, "-quiet")
+	if err := cmd.Run(); err != nil {
+		// Try force detach
+		cmd = exec.Command("hdiutil", "detach", mountPoint, "-force", "-quiet")
+		cmd.Run()
+	}
+
+	// Remove mount point directory
+	os.RemoveAll(mountPoint)
+
+	// Remove temp bundle
+	os.RemoveAll(filepath.Join(workDir, "snapshot.sparsebundle"))
+
+	return nil
+}
+
+// ForkSnapshot builds dst's bundle from the snapshot's bands, with src's
+// Info.plist and token
+func (b sparseBundle) ForkSnapshot(src *Store, snapshotPath string, dst *Store) error {
+	if err := os.MkdirAll(dst.BundlePath, 0755); err != nil {
+		return fmt.Errorf("failed to create bundle directory: %w", err)
+	}
+	if err := b.createTempBundle(src, dst.BundlePath, snapshotPath); err != nil {
+		os.RemoveAll(dst.BundlePath)
+		return err
+	}
+	return nil
+}
+
+// createTempBundle creates a temp sparse bundle structure from checkpoint bands
+func (sparseBundle) createTempBundle(s *Store, tmpBundle, checkpointPath string) error {
+	// Copy Info.plist from original bundle
+	infoPlist := filepath.Join(s.BundlePath, "Info.plist")
+	if err := copyFile(infoPlist, filepath.Join(tmpBundle, "Info.plist")); err != nil {
+		return fmt.Errorf("failed to copy Info.plist: %w", err)
+	}
+
+	// Copy token file if it exists
+	tokenFile := filepath.Join(s.BundlePath, "token")
+	if _, err := os.Stat(tokenFile); err == nil {
+		if err := copyFile(tokenFile, filepath.Join(tmpBundle, "token")); err != nil {
+			return fmt.Errorf("failed to copy token: %w", err)
+		}
+	}
+
+	// Clone bands from checkpoint using APFS reflinks
+	// This is instant and uses no extra disk space on APFS
+	bandsDir := filepath.Join(tmpBundle, "bands")
+	if err := clone.Tree(checkpointPath, bandsDir, clone.Options{}); err != nil {
+		return fmt.Errorf("failed to clone bands: %w", err)
+	}
+
+	return nil
+}
+
+// bandsPath returns the path to the bands directory in the sparse bundle
+func (sparseBundle) bandsPath(s *Store) string {
+	return filepath.Join(s.BundlePath, "bands")
+}
+
+// copyFile copies a file from src to dst
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0644)
+}
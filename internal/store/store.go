@@ -3,26 +3,31 @@ package store
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
-	"syscall"
 	"time"
+
+	"github.com/sleexyz/agentfs/internal/clone"
 )
 
-// Store represents a sparse bundle store (self-contained in foo.fs/)
+// Store represents a store (self-contained in foo.fs/)
 type Store struct {
 	Name        string
-	StorePath   string // Path to foo.fs/ directory
-	BundlePath  string // Path to foo.fs/data.sparsebundle/
-	MountPath   string // Path to foo/ mount point (adjacent)
+	StorePath   string  // Path to foo.fs/ directory
+	BundlePath  string  // Path to the backend's data (e.g., foo.fs/data.sparsebundle/)
+	MountPath   string  // Path to foo/ mount point (adjacent)
+	Backend     Backend // Storage backend owning the data
 	SizeBytes   int64
 	CreatedAt   time.Time
 	MountedAt   *time.Time
 	Checkpoints int // Count of checkpoints
+
+	// Progress is called for each file cloned while taking or restoring a
+	// snapshot, by backends that clone a tree of files (optional)
+	Progress func(clone.Progress)
 }
 
-// Manager manages sparse bundle stores (new self-contained format)
+// Manager manages stores (new self-contained format)
 type Manager struct {
 	// No longer needs a database - stores are self-contained
 }
@@ -34,10 +39,11 @@ func NewManager() *Manager {
 
 // CreateOpts contains options for creating a store
 type CreateOpts struct {
-	Size string // e.g., "50G"
+	Size    string // e.g., "50G"
+	Backend string // Backend name (defaults to DefaultBackend())
 }
 
-// Create creates a new sparse bundle store in the current directory
+// Create creates a new store in the current directory
 // Creates foo.fs/ directory and mounts at foo/
 func (m *Manager) Create(name string, opts CreateOpts) (*Store, error) {
 	// Get current working directory
@@ -46,30 +52,125 @@ func (m *Manager) Create(name string, opts CreateOpts) (*Store, error) {
 		return nil, fmt.Errorf("failed to get current directory: %w", err)
 	}
 
-	storePath := filepath.Join(cwd, name+".fs")
 	mountPath := filepath.Join(cwd, name)
+	if err := checkMountPoint(mountPath); err != nil {
+		return nil, err
+	}
+
+	store, err := m.CreateVolume(cwd, name, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create mount point directory
+	if err := os.MkdirAll(mountPath, 0755); err != nil {
+		os.RemoveAll(store.StorePath)
+		return nil, fmt.Errorf("failed to create mount point: %w", err)
+	}
+
+	// Mount the volume
+	if err := store.Backend.Attach(store, mountPath); err != nil {
+		os.RemoveAll(store.StorePath)
+		os.RemoveAll(mountPath)
+		return nil, err
+	}
+
+	now := time.Now()
+	store.MountedAt = &now
+
+	return store, nil
+}
+
+// Fork creates a new store named name next to src, holding the data of src's
+// snapshot at snapshotPath, and mounts it. The new store uses src's backend
+// and has no checkpoints yet.
+func (m *Manager) Fork(src *Store, snapshotPath, name string) (*Store, error) {
+	dir := filepath.Dir(src.StorePath)
+	storePath := filepath.Join(dir, name+".fs")
+	mountPath := filepath.Join(dir, name)
 
-	// Check if store already exists
 	if _, err := os.Stat(storePath); err == nil {
 		return nil, fmt.Errorf("%s already exists", name+".fs")
 	}
+	if err := checkMountPoint(mountPath); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Join(storePath, "checkpoints"), 0755); err != nil {
+		os.RemoveAll(storePath)
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+
+	store := &Store{
+		Name:       name,
+		StorePath:  storePath,
+		BundlePath: src.Backend.DataPath(storePath),
+		MountPath:  mountPath,
+		Backend:    src.Backend,
+		SizeBytes:  src.SizeBytes,
+		CreatedAt:  time.Now(),
+	}
+
+	if err := src.Backend.ForkSnapshot(src, snapshotPath, store); err != nil {
+		os.RemoveAll(storePath)
+		return nil, fmt.Errorf("failed to fork snapshot: %w", err)
+	}
+
+	if err := os.MkdirAll(mountPath, 0755); err != nil {
+		os.RemoveAll(storePath)
+		return nil, fmt.Errorf("failed to create mount point: %w", err)
+	}
+	if err := store.Backend.Attach(store, mountPath); err != nil {
+		os.RemoveAll(storePath)
+		os.RemoveAll(mountPath)
+		return nil, err
+	}
 
-	// Check if mount point already exists and is not empty
+	now := time.Now()
+	store.MountedAt = &now
+
+	return store, nil
+}
+
+// checkMountPoint returns an error if mountPath exists and isn't an empty
+// directory
+func checkMountPoint(mountPath string) error {
+	name := filepath.Base(mountPath)
 	if info, err := os.Stat(mountPath); err == nil {
-		if info.IsDir() {
-			entries, _ := os.ReadDir(mountPath)
-			if len(entries) > 0 {
-				return nil, fmt.Errorf("%s/ already exists and is not empty", name)
-			}
-		} else {
-			return nil, fmt.Errorf("%s already exists and is not a directory", name)
+		if !info.IsDir() {
+			return fmt.Errorf("%s already exists and is not a directory", name)
+		}
+		entries, _ := os.ReadDir(mountPath)
+		if len(entries) > 0 {
+			return fmt.Errorf("%s/ already exists and is not empty", name)
 		}
 	}
+	return nil
+}
+
+// CreateVolume creates foo.fs/ in dir with its checkpoints directory and
+// backing volume, without mounting it
+func (m *Manager) CreateVolume(dir, name string, opts CreateOpts) (*Store, error) {
+	storePath := filepath.Join(dir, name+".fs")
+	mountPath := filepath.Join(dir, name)
+
+	// Check if store already exists
+	if _, err := os.Stat(storePath); err == nil {
+		return nil, fmt.Errorf("%s already exists", name+".fs")
+	}
 
 	// Set defaults
 	if opts.Size == "" {
 		opts.Size = "50G"
 	}
+	if opts.Backend == "" {
+		opts.Backend = DefaultBackend()
+	}
+
+	backend, err := LookupBackend(opts.Backend)
+	if err != nil {
+		return nil, err
+	}
 
 	// Create store directory structure
 	if err := os.MkdirAll(storePath, 0755); err != nil {
@@ -83,44 +184,20 @@ func (m *Manager) Create(name string, opts CreateOpts) (*Store, error) {
 		return nil, fmt.Errorf("failed to create checkpoints directory: %w", err)
 	}
 
-	// Create sparse bundle inside store directory
-	bundlePath := filepath.Join(storePath, "data.sparsebundle")
-	cmd := exec.Command("hdiutil", "create",
-		"-size", opts.Size,
-		"-type", "SPARSEBUNDLE",
-		"-fs", "APFS",
-		"-volname", name,
-		bundlePath)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		os.RemoveAll(storePath)
-		return nil, fmt.Errorf("failed to create sparse bundle: %w\n%s", err, output)
-	}
-
-	// Create mount point directory
-	if err := os.MkdirAll(mountPath, 0755); err != nil {
-		os.RemoveAll(storePath)
-		return nil, fmt.Errorf("failed to create mount point: %w", err)
-	}
-
-	// Mount the sparse bundle
-	cmd = exec.Command("hdiutil", "attach", bundlePath, "-mountpoint", mountPath)
-	output, err = cmd.CombinedOutput()
-	if err != nil {
-		os.RemoveAll(storePath)
-		os.RemoveAll(mountPath)
-		return nil, fmt.Errorf("failed to mount sparse bundle: %w\n%s", err, output)
-	}
-
-	now := time.Now()
 	store := &Store{
 		Name:       name,
 		StorePath:  storePath,
-		BundlePath: bundlePath,
+		BundlePath: backend.DataPath(storePath),
 		MountPath:  mountPath,
+		Backend:    backend,
 		SizeBytes:  parseSize(opts.Size),
-		CreatedAt:  now,
-		MountedAt:  &now,
+		CreatedAt:  time.Now(),
+	}
+
+	// Create the backing volume inside store directory
+	if err := backend.CreateVolume(store, opts); err != nil {
+		os.RemoveAll(storePath)
+		return nil, err
 	}
 
 	return store, nil
@@ -156,11 +233,16 @@ func (m *Manager) GetFromPath(storePath string) (*Store, error) {
 		return nil, fmt.Errorf("not a valid store: %s", storePath)
 	}
 
-	// Verify it's a valid store (has data.sparsebundle)
-	bundlePath := filepath.Join(storePath, "data.sparsebundle")
-	if _, err := os.Stat(bundlePath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("invalid store (missing data.sparsebundle): %s", storePath)
+	// Verify it's a valid store (has backend data, e.g. data.sparsebundle)
+	backend := DetectBackend(storePath)
+	if backend == nil {
+		var data []string
+		for _, b := range backends {
+			data = append(data, filepath.Base(b.DataPath(storePath)))
+		}
+		return nil, fmt.Errorf("invalid store (no backend data, expected one of: %s): %s", strings.Join(data, ", "), storePath)
 	}
+	bundlePath := backend.DataPath(storePath)
 
 	// Extract name from path (remove .fs suffix)
 	name := strings.TrimSuffix(filepath.Base(storePath), ".fs")
@@ -174,24 +256,20 @@ func (m *Manager) GetFromPath(storePath string) (*Store, error) {
 		StorePath:  storePath,
 		BundlePath: bundlePath,
 		MountPath:  mountPath,
+		Backend:    backend,
 		SizeBytes:  m.readStoreSizeFromBundle(bundlePath),
 		CreatedAt:  info.ModTime(), // Use dir mtime as proxy for creation time
 	}
 
 	// Check if mounted
-	if m.IsMounted(mountPath) {
+	if m.IsMounted(store) {
 		now := time.Now()
 		store.MountedAt = &now
 	}
 
 	// Count checkpoints
-	checkpointsPath := filepath.Join(storePath, "checkpoints")
-	if entries, err := os.ReadDir(checkpointsPath); err == nil {
-		for _, entry := range entries {
-			if entry.IsDir() && strings.HasPrefix(entry.Name(), "v") {
-				store.Checkpoints++
-			}
-		}
+	if versions, err := backend.ListSnapshots(store); err == nil {
+		store.Checkpoints = len(versions)
 	}
 
 	return store, nil
@@ -233,51 +311,62 @@ func (m *Manager) ListFromDir(dir string) ([]*Store, error) {
 
 // Mount mounts a store
 func (m *Manager) Mount(store *Store) error {
-	if m.IsMounted(store.MountPath) {
+	if m.IsMounted(store) {
 		return fmt.Errorf("already mounted at %s", store.MountPath)
 	}
 
+	if err := m.MountAt(store, store.MountPath); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	store.MountedAt = &now
+	return nil
+}
+
+// MountAt attaches a store's volume at an arbitrary path (e.g., a temp location)
+func (m *Manager) MountAt(store *Store, path string) error {
 	// Create mount point if it doesn't exist
-	if err := os.MkdirAll(store.MountPath, 0755); err != nil {
+	if err := os.MkdirAll(path, 0755); err != nil {
 		return fmt.Errorf("failed to create mount point: %w", err)
 	}
 
-	cmd := exec.Command("hdiutil", "attach", store.BundlePath, "-mountpoint", store.MountPath)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed to mount: %w\n%s", err, output)
+	if err := store.Backend.Attach(store, path); err != nil {
+		return fmt.Errorf("failed to mount: %w", err)
 	}
-
-	now := time.Now()
-	store.MountedAt = &now
 	return nil
 }
 
 // Unmount unmounts a store and removes the mount directory
 func (m *Manager) Unmount(store *Store) error {
-	if !m.IsMounted(store.MountPath) {
+	if !m.IsMounted(store) {
 		return fmt.Errorf("not mounted")
 	}
 
-	cmd := exec.Command("hdiutil", "detach", store.MountPath)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed to unmount: %w\n%s", err, output)
+	if err := m.UnmountAt(store, store.MountPath); err != nil {
+		return err
 	}
 
-	// Remove mount point directory
-	os.Remove(store.MountPath)
-
 	store.MountedAt = nil
 	return nil
 }
 
+// UnmountAt detaches a store's volume from path and removes the mount directory
+func (m *Manager) UnmountAt(store *Store, path string) error {
+	if err := store.Backend.Detach(store, path); err != nil {
+		return err
+	}
+
+	// Remove mount point directory
+	os.Remove(path)
+	return nil
+}
+
 // Delete deletes a store completely
 func (m *Manager) Delete(store *Store) error {
 	// Unmount if mounted
-	if m.IsMounted(store.MountPath) {
-		cmd := exec.Command("hdiutil", "detach", store.MountPath)
-		cmd.Run() // Ignore error, we'll try to delete anyway
+	if m.IsMounted(store) {
+		store.Backend.Detach(store, store.MountPath) // Ignore error, we'll try to delete anyway
 	}
 
 	// Remove mount point directory
@@ -291,45 +380,9 @@ func (m *Manager) Delete(store *Store) error {
 	return nil
 }
 
-// IsMounted checks if a path is a mount point
-func (m *Manager) IsMounted(path string) bool {
-	// Check if the path exists
-	pathInfo, err := os.Stat(path)
-	if err != nil {
-		return false
-	}
-	if !pathInfo.IsDir() {
-		return false
-	}
-
-	// Fast check: compare device IDs between path and its parent
-	// If different, it's a mount point
-	parentPath := filepath.Dir(path)
-	parentInfo, err := os.Stat(parentPath)
-	if err != nil {
-		return false
-	}
-
-	// Get system-specific stat info to compare device IDs
-	pathSys, ok1 := pathInfo.Sys().(*syscall.Stat_t)
-	parentSys, ok2 := parentInfo.Sys().(*syscall.Stat_t)
-
-	if ok1 && ok2 {
-		return pathSys.Dev != parentSys.Dev
-	}
-
-	// Fallback: check if path is in mount list (slower but reliable)
-	cmd := exec.Command("mount")
-	output, err := cmd.Output()
-	if err != nil {
-		return false
-	}
-	return strings.Contains(string(output), " on "+path+" ")
-}
-
-// GetBandsPath returns the path to the bands directory in the sparse bundle
-func (m *Manager) GetBandsPath(store *Store) string {
-	return filepath.Join(store.BundlePath, "bands")
+// IsMounted checks if a store's volume is attached at its mount path
+func (m *Manager) IsMounted(store *Store) bool {
+	return store.Backend.IsAttached(store, store.MountPath)
 }
 
 // GetCheckpointsPath returns the path to the checkpoints directory